@@ -3,6 +3,7 @@ package config
 
 import (
 	"os"
+	"strconv"
 	"time"
 )
 
@@ -11,6 +12,8 @@ type Config struct {
 	Services  ServicesConfig
 	JWT       JWTConfig
 	CORS      CORSConfig
+	Tracing   TracingConfig
+	LogLevel  string // LOG_LEVEL: debug, info, warn, error
 	StaticDir string
 }
 
@@ -32,6 +35,14 @@ type JWTConfig struct {
 	SecretKey []byte
 }
 
+// TracingConfig — экспорт спанов OpenTelemetry.
+// Пустой Endpoint = экспорт выключен, trace context только пробрасывается.
+type TracingConfig struct {
+	Endpoint    string
+	ServiceName string
+	SampleRatio float64
+}
+
 type CORSConfig struct {
 	AllowedOrigins   []string
 	AllowCredentials bool
@@ -69,6 +80,12 @@ func Load() (*Config, error) {
 			AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
 			AllowedHeaders:   []string{"*"},
 		},
+		Tracing: TracingConfig{
+			Endpoint:    getEnv("OTEL_EXPORTER_OTLP_ENDPOINT", ""),
+			ServiceName: getEnv("OTEL_SERVICE_NAME", "gateway"),
+			SampleRatio: getFloatEnv("OTEL_TRACES_SAMPLE_RATIO", 1.0),
+		},
+		LogLevel: getEnv("LOG_LEVEL", "info"),
 		// Статика отдаётся через user-service или nginx напрямую,
 		// локальный путь нужен только при запуске вне Docker
 		StaticDir: getEnv("STATIC_DIR", "/static"),
@@ -90,3 +107,12 @@ func getDurationEnv(key string, defaultValue time.Duration) time.Duration {
 	}
 	return defaultValue
 }
+
+func getFloatEnv(key string, defaultValue float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		if f, err := strconv.ParseFloat(value, 64); err == nil {
+			return f
+		}
+	}
+	return defaultValue
+}
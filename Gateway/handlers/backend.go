@@ -0,0 +1,284 @@
+// Gateway/handlers/backend.go
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"sync"
+	"time"
+
+	"Gateway/logger"
+	"Gateway/metrics"
+	"Gateway/tracing"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	reconnectMinDelay = 500 * time.Millisecond
+	reconnectMaxDelay = 15 * time.Second
+	maxPendingFrames  = 256
+	maxPendingBytes   = 1024 * 1024 // 1MB на сервис на клиента
+)
+
+// errBackendRejected — сервис отверг токен при подключении, повторять бессмысленно
+var errBackendRejected = errors.New("backend rejected credentials")
+
+// События, которыми Gateway сообщает клиенту о состоянии backend-сервисов
+const (
+	eventBackendDegraded    = "gateway:degraded"
+	eventBackendRestored    = "gateway:restored"
+	eventBackendUnavailable = "gateway:unavailable"
+)
+
+// backendConn — WS соединение Gateway с одним backend-сервисом (chat / voice).
+// При обрыве переподключается с экспоненциальной задержкой, клиентский сокет
+// при этом остаётся открытым. Пока соединения нет, кадры от клиента копятся
+// в ограниченной очереди и отправляются после восстановления.
+type backendConn struct {
+	service string
+	dial    func() (*websocket.Conn, error)
+	log     *slog.Logger
+
+	// dropOnReconnect — очередь не переживает переподключение: кадры для
+	// прошлой сессии сервиса (сигнализация звонка) новой сессии не нужны
+	dropOnReconnect bool
+
+	mu           sync.Mutex // защищает conn и очередь; держится на время записи в conn
+	conn         *websocket.Conn
+	connected    bool // соединение уже было
+	pending      [][]byte
+	pendingBytes int
+	dropped      int
+	closed       bool
+}
+
+func newBackendConn(log *slog.Logger, service string, dial func() (*websocket.Conn, error), initial *websocket.Conn) *backendConn {
+	return &backendConn{
+		service:   service,
+		dial:      dial,
+		log:       log.With("backend", service),
+		conn:      initial,
+		connected: initial != nil,
+	}
+}
+
+// run читает кадры от сервиса и переподключается при обрыве, пока жив ctx.
+// deliver возвращает false, если клиент уже отключился.
+// Ошибка возвращается только если восстановить соединение невозможно.
+func (b *backendConn) run(ctx context.Context, deliver func([]byte) bool, notify func(event string, data map[string]interface{})) error {
+	b.mu.Lock()
+	conn := b.conn
+	b.mu.Unlock()
+
+	for {
+		if conn == nil {
+			var err error
+			conn, err = b.reconnect(ctx)
+			if err != nil {
+				return err
+			}
+			if conn == nil { // ctx отменён
+				return nil
+			}
+			dropped, ok := b.attach(conn)
+			if !ok {
+				return nil
+			}
+			notify(eventBackendRestored, map[string]interface{}{
+				"service": b.service,
+				"dropped": dropped,
+			})
+		}
+
+		if !b.readLoop(conn, deliver) {
+			return nil
+		}
+		b.detach(conn)
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		b.log.Warn("lost backend connection, reconnecting")
+		notify(eventBackendDegraded, map[string]interface{}{"service": b.service})
+		conn = nil
+	}
+}
+
+// reconnect дозванивается до сервиса с экспоненциальной задержкой и jitter.
+func (b *backendConn) reconnect(ctx context.Context) (*websocket.Conn, error) {
+	delay := reconnectMinDelay
+	for {
+		timer := time.NewTimer(delay/2 + rand.N(delay/2+1))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, nil
+		case <-timer.C:
+		}
+
+		conn, err := b.dial()
+		if err == nil {
+			return conn, nil
+		}
+		if errors.Is(err, errBackendRejected) {
+			return nil, err
+		}
+		metrics.UpstreamErrors.WithLabelValues(b.service).Inc()
+		b.log.Warn("backend reconnect failed", "error", err)
+
+		delay *= 2
+		if delay > reconnectMaxDelay {
+			delay = reconnectMaxDelay
+		}
+	}
+}
+
+// readLoop пересылает кадры сервиса клиенту до ошибки чтения.
+// Возвращает false, если клиент отключился и продолжать не нужно.
+func (b *backendConn) readLoop(conn *websocket.Conn, deliver func([]byte) bool) bool {
+	for {
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err,
+				websocket.CloseGoingAway,
+				websocket.CloseAbnormalClosure,
+			) {
+				b.log.Warn("backend read error", "error", err)
+			}
+			return true
+		}
+		if !deliver(message) {
+			return false
+		}
+	}
+}
+
+// attach делает conn текущим соединением и отправляет накопленную очередь
+// (при dropOnReconnect — только до первого соединения, потом отбрасывает).
+// Возвращает число кадров, потерянных из-за переполнения очереди.
+func (b *backendConn) attach(conn *websocket.Conn) (int, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		conn.Close()
+		return 0, false
+	}
+	b.conn = conn
+
+	if b.dropOnReconnect && b.connected {
+		b.dropped += len(b.pending)
+		metrics.WSDroppedFrames.WithLabelValues(b.service).Add(float64(len(b.pending)))
+		b.pending = nil
+		b.pendingBytes = 0
+	}
+	b.connected = true
+
+	for len(b.pending) > 0 {
+		frame := b.pending[0]
+		if err := b.writeLocked(frame); err != nil {
+			// readLoop увидит закрытое соединение и начнёт новый цикл
+			break
+		}
+		b.pending = b.pending[1:]
+		b.pendingBytes -= len(frame)
+	}
+
+	dropped := b.dropped
+	b.dropped = 0
+	return dropped, true
+}
+
+// detach снимает conn, если он всё ещё текущий.
+func (b *backendConn) detach(conn *websocket.Conn) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.conn == conn {
+		b.conn = nil
+	}
+	conn.Close()
+}
+
+// write отправляет кадр в сервис, а при отсутствии соединения ставит в очередь.
+func (b *backendConn) write(frame []byte) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return
+	}
+	if b.conn != nil {
+		if err := b.writeLocked(frame); err == nil {
+			return
+		}
+	}
+	b.enqueueLocked(frame)
+}
+
+func (b *backendConn) writeLocked(frame []byte) error {
+	b.conn.SetWriteDeadline(time.Now().Add(writeWait))
+	err := b.conn.WriteMessage(websocket.TextMessage, frame)
+	if err != nil {
+		b.log.Warn("backend write error", "error", err)
+		b.conn.Close()
+		b.conn = nil
+	}
+	return err
+}
+
+// enqueueLocked кладёт кадр в очередь, вытесняя самые старые при превышении лимитов.
+func (b *backendConn) enqueueLocked(frame []byte) {
+	if len(frame) > maxPendingBytes {
+		b.dropped++
+		metrics.WSDroppedFrames.WithLabelValues(b.service).Inc()
+		return
+	}
+	b.pending = append(b.pending, frame)
+	b.pendingBytes += len(frame)
+
+	for len(b.pending) > maxPendingFrames || b.pendingBytes > maxPendingBytes {
+		b.pendingBytes -= len(b.pending[0])
+		b.pending[0] = nil
+		b.pending = b.pending[1:]
+		b.dropped++
+		metrics.WSDroppedFrames.WithLabelValues(b.service).Inc()
+	}
+}
+
+// close закрывает соединение и отбрасывает очередь; после close write — no-op.
+func (b *backendConn) close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	if b.conn != nil {
+		b.conn.Close()
+		b.conn = nil
+	}
+	b.pending = nil
+	b.pendingBytes = 0
+}
+
+// dialBackend подключается к WS сервиса, передавая trace context и X-Request-ID
+// из ctx; 401/403 превращается в errBackendRejected.
+func dialBackend(ctx context.Context, rawURL string) (*websocket.Conn, error) {
+	header := http.Header{}
+	tracing.InjectHeaders(ctx, header)
+	if id := logger.RequestID(ctx); id != "" {
+		header.Set(logger.HeaderRequestID, id)
+	}
+
+	conn, resp, err := websocket.DefaultDialer.DialContext(ctx, rawURL, header)
+	if err != nil {
+		if resp != nil && (resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden) {
+			return nil, errBackendRejected
+		}
+		return nil, err
+	}
+	return conn, nil
+}
@@ -0,0 +1,154 @@
+// Gateway/handlers/backend_test.go
+package handlers
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// echoBackend — тестовый WS сервис, отвечающий эхом и умеющий рвать соединения
+type echoBackend struct {
+	srv   *httptest.Server
+	mu    sync.Mutex
+	conns []*websocket.Conn
+}
+
+func newEchoBackend(t *testing.T) *echoBackend {
+	b := &echoBackend{}
+	b.srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		b.mu.Lock()
+		b.conns = append(b.conns, conn)
+		b.mu.Unlock()
+		for {
+			mt, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			if err := conn.WriteMessage(mt, data); err != nil {
+				return
+			}
+		}
+	}))
+	t.Cleanup(b.srv.Close)
+	return b
+}
+
+func (b *echoBackend) url() string {
+	return "ws" + strings.TrimPrefix(b.srv.URL, "http")
+}
+
+func (b *echoBackend) dropAll() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, c := range b.conns {
+		c.Close()
+	}
+	b.conns = nil
+}
+
+func expectFrame(t *testing.T, ch <-chan string, want string) {
+	t.Helper()
+	select {
+	case got := <-ch:
+		if got != want {
+			t.Fatalf("Expected %q, got %q", want, got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Timed out waiting for %q", want)
+	}
+}
+
+func TestBackendConnReconnects(t *testing.T) {
+	backend := newEchoBackend(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	frames := make(chan string, 16)
+	events := make(chan string, 16)
+
+	bc := newBackendConn(slog.Default(), "chat", func() (*websocket.Conn, error) {
+		return dialBackend(context.Background(), backend.url())
+	}, nil)
+	defer bc.close()
+
+	go bc.run(ctx,
+		func(msg []byte) bool { frames <- string(msg); return true },
+		func(event string, _ map[string]interface{}) { events <- event },
+	)
+
+	// Соединения ещё нет — кадр уходит в очередь и доставляется после подключения
+	bc.write([]byte("queued"))
+	expectFrame(t, events, eventBackendRestored)
+	expectFrame(t, frames, "queued")
+
+	backend.dropAll()
+	expectFrame(t, events, eventBackendDegraded)
+	expectFrame(t, events, eventBackendRestored)
+
+	bc.write([]byte("after"))
+	expectFrame(t, frames, "after")
+}
+
+func TestBackendConnQueueIsBounded(t *testing.T) {
+	bc := newBackendConn(slog.Default(), "chat", nil, nil)
+
+	for i := 0; i < maxPendingFrames+10; i++ {
+		bc.write([]byte("x"))
+	}
+
+	if len(bc.pending) != maxPendingFrames {
+		t.Errorf("Expected %d pending frames, got %d", maxPendingFrames, len(bc.pending))
+	}
+	if bc.dropped != 10 {
+		t.Errorf("Expected 10 dropped frames, got %d", bc.dropped)
+	}
+
+	bc.write(make([]byte, maxPendingBytes+1))
+	if bc.dropped != 11 {
+		t.Errorf("Expected oversized frame to be dropped, got %d dropped", bc.dropped)
+	}
+}
+
+func TestBackendConnDropsQueueOnReconnect(t *testing.T) {
+	backend := newEchoBackend(t)
+
+	bc := newBackendConn(slog.Default(), "voice", func() (*websocket.Conn, error) {
+		return dialBackend(context.Background(), backend.url())
+	}, nil)
+	bc.dropOnReconnect = true
+	defer bc.close()
+
+	// До первого соединения очередь отправляется
+	bc.write([]byte("first"))
+	conn, err := bc.dial()
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	if dropped, _ := bc.attach(conn); dropped != 0 || len(bc.pending) != 0 {
+		t.Fatalf("Expected queue to be sent, got %d dropped, %d pending", dropped, len(bc.pending))
+	}
+
+	// После обрыва кадры прошлой сессии новой не достаются
+	bc.detach(conn)
+	bc.write([]byte("stale"))
+	conn, err = bc.dial()
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	if dropped, _ := bc.attach(conn); dropped != 1 || len(bc.pending) != 0 {
+		t.Errorf("Expected stale frame to be dropped, got %d dropped, %d pending", dropped, len(bc.pending))
+	}
+}
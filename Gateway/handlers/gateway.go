@@ -4,13 +4,15 @@ package handlers
 import (
 	"context"
 	"io"
-	"log"
 	"net/http"
 	"time"
 
 	"Gateway/config"
+	"Gateway/logger"
+	"Gateway/metrics"
 
 	"github.com/gorilla/mux"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 )
 
 // ProxyClient интерфейс для проксирования запросов
@@ -27,13 +29,14 @@ type GatewayHandler struct {
 
 // NewGatewayHandler создает новый экземпляр GatewayHandler
 func NewGatewayHandler(cfg *config.Config) *GatewayHandler {
+	// otelhttp.Transport открывает client span и пишет traceparent в запрос к сервису
 	httpClient := &http.Client{
 		Timeout: 30 * time.Second,
-		Transport: &http.Transport{
+		Transport: otelhttp.NewTransport(&http.Transport{
 			MaxIdleConns:        100,
 			MaxIdleConnsPerHost: 10,
 			IdleConnTimeout:     90 * time.Second,
-		},
+		}),
 	}
 
 	return &GatewayHandler{
@@ -55,6 +58,7 @@ func (h *GatewayHandler) RegisterRoutes(r *mux.Router) {
 	// Chat Service
 	r.PathPrefix("/api/chats").HandlerFunc(h.proxyToChats)
 	r.PathPrefix("/api/media/").HandlerFunc(h.proxyToMedia)
+	r.HandleFunc("/api/sync", h.proxyToChats)
 
 	// WebSocket
 	r.HandleFunc("/ws", h.wsHandler.HandleWebSocket)
@@ -64,33 +68,36 @@ func (h *GatewayHandler) RegisterRoutes(r *mux.Router) {
 
 	// Health check
 	r.HandleFunc("/api/health", h.healthCheck).Methods("GET")
+
+	// Prometheus (наружу через nginx не публикуется)
+	r.Handle("/metrics", metrics.Handler()).Methods("GET")
 }
 
 // proxyToAuth проксирует запросы к Auth Service
 func (h *GatewayHandler) proxyToAuth(w http.ResponseWriter, r *http.Request) {
-	h.proxyRequest(w, r, h.config.Services.AuthServiceURL)
+	h.proxyRequest(w, r, "auth", h.config.Services.AuthServiceURL)
 }
 
 // proxyToUsers проксирует запросы к User Service
 func (h *GatewayHandler) proxyToUsers(w http.ResponseWriter, r *http.Request) {
-	h.proxyRequest(w, r, h.config.Services.UserServiceURL)
+	h.proxyRequest(w, r, "user", h.config.Services.UserServiceURL)
 }
 
 // proxyToChats проксирует запросы к Chat Service
 func (h *GatewayHandler) proxyToChats(w http.ResponseWriter, r *http.Request) {
-	h.proxyRequest(w, r, h.config.Services.ChatServiceURL)
+	h.proxyRequest(w, r, "chat", h.config.Services.ChatServiceURL)
 }
 
 func (h *GatewayHandler) proxyToMedia(w http.ResponseWriter, r *http.Request) {
-	h.proxyRequest(w, r, h.config.Services.ChatServiceURL)
+	h.proxyRequest(w, r, "chat", h.config.Services.ChatServiceURL)
 }
 
 func (h *GatewayHandler) proxyToVoice(w http.ResponseWriter, r *http.Request) {
-	h.proxyRequest(w, r, h.config.Services.VoiceServiceURL)
+	h.proxyRequest(w, r, "voice", h.config.Services.VoiceServiceURL)
 }
 
 // proxyRequest проксирует HTTP запрос к целевому сервису
-func (h *GatewayHandler) proxyRequest(w http.ResponseWriter, r *http.Request, targetURL string) {
+func (h *GatewayHandler) proxyRequest(w http.ResponseWriter, r *http.Request, service, targetURL string) {
 	// Создаем контекст с таймаутом
 	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
 	defer cancel()
@@ -103,7 +110,7 @@ func (h *GatewayHandler) proxyRequest(w http.ResponseWriter, r *http.Request, ta
 		r.Body,
 	)
 	if err != nil {
-		log.Printf("Error creating proxy request: %v", err)
+		logger.From(r.Context()).Error("create proxy request", "service", service, "error", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
@@ -114,7 +121,8 @@ func (h *GatewayHandler) proxyRequest(w http.ResponseWriter, r *http.Request, ta
 	// Отправляем запрос к целевому сервису
 	resp, err := h.httpClient.Do(targetReq)
 	if err != nil {
-		log.Printf("Error proxying request to %s: %v", targetURL, err)
+		metrics.UpstreamErrors.WithLabelValues(service).Inc()
+		logger.From(r.Context()).Error("proxy request", "service", service, "target", targetURL, "error", err)
 		http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
 		return
 	}
@@ -122,13 +130,15 @@ func (h *GatewayHandler) proxyRequest(w http.ResponseWriter, r *http.Request, ta
 
 	// Копируем заголовки ответа
 	h.copyHeaders(w.Header(), resp.Header)
+	// Сервис возвращает тот же X-Request-ID — не дублируем заголовок
+	w.Header().Set(logger.HeaderRequestID, r.Header.Get(logger.HeaderRequestID))
 
 	// Устанавливаем статус код
 	w.WriteHeader(resp.StatusCode)
 
 	// Копируем тело ответа
 	if _, err := io.Copy(w, resp.Body); err != nil {
-		log.Printf("Error copying response body: %v", err)
+		logger.From(r.Context()).Warn("copy response body", "service", service, "error", err)
 	}
 }
 
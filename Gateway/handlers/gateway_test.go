@@ -2,12 +2,22 @@
 package handlers
 
 import (
+	"context"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
 	"Gateway/config"
+	"Gateway/logger"
+	"Gateway/middleware"
+	"Gateway/tracing"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gorilla/mux/otelmux"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 )
 
 func TestHealthCheck(t *testing.T) {
@@ -75,6 +85,88 @@ func TestCopyHeaders(t *testing.T) {
 	}
 }
 
+func TestProxyPropagatesTraceContext(t *testing.T) {
+	if _, err := tracing.Init(context.Background(), config.TracingConfig{}); err != nil {
+		t.Fatalf("tracing init failed: %v", err)
+	}
+	otel.SetTracerProvider(sdktrace.NewTracerProvider())
+
+	received := make(chan string, 1)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- r.Header.Get("traceparent")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer backend.Close()
+
+	cfg := &config.Config{
+		Services: config.ServicesConfig{ChatServiceURL: backend.URL},
+		JWT:      config.JWTConfig{SecretKey: []byte("test-secret-key")},
+	}
+
+	r := mux.NewRouter()
+	r.Use(otelmux.Middleware("gateway-test"))
+	NewGatewayHandler(cfg).RegisterRoutes(r)
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	incoming := "00-" + traceID + "-00f067aa0ba902b7-01"
+
+	req := httptest.NewRequest("GET", "/api/chats", nil)
+	req.Header.Set("traceparent", incoming)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	got := <-received
+	if !strings.Contains(got, traceID) {
+		t.Fatalf("Expected trace id %s to be propagated, got %q", traceID, got)
+	}
+	if got == incoming {
+		t.Errorf("Expected Gateway to add its own span, got parent header unchanged")
+	}
+}
+
+func TestProxyRequestID(t *testing.T) {
+	received := make(chan string, 1)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- r.Header.Get(logger.HeaderRequestID)
+		w.Header().Set(logger.HeaderRequestID, r.Header.Get(logger.HeaderRequestID))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer backend.Close()
+
+	cfg := &config.Config{
+		Services: config.ServicesConfig{ChatServiceURL: backend.URL},
+		JWT:      config.JWTConfig{SecretKey: []byte("test-secret-key")},
+	}
+
+	r := mux.NewRouter()
+	r.Use(middleware.RequestID)
+	NewGatewayHandler(cfg).RegisterRoutes(r)
+
+	// id клиента сохраняется
+	req := httptest.NewRequest("GET", "/api/chats", nil)
+	req.Header.Set(logger.HeaderRequestID, "client-id-1")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if got := <-received; got != "client-id-1" {
+		t.Errorf("Expected client request id to be forwarded, got %q", got)
+	}
+	if got := w.Result().Header.Values(logger.HeaderRequestID); len(got) != 1 || got[0] != "client-id-1" {
+		t.Errorf("Expected single response request id, got %v", got)
+	}
+
+	// некорректный id заменяется сгенерированным
+	req = httptest.NewRequest("GET", "/api/chats", nil)
+	req.Header.Set(logger.HeaderRequestID, "bad id\n")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	got := <-received
+	if got == "" || got == "bad id\n" || got != w.Result().Header.Get(logger.HeaderRequestID) {
+		t.Errorf("Expected generated request id, got %q", got)
+	}
+}
+
 // Benchmark для проверки производительности
 func BenchmarkHealthCheck(b *testing.B) {
 	cfg := &config.Config{
@@ -1,21 +1,26 @@
 // Gateway/handlers/ws.go
-// ИЗМЕНЕНИЯ: добавлен voiceConn в Client, поддержка /ws/voice endpoint
-// и маршрутизация сообщений по типу (chat vs voice)
+// ИЗМЕНЕНИЯ: добавлен voice backend в Client, поддержка /ws/voice endpoint
+// и маршрутизация сообщений по типу (chat vs voice).
+// Соединения с сервисами переподключаются сами (см. backend.go).
 
 package handlers
 
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"net/url"
+	"slices"
 	"sync"
 	"time"
 
 	"Gateway/auth"
 	"Gateway/config"
+	"Gateway/logger"
+	"Gateway/metrics"
 
 	"github.com/gorilla/websocket"
 )
@@ -68,26 +73,65 @@ func routeMessage(data []byte) targetService {
 // Client — WS сессия одного пользователя на Gateway
 type Client struct {
 	conn      *websocket.Conn
-	chatConn  *websocket.Conn
-	voiceConn *websocket.Conn // nil если voice service не подключён
+	chat      *backendConn
+	voice     *backendConn // nil пока не было голосовых сообщений
+	voiceMu   sync.Mutex   // защищает ленивое создание voice
 	login     string
 	token     string
 	send      chan []byte
-	ctx       context.Context
+	log       *slog.Logger
+	ctx       context.Context // несёт request id сессии, им же подписываются подключения к сервисам
 	cancel    context.CancelFunc
+	release   func()     // убирает сессию из WebSocketHandler.sessions
 	mu        sync.Mutex // защищает запись в conn
+	closeOnce sync.Once
 }
 
+// maxSessionsPerLogin — сколько устройств пользователя держим одновременно,
+// как и Chat Service: лишнюю сессию он закрыл бы сам, и она бы переподключалась.
+const maxSessionsPerLogin = 10
+
 type WebSocketHandler struct {
 	config     *config.Config
 	jwtService *auth.JWTService
-	clients    sync.Map
+
+	sessionsMu sync.Mutex
+	sessions   map[string][]*Client // по сессии на устройство, старые первыми
 }
 
 func NewWebSocketHandler(cfg *config.Config) *WebSocketHandler {
 	return &WebSocketHandler{
 		config:     cfg,
 		jwtService: auth.NewJWTService(cfg.JWT.SecretKey),
+		sessions:   make(map[string][]*Client),
+	}
+}
+
+// addSession регистрирует сессию и возвращает самую старую сессию
+// пользователя, если их стало больше maxSessionsPerLogin.
+func (h *WebSocketHandler) addSession(c *Client) (evicted *Client) {
+	h.sessionsMu.Lock()
+	defer h.sessionsMu.Unlock()
+
+	sessions := append(h.sessions[c.login], c)
+	if len(sessions) > maxSessionsPerLogin {
+		evicted, sessions = sessions[0], sessions[1:]
+	}
+	h.sessions[c.login] = sessions
+	return evicted
+}
+
+func (h *WebSocketHandler) removeSession(c *Client) {
+	h.sessionsMu.Lock()
+	defer h.sessionsMu.Unlock()
+
+	sessions := slices.DeleteFunc(slices.Clone(h.sessions[c.login]), func(s *Client) bool {
+		return s == c
+	})
+	if len(sessions) == 0 {
+		delete(h.sessions, c.login)
+	} else {
+		h.sessions[c.login] = sessions
 	}
 }
 
@@ -103,23 +147,16 @@ func (h *WebSocketHandler) HandleWebSocket(w http.ResponseWriter, r *http.Reques
 
 	claims, err := h.jwtService.ValidateToken(token)
 	if err != nil {
-		log.Printf("JWT validation error: %v", err)
+		logger.From(r.Context()).Warn("jwt validation failed", "error", err)
 		http.Error(w, "Invalid token", http.StatusUnauthorized)
 		return
 	}
-
-	// Закрываем старое соединение
-	if existing, exists := h.clients.Load(claims.Login); exists {
-		if oldClient, ok := existing.(*Client); ok {
-			log.Printf("Closing old connection for %s", claims.Login)
-			oldClient.cleanup()
-			h.clients.Delete(claims.Login)
-		}
-	}
+	logger.With(r.Context(), "login", claims.Login)
+	log := logger.From(r.Context())
 
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
-		log.Printf("WebSocket upgrade error: %v", err)
+		log.Warn("websocket upgrade failed", "error", err)
 		return
 	}
 
@@ -130,30 +167,42 @@ func (h *WebSocketHandler) HandleWebSocket(w http.ResponseWriter, r *http.Reques
 		return nil
 	})
 
-	chatConn, err := h.connectToChatService(token)
+	chatConn, err := h.connectToChatService(r.Context(), token)
 	if err != nil {
-		log.Printf("Failed to connect to chat service: %v", err)
+		log.Error("connect to chat service failed", "error", err)
 		conn.Close()
 		return
 	}
 
-	ctx, cancel := context.WithCancel(context.Background())
+	// Сессия живёт дольше HTTP запроса: переносим в её контекст только request id,
+	// чтобы переподключения к сервисам шли с тем же X-Request-ID
+	ctx, cancel := context.WithCancel(logger.NewContext(context.Background(), logger.RequestID(r.Context())))
 	client := &Client{
-		conn:     conn,
-		chatConn: chatConn,
-		login:    claims.Login,
-		token:    token,
-		send:     make(chan []byte, 256),
-		ctx:      ctx,
-		cancel:   cancel,
+		conn: conn,
+		chat: newBackendConn(log, "chat", func() (*websocket.Conn, error) {
+			return h.connectToChatService(ctx, token)
+		}, chatConn),
+		login:  claims.Login,
+		token:  token,
+		send:   make(chan []byte, 256),
+		log:    log,
+		ctx:    ctx,
+		cancel: cancel,
 	}
+	client.release = func() { h.removeSession(client) }
 
-	h.clients.Store(claims.Login, client)
-	log.Printf("Client connected: %s", claims.Login)
+	// Каждое устройство — своя сессия: Chat Service рассылает события
+	// и на другие устройства того же пользователя
+	if evicted := h.addSession(client); evicted != nil {
+		evicted.log.Info("closing oldest ws session: too many devices")
+		evicted.cleanup()
+	}
+	metrics.WSClients.Inc()
+	log.Info("ws client connected")
 
 	go client.readFromClient(h)
 	go client.writeToClient()
-	go client.readFromChatService()
+	go client.runChatBackend()
 	go client.pingClient()
 }
 
@@ -170,20 +219,22 @@ func (h *WebSocketHandler) HandleVoiceWebSocket(w http.ResponseWriter, r *http.R
 		return
 	}
 
-	if _, err := h.jwtService.ValidateToken(token); err != nil {
+	claims, err := h.jwtService.ValidateToken(token)
+	if err != nil {
 		http.Error(w, "Invalid token", http.StatusUnauthorized)
 		return
 	}
+	logger.With(r.Context(), "login", claims.Login)
 
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
-		log.Printf("Voice WS upgrade error: %v", err)
+		logger.From(r.Context()).Warn("voice websocket upgrade failed", "error", err)
 		return
 	}
 
-	voiceConn, err := h.connectToVoiceService(token)
+	voiceConn, err := h.connectToVoiceService(r.Context(), token)
 	if err != nil {
-		log.Printf("Failed to connect to voice service: %v", err)
+		logger.From(r.Context()).Error("connect to voice service failed", "error", err)
 		conn.Close()
 		return
 	}
@@ -245,42 +296,43 @@ func (c *Client) readFromClient(h *WebSocketHandler) {
 					websocket.CloseGoingAway,
 					websocket.CloseAbnormalClosure,
 				) {
-					log.Printf("WS read error for %s: %v", c.login, err)
+					c.log.Warn("ws read error", "error", err)
 				}
 				return
 			}
 
-			target := routeMessage(message)
-
-			switch target {
+			switch routeMessage(message) {
 			case serviceVoice:
-				// Лениво подключаемся к voice service
-				if c.voiceConn == nil {
-					vc, err := h.connectToVoiceService(c.token)
-					if err != nil {
-						log.Printf("Failed to connect to voice service for %s: %v", c.login, err)
-						continue
-					}
-					c.voiceConn = vc
-					// Запускаем reader для ответов от voice service
-					go c.readFromVoiceService()
-				}
-				if err := c.voiceConn.WriteMessage(websocket.TextMessage, message); err != nil {
-					log.Printf("Error writing to voice service for %s: %v", c.login, err)
-					c.voiceConn.Close()
-					c.voiceConn = nil
+				if vb := c.voiceBackend(h); vb != nil {
+					vb.write(message)
 				}
-
 			default: // chat
-				if err := c.chatConn.WriteMessage(websocket.TextMessage, message); err != nil {
-					log.Printf("Error writing to chat service for %s: %v", c.login, err)
-					return
-				}
+				c.chat.write(message)
 			}
 		}
 	}
 }
 
+// voiceBackend лениво создаёт соединение с voice service при первом голосовом сообщении.
+// Дозванивается runVoiceBackend в фоне, кадры до этого ждут в очереди:
+// чтение от клиента (и чатовые кадры) медленный voice service не тормозит.
+func (c *Client) voiceBackend(h *WebSocketHandler) *backendConn {
+	c.voiceMu.Lock()
+	defer c.voiceMu.Unlock()
+
+	if c.voice != nil {
+		return c.voice
+	}
+
+	vb := newBackendConn(c.log, "voice", func() (*websocket.Conn, error) {
+		return h.connectToVoiceService(c.ctx, c.token)
+	}, nil)
+	vb.dropOnReconnect = true
+	c.voice = vb
+	go c.runVoiceBackend(vb)
+	return vb
+}
+
 func (c *Client) writeToClient() {
 	defer c.cleanup()
 
@@ -299,67 +351,96 @@ func (c *Client) writeToClient() {
 			err := c.conn.WriteMessage(websocket.TextMessage, message)
 			c.mu.Unlock()
 			if err != nil {
-				log.Printf("Error writing to client %s: %v", c.login, err)
+				c.log.Warn("ws write error", "error", err)
 				return
 			}
 		}
 	}
 }
 
-func (c *Client) readFromChatService() {
-	defer c.cleanup()
+// runChatBackend держит соединение с chat service. Если переподключиться нельзя
+// (сервис отверг токен), закрываем сессию — клиент переподключится с новым токеном.
+func (c *Client) runChatBackend() {
+	if err := c.chat.run(c.ctx, c.deliver, c.notifyStatus); err != nil {
+		c.log.Error("chat service unavailable", "error", err)
+		c.notifyStatus(eventBackendUnavailable, map[string]interface{}{"service": "chat"})
+		c.cleanup()
+	}
+}
 
-	for {
-		select {
-		case <-c.ctx.Done():
+// runVoiceBackend дозванивается до voice service (первый раз — сразу, без задержки
+// переподключения) и держит соединение. При невосстановимой ошибке, в том числе
+// если сервис отверг токен, сбрасывает его, чтобы следующее голосовое сообщение
+// попробовало заново.
+func (c *Client) runVoiceBackend(vb *backendConn) {
+	conn, err := vb.dial()
+	switch {
+	case errors.Is(err, errBackendRejected):
+	case err != nil:
+		// Сервис недоступен: run переподключится и сообщит gateway:restored
+		metrics.UpstreamErrors.WithLabelValues("voice").Inc()
+		c.log.Warn("connect to voice service failed", "error", err)
+		c.notifyStatus(eventBackendDegraded, map[string]interface{}{"service": "voice"})
+		err = vb.run(c.ctx, c.deliver, c.notifyStatus)
+	default:
+		if _, ok := vb.attach(conn); !ok {
 			return
-		default:
-			_, message, err := c.chatConn.ReadMessage()
-			if err != nil {
-				if websocket.IsUnexpectedCloseError(err,
-					websocket.CloseGoingAway,
-					websocket.CloseAbnormalClosure,
-				) {
-					log.Printf("Chat service read error for %s: %v", c.login, err)
-				}
-				return
-			}
-			select {
-			case c.send <- message:
-			case <-c.ctx.Done():
-				return
-			default:
-				log.Printf("Send channel full for %s, dropping chat message", c.login)
-			}
 		}
+		err = vb.run(c.ctx, c.deliver, c.notifyStatus)
+	}
+	if err == nil {
+		return
+	}
+	c.log.Error("voice service unavailable", "error", err)
+	c.notifyStatus(eventBackendUnavailable, map[string]interface{}{"service": "voice"})
+
+	c.voiceMu.Lock()
+	if c.voice == vb {
+		c.voice = nil
 	}
+	c.voiceMu.Unlock()
+	vb.close()
 }
 
-func (c *Client) readFromVoiceService() {
-	for {
-		select {
-		case <-c.ctx.Done():
-			return
-		default:
-			if c.voiceConn == nil {
-				return
-			}
-			_, message, err := c.voiceConn.ReadMessage()
-			if err != nil {
-				log.Printf("Voice service read error for %s: %v", c.login, err)
-				return
-			}
-			select {
-			case c.send <- message:
-			case <-c.ctx.Done():
-				return
-			default:
-				log.Printf("Send channel full for %s, dropping voice message", c.login)
-			}
-		}
+// deliver кладёт кадр в очередь клиента. Если клиент не успевает читать,
+// ждём до writeWait (притормаживая чтение из сервиса), затем кадр отбрасывается.
+// Возвращает false, если сессия уже закрыта.
+func (c *Client) deliver(message []byte) bool {
+	select {
+	case c.send <- message:
+		return true
+	case <-c.ctx.Done():
+		return false
+	default:
+	}
+
+	timer := time.NewTimer(writeWait)
+	defer timer.Stop()
+
+	select {
+	case c.send <- message:
+		return true
+	case <-c.ctx.Done():
+		return false
+	case <-timer.C:
+		metrics.WSDroppedFrames.WithLabelValues("client").Inc()
+		c.log.Warn("client send queue full, dropping frame")
+		return true
 	}
 }
 
+// notifyStatus отправляет клиенту служебное событие Gateway о состоянии сервиса.
+func (c *Client) notifyStatus(event string, data map[string]interface{}) {
+	frame, err := json.Marshal(map[string]interface{}{
+		"event": event,
+		"data":  data,
+	})
+	if err != nil {
+		return
+	}
+	c.deliver(frame)
+}
+
 func (c *Client) pingClient() {
 	ticker := time.NewTicker(pingPeriod)
 	defer ticker.Stop()
@@ -374,7 +455,7 @@ func (c *Client) pingClient() {
 			err := c.conn.WriteMessage(websocket.PingMessage, nil)
 			c.mu.Unlock()
 			if err != nil {
-				log.Printf("Ping error for %s: %v", c.login, err)
+				c.log.Warn("ws ping failed", "error", err)
 				return
 			}
 		}
@@ -382,51 +463,52 @@ func (c *Client) pingClient() {
 }
 
 func (c *Client) cleanup() {
-	c.cancel()
+	c.closeOnce.Do(func() {
+		c.cancel()
 
-	if c.conn != nil {
-		c.conn.Close()
-	}
-	if c.chatConn != nil {
-		c.chatConn.Close()
-	}
-	if c.voiceConn != nil {
-		c.voiceConn.Close()
-	}
+		if c.conn != nil {
+			c.conn.Close()
+		}
+		c.chat.close()
 
-	select {
-	case <-c.send:
-	default:
-		close(c.send)
-	}
+		c.voiceMu.Lock()
+		if c.voice != nil {
+			c.voice.close()
+		}
+		c.voiceMu.Unlock()
+
+		c.release()
 
-	log.Printf("Client disconnected: %s", c.login)
+		// send не закрываем: писатели выходят по ctx, writeToClient — тоже
+		metrics.WSClients.Dec()
+		c.log.Info("ws client disconnected")
+	})
 }
 
 // ── Service connections ────────────────────────────────────────────────────
 
-func (h *WebSocketHandler) connectToChatService(token string) (*websocket.Conn, error) {
+func (h *WebSocketHandler) connectToChatService(ctx context.Context, token string) (*websocket.Conn, error) {
 	u := url.URL{
 		Scheme:   "ws",
 		Host:     h.getServiceHost(h.config.Services.ChatServiceURL),
 		Path:     "/ws",
 		RawQuery: fmt.Sprintf("token=%s", url.QueryEscape(token)),
 	}
-	conn, _, err := websocket.DefaultDialer.Dial(u.String(), nil)
+	conn, err := dialBackend(ctx, u.String())
 	if err != nil {
 		return nil, fmt.Errorf("dial chat service: %w", err)
 	}
 	return conn, nil
 }
 
-func (h *WebSocketHandler) connectToVoiceService(token string) (*websocket.Conn, error) {
+func (h *WebSocketHandler) connectToVoiceService(ctx context.Context, token string) (*websocket.Conn, error) {
 	u := url.URL{
 		Scheme:   "ws",
 		Host:     h.getServiceHost(h.config.Services.VoiceServiceURL),
 		Path:     "/ws",
 		RawQuery: fmt.Sprintf("token=%s", url.QueryEscape(token)),
 	}
-	conn, _, err := websocket.DefaultDialer.Dial(u.String(), nil)
+	conn, err := dialBackend(ctx, u.String())
 	if err != nil {
 		return nil, fmt.Errorf("dial voice service: %w", err)
 	}
@@ -441,10 +523,14 @@ func (h *WebSocketHandler) getServiceHost(serviceURL string) string {
 	return u.Host
 }
 
+// DisconnectClient закрывает все сессии пользователя.
 func (h *WebSocketHandler) DisconnectClient(login string) {
-	if client, ok := h.clients.LoadAndDelete(login); ok {
-		if c, ok := client.(*Client); ok {
-			c.cleanup()
-		}
+	h.sessionsMu.Lock()
+	sessions := h.sessions[login]
+	delete(h.sessions, login)
+	h.sessionsMu.Unlock()
+
+	for _, c := range sessions {
+		c.cleanup()
 	}
 }
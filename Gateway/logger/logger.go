@@ -0,0 +1,96 @@
+// Gateway/logger/logger.go
+package logger
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"os"
+	"sync"
+)
+
+// HeaderRequestID — заголовок, в котором id запроса ходит между сервисами
+const HeaderRequestID = "X-Request-ID"
+
+// Init делает JSON-логгер slog логгером по умолчанию.
+// Стандартный log после этого тоже пишет через него (уровень INFO).
+func Init(service, level string) {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		lvl = slog.LevelInfo
+	}
+	handler := slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: lvl})
+	slog.SetDefault(slog.New(handler).With("service", service))
+}
+
+type ctxKey struct{}
+
+// fields — поля, которые попадают во все логи одного запроса.
+// Хранится указателем, чтобы обработчик мог дописать user_id и т.п.,
+// а access log в middleware увидел их после завершения запроса.
+type fields struct {
+	mu        sync.Mutex
+	requestID string
+	attrs     []any
+}
+
+// NewContext заводит в ctx поля запроса с указанным request id.
+func NewContext(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, ctxKey{}, &fields{
+		requestID: requestID,
+		attrs:     []any{"request_id", requestID},
+	})
+}
+
+// With добавляет поля (user_id, chat_id, room_id...) к логам текущего запроса.
+func With(ctx context.Context, args ...any) {
+	if f, ok := ctx.Value(ctxKey{}).(*fields); ok {
+		f.mu.Lock()
+		f.attrs = append(f.attrs, args...)
+		f.mu.Unlock()
+	}
+}
+
+// From возвращает логгер с полями запроса из ctx.
+func From(ctx context.Context) *slog.Logger {
+	f, ok := ctx.Value(ctxKey{}).(*fields)
+	if !ok {
+		return slog.Default()
+	}
+	f.mu.Lock()
+	attrs := append([]any(nil), f.attrs...)
+	f.mu.Unlock()
+	return slog.Default().With(attrs...)
+}
+
+// RequestID возвращает id запроса из ctx (пустая строка, если его нет).
+func RequestID(ctx context.Context) string {
+	if f, ok := ctx.Value(ctxKey{}).(*fields); ok {
+		return f.requestID
+	}
+	return ""
+}
+
+// NewRequestID генерирует случайный id запроса.
+func NewRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// ValidRequestID проверяет id, пришедший извне: короткий и без мусора,
+// чтобы его можно было безопасно писать в логи и заголовки.
+func ValidRequestID(id string) bool {
+	if id == "" || len(id) > 64 {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '_', c == '.':
+		default:
+			return false
+		}
+	}
+	return true
+}
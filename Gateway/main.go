@@ -12,10 +12,14 @@ import (
 
 	"Gateway/config"
 	"Gateway/handlers"
+	"Gateway/logger"
+	"Gateway/metrics"
 	"Gateway/middleware"
+	"Gateway/tracing"
 
 	"github.com/gorilla/mux"
 	"github.com/rs/cors"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gorilla/mux/otelmux"
 )
 
 func main() {
@@ -25,12 +29,24 @@ func main() {
 		log.Fatalf("Failed to load config: %v", err)
 	}
 
+	// JSON логи через slog; стандартный log пишет туда же
+	logger.Init("gateway", cfg.LogLevel)
+
+	// Трассировка (OTLP, no-op без endpoint)
+	shutdownTracing, err := tracing.Init(context.Background(), cfg.Tracing)
+	if err != nil {
+		log.Fatalf("Failed to init tracing: %v", err)
+	}
+
 	// Создание роутера
 	r := mux.NewRouter()
 
 	// Регистрация middleware
+	r.Use(otelmux.Middleware(cfg.Tracing.ServiceName))
+	r.Use(middleware.RequestID)
 	r.Use(middleware.Logging)
 	r.Use(middleware.Recovery)
+	r.Use(metrics.Middleware)
 
 	// Создание и регистрация обработчиков
 	gatewayHandler := handlers.NewGatewayHandler(cfg)
@@ -47,6 +63,7 @@ func main() {
 		AllowCredentials: cfg.CORS.AllowCredentials,
 		AllowedMethods:   cfg.CORS.AllowedMethods,
 		AllowedHeaders:   cfg.CORS.AllowedHeaders,
+		ExposedHeaders:   []string{logger.HeaderRequestID},
 	})
 
 	handler := c.Handler(r)
@@ -82,5 +99,9 @@ func main() {
 		log.Fatalf("Server forced to shutdown: %v", err)
 	}
 
+	if err := shutdownTracing(ctx); err != nil {
+		log.Printf("Failed to flush traces: %v", err)
+	}
+
 	log.Println("Server exited")
 }
@@ -0,0 +1,104 @@
+// Gateway/metrics/metrics.go
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "HTTP requests by route, method and status.",
+	}, []string{"route", "method", "status"})
+
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "HTTP request latency by route, method and status.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "method", "status"})
+
+	// UpstreamErrors — ошибки обращения к backend-сервисам (HTTP прокси и WS)
+	UpstreamErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gateway_upstream_errors_total",
+		Help: "Failed requests and connections to backend services.",
+	}, []string{"service"})
+
+	// WSClients — активные WS сессии клиентов
+	WSClients = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "gateway_ws_clients",
+		Help: "Currently connected WebSocket clients.",
+	})
+
+	// WSDroppedFrames — кадры, потерянные из-за переполненных очередей
+	WSDroppedFrames = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gateway_ws_dropped_frames_total",
+		Help: "WebSocket frames dropped because a queue was full.",
+	}, []string{"service"})
+)
+
+// Handler — обработчик /metrics
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// Middleware считает запросы и их длительность по шаблону маршрута mux.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		rec := &statusRecorder{ResponseWriter: w, statusCode: http.StatusOK}
+		next.ServeHTTP(rec, r)
+
+		labels := prometheus.Labels{
+			"route":  routeTemplate(r),
+			"method": r.Method,
+			"status": strconv.Itoa(rec.statusCode),
+		}
+		httpRequests.With(labels).Inc()
+		httpDuration.With(labels).Observe(time.Since(start).Seconds())
+	})
+}
+
+// routeTemplate возвращает шаблон маршрута, чтобы id не раздували кардинальность.
+func routeTemplate(r *http.Request) string {
+	if route := mux.CurrentRoute(r); route != nil {
+		if tpl, err := route.GetPathTemplate(); err == nil {
+			return tpl
+		}
+	}
+	return "unmatched"
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	statusCode int
+}
+
+func (rec *statusRecorder) WriteHeader(code int) {
+	rec.statusCode = code
+	rec.ResponseWriter.WriteHeader(code)
+}
+
+// Hijack нужен для WebSocket
+func (rec *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if hijacker, ok := rec.ResponseWriter.(http.Hijacker); ok {
+		return hijacker.Hijack()
+	}
+	return nil, nil, fmt.Errorf("hijacker not supported")
+}
+
+func (rec *statusRecorder) Flush() {
+	if flusher, ok := rec.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
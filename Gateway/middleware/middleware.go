@@ -4,13 +4,30 @@ package middleware
 import (
 	"bufio"
 	"fmt"
-	"log"
 	"net"
 	"net/http"
 	"runtime/debug"
 	"time"
+
+	"Gateway/logger"
 )
 
+// RequestID берёт X-Request-ID клиента (если он корректный) или генерирует новый.
+// id кладётся в контекст логгера, в заголовок запроса (уходит в сервисы
+// вместе с остальными заголовками) и в ответ.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(logger.HeaderRequestID)
+		if !logger.ValidRequestID(id) {
+			id = logger.NewRequestID()
+		}
+		r.Header.Set(logger.HeaderRequestID, id)
+		w.Header().Set(logger.HeaderRequestID, id)
+
+		next.ServeHTTP(w, r.WithContext(logger.NewContext(r.Context(), id)))
+	})
+}
+
 // Logging middleware
 func Logging(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -23,14 +40,13 @@ func Logging(next http.Handler) http.Handler {
 
 		next.ServeHTTP(lrw, r)
 
-		log.Printf(
-			"[%s] %s %s - Status: %d - Duration: %v - IP: %s",
-			r.Method,
-			r.RequestURI,
-			r.Proto,
-			lrw.statusCode,
-			time.Since(start),
-			r.RemoteAddr,
+		logger.From(r.Context()).Info("http request",
+			"method", r.Method,
+			"uri", r.RequestURI,
+			"proto", r.Proto,
+			"status", lrw.statusCode,
+			"duration_ms", time.Since(start).Milliseconds(),
+			"remote_addr", r.RemoteAddr,
 		)
 	})
 }
@@ -58,7 +74,10 @@ func Recovery(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		defer func() {
 			if err := recover(); err != nil {
-				log.Printf("Panic recovered: %v\n%s", err, debug.Stack())
+				logger.From(r.Context()).Error("panic recovered",
+					"error", fmt.Sprint(err),
+					"stack", string(debug.Stack()),
+				)
 				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 			}
 		}()
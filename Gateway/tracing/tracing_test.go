@@ -0,0 +1,59 @@
+// Gateway/tracing/tracing_test.go
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"Gateway/config"
+
+	"go.opentelemetry.io/otel"
+)
+
+// Локальный "коллектор": принимает OTLP/HTTP экспорт и считает запросы
+func TestInitExportsToCollector(t *testing.T) {
+	var exports atomic.Int32
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost && r.URL.Path == "/v1/traces" {
+			exports.Add(1)
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer collector.Close()
+
+	shutdown, err := Init(context.Background(), config.TracingConfig{
+		Endpoint:    collector.URL + "/v1/traces",
+		ServiceName: "gateway-test",
+		SampleRatio: 1.0,
+	})
+	if err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+
+	_, span := otel.Tracer("test").Start(context.Background(), "test-span")
+	span.End()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+
+	if exports.Load() == 0 {
+		t.Errorf("Expected spans to be exported to collector")
+	}
+}
+
+func TestInitWithoutEndpointIsNoop(t *testing.T) {
+	shutdown, err := Init(context.Background(), config.TracingConfig{ServiceName: "gateway-test"})
+	if err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	if err := shutdown(context.Background()); err != nil {
+		t.Errorf("Expected no-op shutdown, got %v", err)
+	}
+}
@@ -14,6 +14,8 @@ type Config struct {
 	UserService UserServiceConfig
 	ChatService ChatServiceConfig
 	CORS        CORSConfig
+	Tracing     TracingConfig
+	LogLevel    string // LOG_LEVEL: debug, info, warn, error
 }
 
 type ServerConfig struct {
@@ -52,6 +54,14 @@ type ChatServiceConfig struct {
 	Timeout time.Duration
 }
 
+// TracingConfig — экспорт спанов OpenTelemetry.
+// Пустой Endpoint = экспорт выключен, trace context только пробрасывается.
+type TracingConfig struct {
+	Endpoint    string
+	ServiceName string
+	SampleRatio float64
+}
+
 type CORSConfig struct {
 	AllowedOrigins   []string
 	AllowCredentials bool
@@ -99,6 +109,12 @@ func Load() (*Config, error) {
 			AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
 			AllowedHeaders:   []string{"*"},
 		},
+		Tracing: TracingConfig{
+			Endpoint:    getEnv("OTEL_EXPORTER_OTLP_ENDPOINT", ""),
+			ServiceName: getEnv("OTEL_SERVICE_NAME", "auth-service"),
+			SampleRatio: getFloatEnv("OTEL_TRACES_SAMPLE_RATIO", 1.0),
+		},
+		LogLevel: getEnv("LOG_LEVEL", "info"),
 	}, nil
 }
 
@@ -135,3 +151,12 @@ func getDurationEnv(key string, defaultValue time.Duration) time.Duration {
 	}
 	return defaultValue
 }
+
+func getFloatEnv(key string, defaultValue float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		if f, err := strconv.ParseFloat(value, 64); err == nil {
+			return f
+		}
+	}
+	return defaultValue
+}
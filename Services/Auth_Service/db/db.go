@@ -12,7 +12,9 @@ import (
 	"Auth_Service/config"
 	"Auth_Service/models"
 
+	"github.com/XSAM/otelsql"
 	_ "github.com/lib/pq"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
 )
 
 type Database struct {
@@ -25,7 +27,7 @@ func NewDatabase(cfg config.DatabaseConfig) (*Database, error) {
 		cfg.User, cfg.Password, cfg.Host, cfg.Port, cfg.DBName, cfg.SSLMode,
 	)
 
-	db, err := sql.Open("postgres", dsn)
+	db, err := otelsql.Open("postgres", dsn, otelsql.WithAttributes(semconv.DBSystemPostgreSQL))
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
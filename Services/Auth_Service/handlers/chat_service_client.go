@@ -3,11 +3,14 @@ package handlers
 
 import (
 	"Auth_Service/config"
+	"Auth_Service/logger"
 	"context"
 	"fmt"
 	"io"
 	"net/http"
 	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 )
 
 // ChatServiceClient клиент для взаимодействия с Chat Service
@@ -22,11 +25,13 @@ func NewChatServiceClient(cfg config.ChatServiceConfig) *ChatServiceClient {
 		baseURL: cfg.URL,
 		httpClient: &http.Client{
 			Timeout: cfg.Timeout,
-			Transport: &http.Transport{
+			// otelhttp.Transport пробрасывает traceparent входящего запроса,
+			// logger.Transport — X-Request-ID
+			Transport: otelhttp.NewTransport(logger.Transport(&http.Transport{
 				MaxIdleConns:        10,
 				MaxIdleConnsPerHost: 5,
 				IdleConnTimeout:     90 * time.Second,
-			},
+			})),
 		},
 	}
 }
@@ -4,13 +4,13 @@ package handlers
 import (
 	"context"
 	"encoding/json"
-	"log"
 	"net/http"
 	"time"
 
 	"Auth_Service/auth"
 	"Auth_Service/config"
 	"Auth_Service/db"
+	"Auth_Service/logger"
 	"Auth_Service/models"
 
 	"github.com/gorilla/mux"
@@ -60,13 +60,15 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	logger.With(r.Context(), "login", req.Login)
+
 	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
 	defer cancel()
 
 	// Проверка существования пользователя
 	exists, err := h.db.UserExists(ctx, req.Login)
 	if err != nil {
-		log.Printf("Error checking user existence: %v", err)
+		logger.From(ctx).Error("check user existence", "error", err)
 		respondWithError(w, http.StatusInternalServerError, "database_error", "Failed to check user existence")
 		return
 	}
@@ -79,7 +81,7 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 	// Хеширование пароля
 	hashedPassword, err := h.passwordHasher.Hash(req.Password)
 	if err != nil {
-		log.Printf("Error hashing password: %v", err)
+		logger.From(ctx).Error("hash password", "error", err)
 		respondWithError(w, http.StatusInternalServerError, "hash_error", "Failed to process password")
 		return
 	}
@@ -92,18 +94,20 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 
 	userID, err := h.db.CreateUser(ctx, user)
 	if err != nil {
-		log.Printf("Error creating user in database: %v", err)
+		logger.From(ctx).Error("create user", "error", err)
 		respondWithError(w, http.StatusInternalServerError, "database_error", "Failed to create user")
 		return
 	}
 
+	logger.With(ctx, "user_id", userID)
+
 	// Создание профиля пользователя в User Service
 	if err := h.userService.CreateUserProfile(ctx, req.Login); err != nil {
-		log.Printf("Error creating user profile: %v", err)
+		logger.From(ctx).Error("create user profile", "error", err)
 
 		// Откат создания пользователя в auth БД
 		if rollbackErr := h.db.DeleteUser(ctx, req.Login); rollbackErr != nil {
-			log.Printf("CRITICAL: Failed to rollback user creation: %v", rollbackErr)
+			logger.From(ctx).Error("rollback user creation failed", "error", rollbackErr, "critical", true)
 		}
 
 		respondWithError(w, http.StatusInternalServerError, "profile_creation_error", "Failed to create user profile")
@@ -113,7 +117,7 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 	// Генерация JWT токена
 	token, err := h.jwtService.GenerateToken(req.Login, userID, req.Login)
 	if err != nil {
-		log.Printf("Error generating token: %v", err)
+		logger.From(ctx).Error("generate token", "error", err)
 		respondWithError(w, http.StatusInternalServerError, "token_error", "Failed to generate token")
 		return
 	}
@@ -140,6 +144,8 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	logger.With(r.Context(), "login", req.Login)
+
 	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
 
@@ -158,13 +164,15 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 
 	name, err := h.userService.GetUserName(ctx, user.Login)
 	if err != nil {
-		log.Printf("Warning: failed to get user name, using login: %v", err)
+		logger.From(ctx).Warn("get user name failed, using login", "error", err)
 		name = user.Login // fallback
 	}
 
+	logger.With(ctx, "user_id", user.ID)
+
 	token, err := h.jwtService.GenerateToken(user.Login, user.ID, name)
 	if err != nil {
-		log.Printf("Error generating token: %v", err)
+		logger.From(ctx).Error("generate token", "error", err)
 		respondWithError(w, http.StatusInternalServerError, "token_error", "Failed to generate token")
 		return
 	}
@@ -209,6 +217,7 @@ func (h *AuthHandler) ValidateToken(w http.ResponseWriter, r *http.Request) {
 // DeleteUserProfile удаляет профиль пользователя из User Service
 func (h *AuthHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
 	login := mux.Vars(r)["login"]
+	logger.With(r.Context(), "login", login)
 
 	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
 	defer cancel()
@@ -222,12 +231,12 @@ func (h *AuthHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
 
 	// 2. Удалить из User Service
 	if err := h.userService.DeleteUserProfile(ctx, login); err != nil {
-		log.Printf("Warning: failed to delete user profile: %v", err)
+		logger.From(ctx).Warn("delete user profile failed", "error", err)
 	}
 
 	// 3. Удалить из Chat Service по user_id
 	if err := h.chatService.DeleteChatMembersByUserID(ctx, user.ID); err != nil {
-		log.Printf("Warning: failed to delete chat members: %v", err)
+		logger.From(ctx).Warn("delete chat members failed", "error", err)
 	}
 
 	// 4. Удалить из auth БД
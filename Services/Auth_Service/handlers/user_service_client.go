@@ -11,6 +11,9 @@ import (
 	"time"
 
 	"Auth_Service/config"
+	"Auth_Service/logger"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 )
 
 // UserServiceClient клиент для взаимодействия с User Service
@@ -25,11 +28,13 @@ func NewUserServiceClient(cfg config.UserServiceConfig) *UserServiceClient {
 		baseURL: cfg.URL,
 		httpClient: &http.Client{
 			Timeout: cfg.Timeout,
-			Transport: &http.Transport{
+			// otelhttp.Transport пробрасывает traceparent входящего запроса,
+			// logger.Transport — X-Request-ID
+			Transport: otelhttp.NewTransport(logger.Transport(&http.Transport{
 				MaxIdleConns:        10,
 				MaxIdleConnsPerHost: 5,
 				IdleConnTimeout:     90 * time.Second,
-			},
+			})),
 		},
 	}
 }
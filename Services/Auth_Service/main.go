@@ -13,11 +13,15 @@ import (
 	"Auth_Service/config"
 	"Auth_Service/db"
 	"Auth_Service/handlers"
+	"Auth_Service/logger"
+	"Auth_Service/metrics"
 	"Auth_Service/middleware"
+	"Auth_Service/tracing"
 
 	"encoding/json"
 
 	"github.com/gorilla/mux"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gorilla/mux/otelmux"
 )
 
 func main() {
@@ -30,6 +34,15 @@ func main() {
 	data, _ := json.MarshalIndent(cfg.Database, "", "  ")
 	log.Println(string(data))
 
+	// JSON логи через slog; стандартный log пишет туда же
+	logger.Init("auth-service", cfg.LogLevel)
+
+	// Трассировка (OTLP, no-op без endpoint)
+	shutdownTracing, err := tracing.Init(context.Background(), cfg.Tracing)
+	if err != nil {
+		log.Fatalf("Failed to init tracing: %v", err)
+	}
+
 	// Инициализация БД
 	database, err := db.NewDatabase(cfg.Database)
 	if err != nil {
@@ -41,6 +54,7 @@ func main() {
 	if err := database.Migrate(cfg.Database); err != nil {
 		log.Fatalf("Failed to run migrations: %v", err)
 	}
+	metrics.RegisterDBStats(database.GetDB(), cfg.Database.DBName)
 
 	// Создание обработчиков
 	authHandler := handlers.NewAuthHandler(cfg, database)
@@ -49,8 +63,11 @@ func main() {
 	r := mux.NewRouter()
 
 	// Middleware
+	r.Use(otelmux.Middleware(cfg.Tracing.ServiceName))
+	r.Use(middleware.RequestID)
 	r.Use(middleware.Logging)
 	r.Use(middleware.Recovery)
+	r.Use(metrics.Middleware)
 	//r.Use(middleware.CORS(cfg.CORS))
 
 	// Регистрация маршрутов
@@ -59,6 +76,9 @@ func main() {
 	// Health check
 	r.HandleFunc("/api/health", healthCheck).Methods("GET")
 
+	// Prometheus
+	r.Handle("/metrics", metrics.Handler()).Methods("GET")
+
 	// HTTP сервер
 	srv := &http.Server{
 		Addr:         cfg.Server.Address,
@@ -90,6 +110,10 @@ func main() {
 		log.Fatalf("Server forced to shutdown: %v", err)
 	}
 
+	if err := shutdownTracing(ctx); err != nil {
+		log.Printf("Failed to flush traces: %v", err)
+	}
+
 	log.Println("Server exited")
 }
 
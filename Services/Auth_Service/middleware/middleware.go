@@ -2,15 +2,31 @@
 package middleware
 
 import (
-	"log"
+	"fmt"
 	"net/http"
 	"runtime/debug"
 	"time"
 
 	"Auth_Service/config"
+	"Auth_Service/logger"
 )
 
-// Logging middleware для логирования HTTP запросов
+// RequestID берёт X-Request-ID, выставленный Gateway (при прямом обращении
+// генерирует свой), и кладёт его в контекст логгера и в ответ.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(logger.HeaderRequestID)
+		if !logger.ValidRequestID(id) {
+			id = logger.NewRequestID()
+		}
+		w.Header().Set(logger.HeaderRequestID, id)
+
+		ctx := logger.NewContext(r.Context(), id)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// Logging middleware
 func Logging(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
@@ -19,14 +35,12 @@ func Logging(next http.Handler) http.Handler {
 
 		next.ServeHTTP(lrw, r)
 
-		log.Printf(
-			"[%s] %s %s - Status: %d - Duration: %v - IP: %s",
-			r.Method,
-			r.RequestURI,
-			r.Proto,
-			lrw.statusCode,
-			time.Since(start),
-			r.RemoteAddr,
+		logger.From(r.Context()).Info("http request",
+			"method", r.Method,
+			"uri", r.RequestURI,
+			"status", lrw.statusCode,
+			"duration_ms", time.Since(start).Milliseconds(),
+			"remote_addr", r.RemoteAddr,
 		)
 	})
 }
@@ -46,7 +60,10 @@ func Recovery(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		defer func() {
 			if err := recover(); err != nil {
-				log.Printf("Panic recovered: %v\n%s", err, debug.Stack())
+				logger.From(r.Context()).Error("panic recovered",
+					"error", fmt.Sprint(err),
+					"stack", string(debug.Stack()),
+				)
 				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 			}
 		}()
@@ -13,13 +13,43 @@ type Config struct {
 	JWT       JWTConfig
 	WebSocket WebSocketConfig
 	CORS      CORSConfig
+	Tracing   TracingConfig
+	LogLevel  string      // LOG_LEVEL: debug, info, warn, error
 	Media     MediaConfig // ← новое
+	Chats     ChatsConfig
+	Previews  PreviewsConfig
+	Sync      SyncConfig
+}
+
+type ChatsConfig struct {
+	MaxGroupMembers int           // предел участников группы, включая создателя; на каналы не действует
+	EditWindow      time.Duration // сколько после отправки можно править сообщение; 0 — без ограничения
+	MaxEdits        int           // сколько раз можно править одно сообщение; 0 — без ограничения
+	DeleteWindow    time.Duration // сколько после отправки можно удалить сообщение для всех; 0 — без ограничения
+	ScheduleTick    time.Duration // как часто воркер ищет созревшие отложенные сообщения
+	ExpiryTick      time.Duration // как часто удаляются исчезающие сообщения с истёкшим сроком
+}
+
+// PreviewsConfig — загрузка превью ссылок. Workers = 0 выключает превью.
+type PreviewsConfig struct {
+	Workers  int           // сколько превью загружается одновременно
+	Timeout  time.Duration // предел на загрузку одного превью
+	MaxBytes int64         // сколько байт страницы читается
+	CacheTTL time.Duration // сколько хранится результат, в том числе неудачный
+}
+
+// SyncConfig — дельта-синхронизация /api/sync.
+type SyncConfig struct {
+	Retention  time.Duration // сколько живёт токен; журнал изменений хранится чуть дольше
+	MaxChanges int           // больше изменений — клиенту проще загрузить всё заново
 }
 
 type MediaConfig struct {
 	Directory   string
 	MaxFileSize int64
 	BaseURL     string
+	URLSecret   []byte        // ключ подписи ссылок на медиа
+	URLTTL      time.Duration // сколько живёт подписанная ссылка
 }
 
 type ServerConfig struct {
@@ -55,6 +85,14 @@ type WebSocketConfig struct {
 	WriteBufferSize int
 }
 
+// TracingConfig — экспорт спанов OpenTelemetry.
+// Пустой Endpoint = экспорт выключен, trace context только пробрасывается.
+type TracingConfig struct {
+	Endpoint    string
+	ServiceName string
+	SampleRatio float64
+}
+
 type CORSConfig struct {
 	AllowedOrigins   []string
 	AllowCredentials bool
@@ -87,6 +125,8 @@ func Load() (*Config, error) {
 			Directory:   getEnv("MEDIA_DIR", "./Media"),
 			MaxFileSize: 30 * 1024 * 1024, // 30 MB
 			BaseURL:     getEnv("MEDIA_BASE_URL", "https://zvonya.ru/api"),
+			URLSecret:   []byte(getEnv("MEDIA_URL_SECRET", getEnv("JWT_SECRET_KEY", "supersecretkey"))),
+			URLTTL:      getDurationEnv("MEDIA_URL_TTL", time.Hour),
 		},
 		JWT: JWTConfig{
 			SecretKey: []byte(getEnv("JWT_SECRET_KEY", "supersecretkey")),
@@ -105,6 +145,30 @@ func Load() (*Config, error) {
 			AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
 			AllowedHeaders:   []string{"*"},
 		},
+		Tracing: TracingConfig{
+			Endpoint:    getEnv("OTEL_EXPORTER_OTLP_ENDPOINT", ""),
+			ServiceName: getEnv("OTEL_SERVICE_NAME", "chat-service"),
+			SampleRatio: getFloatEnv("OTEL_TRACES_SAMPLE_RATIO", 1.0),
+		},
+		Chats: ChatsConfig{
+			MaxGroupMembers: getIntEnv("MAX_GROUP_MEMBERS", 200),
+			EditWindow:      getDurationEnv("MESSAGE_EDIT_WINDOW", 48*time.Hour),
+			MaxEdits:        getIntEnv("MESSAGE_MAX_EDITS", 20),
+			DeleteWindow:    getDurationEnv("MESSAGE_DELETE_WINDOW", 48*time.Hour),
+			ScheduleTick:    getDurationEnv("SCHEDULED_POLL_INTERVAL", 5*time.Second),
+			ExpiryTick:      getDurationEnv("EXPIRED_SWEEP_INTERVAL", 10*time.Second),
+		},
+		Previews: PreviewsConfig{
+			Workers:  getIntEnv("LINK_PREVIEW_WORKERS", 4),
+			Timeout:  getDurationEnv("LINK_PREVIEW_TIMEOUT", 5*time.Second),
+			MaxBytes: getInt64Env("LINK_PREVIEW_MAX_BYTES", 512*1024),
+			CacheTTL: getDurationEnv("LINK_PREVIEW_CACHE_TTL", 24*time.Hour),
+		},
+		Sync: SyncConfig{
+			Retention:  getDurationEnv("SYNC_RETENTION", 7*24*time.Hour),
+			MaxChanges: getIntEnv("SYNC_MAX_CHANGES", 2000),
+		},
+		LogLevel: getEnv("LOG_LEVEL", "info"),
 	}, nil
 }
 
@@ -141,3 +205,12 @@ func getDurationEnv(key string, defaultValue time.Duration) time.Duration {
 	}
 	return defaultValue
 }
+
+func getFloatEnv(key string, defaultValue float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		if f, err := strconv.ParseFloat(value, 64); err == nil {
+			return f
+		}
+	}
+	return defaultValue
+}
@@ -4,27 +4,15 @@ package db
 
 import (
 	"context"
+	"database/sql"
 	"fmt"
 
 	"Chat_Service/models"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
-// SaveAttachment сохраняет запись о вложении
-func (d *Database) SaveAttachment(ctx context.Context, a models.Attachment) error {
-	_, err := d.db.ExecContext(ctx,
-		`INSERT INTO attachments 
-	(id, message_id, file_name, store_name, mime_type, size, width, height)
-	 VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
-		a.ID, a.MessageID, a.FileName, a.StoreName, a.MimeType, a.Size, a.Width, a.Height,
-	)
-	if err != nil {
-		return fmt.Errorf("failed to save attachment: %w", err)
-	}
-	return nil
-}
-
 // GetAttachmentsByMessageIDs возвращает вложения для набора сообщений
 func (d *Database) GetAttachmentsByMessageIDs(ctx context.Context, messageIDs []string) (map[string][]models.Attachment, error) {
 	if len(messageIDs) == 0 {
@@ -126,6 +114,31 @@ func (d *Database) GetAttachmentByID(ctx context.Context, attachmentID string) (
 	return &a, nil
 }
 
+// MediaInChat проверяет, что файл storeName виден в чате: приложен к сообщению
+// чата, к пересланному в чат сообщению или является аватаром чата.
+func (d *Database) MediaInChat(ctx context.Context, storeName, chatID string) (bool, error) {
+	var exists bool
+	err := d.db.QueryRowContext(ctx,
+		`SELECT EXISTS(
+			SELECT 1 FROM attachments a
+			JOIN messages m ON m.id = a.message_id
+			WHERE a.store_name = $1 AND m.chat_id = $2 AND m.deleted_at IS NULL
+			UNION ALL
+			SELECT 1 FROM attachments a
+			JOIN forwarded_attachments fa ON fa.attachment_id = a.id
+			JOIN messages m ON m.id = fa.message_id
+			WHERE a.store_name = $1 AND m.chat_id = $2 AND m.deleted_at IS NULL
+			UNION ALL
+			SELECT 1 FROM chats WHERE id = $2 AND avatar = $1
+		)`,
+		storeName, chatID,
+	).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("failed to check attachment: %w", err)
+	}
+	return exists, nil
+}
+
 // DeleteAttachmentsByMessageID удаляет все вложения сообщения, возвращает store_name для удаления файлов
 func (d *Database) DeleteAttachmentsByMessageID(ctx context.Context, messageID string) ([]string, error) {
 	rows, err := d.db.QueryContext(ctx,
@@ -148,6 +161,71 @@ func (d *Database) DeleteAttachmentsByMessageID(ctx context.Context, messageID s
 	return storeNames, nil
 }
 
+// releaseAttachments удаляет те из вложений attachmentIDs, на которые больше никто
+// не ссылается: их сообщение удалено или отвязано и пересланных копий не осталось.
+// Вызывается в транзакции, которая только что сняла ссылки. Строки блокируются,
+// чтобы параллельное удаление последней копии не оставило вложение без владельца.
+// Возвращает store_name удалённых — их файлы можно стирать.
+func releaseAttachments(ctx context.Context, tx *sql.Tx, attachmentIDs []string) ([]string, error) {
+	if len(attachmentIDs) == 0 {
+		return nil, nil
+	}
+	if _, err := tx.ExecContext(ctx,
+		`SELECT 1 FROM attachments WHERE id = ANY($1) ORDER BY id FOR UPDATE`,
+		pq.Array(attachmentIDs),
+	); err != nil {
+		return nil, fmt.Errorf("failed to lock attachments: %w", err)
+	}
+
+	rows, err := tx.QueryContext(ctx,
+		`DELETE FROM attachments a
+		 WHERE a.id = ANY($1)
+		   AND NOT EXISTS (SELECT 1 FROM messages m WHERE m.id = a.message_id AND m.deleted_at IS NULL)
+		   AND NOT EXISTS (SELECT 1 FROM forwarded_attachments fa WHERE fa.attachment_id = a.id)
+		 RETURNING a.store_name`,
+		pq.Array(attachmentIDs),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to release attachments: %w", err)
+	}
+	defer rows.Close()
+
+	var storeNames []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		storeNames = append(storeNames, name)
+	}
+	return storeNames, rows.Err()
+}
+
+// collectAttachmentIDs возвращает id вложений, на которые ссылаются сообщения
+// из messageIDs: свои и пересланные.
+func collectAttachmentIDs(ctx context.Context, tx *sql.Tx, messageIDs []string) ([]string, error) {
+	rows, err := tx.QueryContext(ctx,
+		`SELECT id FROM attachments WHERE message_id = ANY($1)
+		 UNION
+		 SELECT attachment_id FROM forwarded_attachments WHERE message_id = ANY($1)`,
+		pq.Array(messageIDs),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get message attachments: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
 func joinStrings(ss []string) string {
 	result := ""
 	for i, s := range ss {
@@ -6,12 +6,13 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
-	"log"
 	"time"
 
+	"Chat_Service/logger"
 	"Chat_Service/models"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
 // FindExistingChat ищет прямой чат между двумя пользователями.
@@ -21,6 +22,7 @@ func (d *Database) FindExistingChat(ctx context.Context, userID1, userID2 int) (
 		FROM chats c
 		JOIN chat_members m1 ON m1.chat_id = c.id AND m1.user_id = $1
 		JOIN chat_members m2 ON m2.chat_id = c.id AND m2.user_id = $2
+		WHERE c.type = 'direct'
 		LIMIT 1
 	`
 
@@ -37,6 +39,7 @@ func (d *Database) FindExistingChat(ctx context.Context, userID1, userID2 int) (
 }
 
 // CreateChat создаёт новый чат и добавляет участников.
+// В группе и канале первый участник (создатель) становится владельцем.
 func (d *Database) CreateChat(ctx context.Context, memberIDs []int, active bool, chatType string, name string) (string, error) {
 	chatID := uuid.NewString()
 
@@ -54,16 +57,28 @@ func (d *Database) CreateChat(ctx context.Context, memberIDs []int, active bool,
 		return "", fmt.Errorf("failed to insert chat: %w", err)
 	}
 
-	for _, userID := range memberIDs {
+	for i, userID := range memberIDs {
+		role := models.RoleMember
+		if chatType != models.ChatTypeDirect && i == 0 {
+			role = models.RoleOwner
+		}
 		_, err = tx.ExecContext(ctx,
-			`INSERT INTO chat_members (chat_id, user_id) VALUES ($1, $2)`,
-			chatID, userID,
+			`INSERT INTO chat_members (chat_id, user_id, role) VALUES ($1, $2, $3)`,
+			chatID, userID, role,
 		)
 		if err != nil {
 			return "", fmt.Errorf("failed to insert member: %w", err)
 		}
 	}
 
+	// История группы начинается с записи о создании
+	if chatType != models.ChatTypeDirect && len(memberIDs) > 0 {
+		payload := models.SystemPayload{Type: models.SystemChatCreated, Name: name, UserIDs: memberIDs[1:]}
+		if _, err := insertSystemMessage(ctx, tx, chatID, memberIDs[0], payload); err != nil {
+			return "", err
+		}
+	}
+
 	if err := tx.Commit(); err != nil {
 		return "", fmt.Errorf("failed to commit transaction: %w", err)
 	}
@@ -88,6 +103,42 @@ func (d *Database) ActivateChat(ctx context.Context, chatID string) (bool, error
 	return activated, nil
 }
 
+// GetChat возвращает параметры чата (без участников).
+func (d *Database) GetChat(ctx context.Context, chatID string) (*models.Chat, error) {
+	var chat models.Chat
+	err := d.db.QueryRowContext(ctx,
+		`SELECT id, active, type, COALESCE(name, ''), COALESCE(avatar, ''), created_at, members_can_pin,
+		        COALESCE(message_ttl, 0)
+		 FROM chats WHERE id = $1`,
+		chatID,
+	).Scan(&chat.ID, &chat.Active, &chat.Type, &chat.Name, &chat.Avatar, &chat.CreatedAt,
+		&chat.Permissions.MembersCanPin, &chat.MessageTTL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get chat: %w", err)
+	}
+	return &chat, nil
+}
+
+// CanPost проверяет, может ли пользователь писать в чат:
+// он должен быть участником, а в канале — ещё и owner/admin.
+func (d *Database) CanPost(ctx context.Context, chatID string, userID int) (bool, error) {
+	var ok bool
+	err := d.db.QueryRowContext(ctx,
+		`SELECT c.type <> 'channel' OR cm.role IN ('owner', 'admin')
+		 FROM chats c
+		 JOIN chat_members cm ON cm.chat_id = c.id AND cm.user_id = $2
+		 WHERE c.id = $1`,
+		chatID, userID,
+	).Scan(&ok)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to check post rights: %w", err)
+	}
+	return ok, nil
+}
+
 // ChatExists проверяет существование чата по id.
 func (d *Database) ChatExists(ctx context.Context, chatID string) (bool, error) {
 	var exists bool
@@ -101,73 +152,224 @@ func (d *Database) ChatExists(ctx context.Context, chatID string) (bool, error)
 	return exists, nil
 }
 
-// GetUserChats возвращает список активных чатов пользователя,
-// отсортированных по дате последнего сообщения.
+// GetUserChats возвращает список активных чатов пользователя: сначала
+// закреплённые, остальные — по дате последнего сообщения.
 func (d *Database) GetUserChats(ctx context.Context, userID int) ([]models.ChatListItem, error) {
+	chats, _, err := d.getUserChats(ctx, userID, nil, time.Time{}, 0, nil)
+	return chats, err
+}
+
+// GetUserChatsPage — список чатов по страницам. Первая (cur == nil) содержит все
+// закреплённые чаты и до limit остальных, следующие — только незакреплённые.
+// Порядок страниц — по последнему сообщению на момент первой страницы (AsOf
+// курсора): чат, в который пишут во время листания, не перескакивает между
+// страницами, а новые сообщения клиент получает по WS. Чат может прийти
+// повторно, только если его последнее сообщение удалили, — клиент склеивает по chatId.
+func (d *Database) GetUserChatsPage(ctx context.Context, userID int, cur *Cursor, limit int) (*models.ChatPage, error) {
+	fetch := limit + 1
+	asOf := time.Now().UTC()
+	if cur == nil {
+		fetch += models.MaxPinnedChats
+	} else if !cur.AsOf.IsZero() {
+		asOf = cur.AsOf
+	}
+	chats, sortAt, err := d.getUserChats(ctx, userID, cur, asOf, fetch, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &models.ChatPage{Chats: []models.ChatListItem{}}
+	unpinned := 0
+	for i, c := range chats {
+		if c.PinnedPosition == nil {
+			if unpinned == limit {
+				last := page.Chats[len(page.Chats)-1]
+				page.NextCursor = Cursor{At: sortAt[i-1], ID: last.ChatID, Before: true, AsOf: asOf}.String()
+				break
+			}
+			unpinned++
+		}
+		page.Chats = append(page.Chats, c)
+	}
+	return page, nil
+}
+
+// getUserChats читает список чатов после курсора (только незакреплённые);
+// limit = 0 — без ограничения, only != nil — только эти чаты.
+// Ненулевой asOf упорядочивает по последнему сообщению не позже asOf
+// (срез для страниц), sortAt — этот ключ для каждого чата.
+func (d *Database) getUserChats(ctx context.Context, userID int, cur *Cursor, asOf time.Time, limit int, only []string) (chats []models.ChatListItem, sortAt []time.Time, err error) {
+	args := []interface{}{userID}
+	sortKey, sortJoin := "COALESCE(m.created_at, c.created_at)", ""
+	if !asOf.IsZero() {
+		args = append(args, asOf)
+		sortKey = "COALESCE(s.created_at, c.created_at)"
+		sortJoin = fmt.Sprintf(`LEFT JOIN LATERAL (
+		SELECT created_at FROM messages sm
+		WHERE chat_id = c.id AND deleted_at IS NULL AND thread_root_id IS NULL
+		AND created_at <= $%d
+		AND NOT EXISTS (
+			SELECT 1 FROM hidden_messages hm
+			WHERE hm.message_id = sm.id AND hm.user_id = $1
+		)
+		ORDER BY created_at DESC, id DESC LIMIT 1
+		) s ON true`, len(args))
+	}
+	position, limitClause := "", ""
+	if cur != nil {
+		args = append(args, cur.At, cur.ID)
+		position = fmt.Sprintf(`AND cm_me.pinned_position IS NULL
+		AND (%s, c.id) < ($%d, $%d)`, sortKey, len(args)-1, len(args))
+	}
+	if only != nil {
+		args = append(args, pq.Array(only))
+		position += fmt.Sprintf(" AND c.id = ANY($%d::uuid[])", len(args))
+	}
+	if limit > 0 {
+		args = append(args, limit)
+		limitClause = fmt.Sprintf("LIMIT $%d", len(args))
+	}
+
 	query := `
 		SELECT
 		c.id,
 		c.type,
 		COALESCE(c.name, '') AS name,
-		array_agg(cm2.user_id) AS members,
+		COALESCE(c.avatar, '') AS avatar,
+		cm_me.role,
+		(SELECT COUNT(*) FROM chat_members cnt WHERE cnt.chat_id = c.id) AS member_count,
+		CASE WHEN c.type = 'direct' THEN ARRAY(
+			SELECT dm.user_id FROM chat_members dm
+			WHERE dm.chat_id = c.id ORDER BY dm.user_id
+		) END AS direct_members,
 		m.id AS last_message_id,
+		m.kind AS last_message_kind,
 		cm_me.last_read_message_id,
 		COALESCE(m.created_at, c.created_at) AS updated_at,
+		` + sortKey + ` AS sort_at,
 		COALESCE((
 			SELECT COUNT(*) FROM messages unread
 			WHERE unread.chat_id = c.id
 			AND unread.sender_id != $1
+			AND unread.kind = 'user'
 			AND unread.deleted_at IS NULL
+			AND unread.thread_root_id IS NULL
+			AND NOT EXISTS (
+				SELECT 1 FROM hidden_messages hm
+				WHERE hm.message_id = unread.id AND hm.user_id = $1
+			)
 			AND (
 				cm_me.last_read_message_id IS NULL
-				OR unread.created_at > (
-					SELECT created_at FROM messages
+				OR (unread.created_at, unread.id) > (
+					SELECT created_at, id FROM messages
 					WHERE id = cm_me.last_read_message_id
 				)
 			)
-		), 0) AS unread_count	
+		), 0) AS unread_count,
+		(
+			SELECT COUNT(*) FROM message_mentions mm
+			JOIN messages mt ON mt.id = mm.message_id
+			WHERE mm.user_id = $1
+			AND mt.chat_id = c.id
+			AND mt.sender_id != $1
+			AND mt.deleted_at IS NULL
+			AND NOT EXISTS (
+				SELECT 1 FROM hidden_messages hm
+				WHERE hm.message_id = mt.id AND hm.user_id = $1
+			)
+			AND CASE WHEN mt.thread_root_id IS NULL THEN (
+				cm_me.last_read_message_id IS NULL
+				OR (mt.created_at, mt.id) > (
+					SELECT created_at, id FROM messages
+					WHERE id = cm_me.last_read_message_id
+				)
+			) ELSE NOT EXISTS (
+				-- упоминание в ветке прочитано вместе с веткой
+				SELECT 1 FROM thread_reads tr
+				WHERE tr.root_id = mt.thread_root_id AND tr.user_id = $1
+				AND tr.last_read_at >= mt.created_at
+			) END
+		) AS unread_mentions,
+		d.text, d.reply_to_id, d.updated_at,
+		CASE WHEN cm_me.muted_until > NOW() THEN cm_me.muted_until END AS muted_until,
+		cm_me.archived_at IS NOT NULL AND (
+			cm_me.archive_permanent OR COALESCE(m.created_at, c.created_at) <= cm_me.archived_at
+		) AS archived,
+		cm_me.archive_permanent,
+		cm_me.pinned_position,
+		cm_me.marked_unread
 		FROM chats c
 		JOIN chat_members cm_me ON cm_me.chat_id = c.id AND cm_me.user_id = $1
-		JOIN chat_members cm2   ON cm2.chat_id = c.id
+		LEFT JOIN chat_drafts d ON d.chat_id = c.id AND d.user_id = $1
 		LEFT JOIN LATERAL (
-		SELECT id, created_at FROM messages
-		WHERE chat_id = c.id AND deleted_at IS NULL
-		ORDER BY created_at DESC LIMIT 1
+		SELECT id, kind, created_at FROM messages lm
+		WHERE chat_id = c.id AND deleted_at IS NULL AND thread_root_id IS NULL
+		AND NOT EXISTS (
+			SELECT 1 FROM hidden_messages hm
+			WHERE hm.message_id = lm.id AND hm.user_id = $1
+		)
+		ORDER BY created_at DESC, id DESC LIMIT 1
 		) m ON true
+		` + sortJoin + `
 		WHERE c.active = true
-		GROUP BY c.id, c.type, c.name, m.id, m.created_at, c.created_at, cm_me.last_read_message_id
-		ORDER BY COALESCE(m.created_at, c.created_at) DESC
-	`
+		` + position + `
+		ORDER BY cm_me.pinned_position ASC NULLS LAST, ` + sortKey + ` DESC, c.id DESC
+		` + limitClause
 
-	rows, err := d.db.QueryContext(ctx, query, userID)
+	rows, err := d.db.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get chats: %w", err)
+		return nil, nil, fmt.Errorf("failed to get chats: %w", err)
 	}
 	defer rows.Close()
 
-	var updatedAt time.Time
-	var chats []models.ChatListItem
+	var updatedAt, itemSortAt time.Time
 	for rows.Next() {
 		var item models.ChatListItem
-		var members pqIntArray
+		var directMembers pq.Int64Array
 		var lastMessageID *string
+		var lastMessageKind sql.NullString
+		var draftText, draftReplyTo sql.NullString
+		var draftAt sql.NullTime
 		var lastReadMessageID *string
+		var mutedUntil sql.NullTime
+		var pinned sql.NullInt64
 
 		if err := rows.Scan(
-			&item.ChatID, &item.Type, &item.Name,
-			&members,
-			&lastMessageID, &lastReadMessageID, &updatedAt, &item.UnreadCount,
+			&item.ChatID, &item.Type, &item.Name, &item.Avatar, &item.Role,
+			&item.MemberCount, &directMembers,
+			&lastMessageID, &lastMessageKind, &lastReadMessageID, &updatedAt, &itemSortAt, &item.UnreadCount, &item.UnreadMentions,
+			&draftText, &draftReplyTo, &draftAt,
+			&mutedUntil, &item.Archived, &item.ArchivePermanent, &pinned, &item.MarkedUnread,
 		); err != nil {
-			log.Printf("scan chat error: %v", err)
-			return nil, fmt.Errorf("failed to scan chat: %w", err)
+			logger.From(ctx).Error("scan chat", "error", err)
+			return nil, nil, fmt.Errorf("failed to scan chat: %w", err)
 		}
 
 		item.LastMessageID = lastMessageID
+		item.LastMessageKind = lastMessageKind.String
 		item.LastReadMessageID = lastReadMessageID
 		item.UpdatedAt = models.UTCTime{Time: updatedAt.UTC()}
-		item.Members = []int(members)
+		item.Members = make([]int, 0, len(directMembers))
+		for _, id := range directMembers {
+			uid := int(id)
+			item.Members = append(item.Members, uid)
+			if uid != userID {
+				item.PeerID = &uid
+			}
+		}
+		if draftAt.Valid {
+			item.Draft = &models.Draft{Text: draftText.String, UpdatedAt: models.UTCTime{Time: draftAt.Time.UTC()}}
+			if draftReplyTo.Valid {
+				item.Draft.ReplyToID = &draftReplyTo.String
+			}
+		}
+		item.ChatSettings = settingsFrom(item.ChatSettings, mutedUntil, pinned)
 		chats = append(chats, item)
+		sortAt = append(sortAt, itemSortAt.UTC())
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("failed to read chats: %w", err)
 	}
 
-	return chats, nil
+	return chats, sortAt, nil
 }
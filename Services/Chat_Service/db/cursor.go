@@ -0,0 +1,107 @@
+// Chat_Service/db/cursor.go
+
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"Chat_Service/models"
+
+	"github.com/google/uuid"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Cursor — позиция в ленте, упорядоченной по (created_at, id): id различает
+// записи с одинаковым временем. Before — страница до позиции (старее), иначе после.
+// AsOf — момент среза для списка чатов (см. GetUserChatsPage), нулевой — без среза.
+// Клиенту отдаётся непрозрачной строкой String().
+type Cursor struct {
+	At     time.Time
+	ID     string
+	Before bool
+	AsOf   time.Time
+}
+
+// String кодирует курсор; время — в микросекундах, как хранит PostgreSQL.
+func (c Cursor) String() string {
+	dir := "a"
+	if c.Before {
+		dir = "b"
+	}
+	raw := dir + strconv.FormatInt(c.At.UnixMicro(), 10) + ":" + c.ID
+	if !c.AsOf.IsZero() {
+		raw += ":" + strconv.FormatInt(c.AsOf.UnixMicro(), 10)
+	}
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// ParseCursor разбирает строку из String(); любая ошибка — ErrInvalidCursor.
+func ParseCursor(s string) (Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(data) < 2 {
+		return Cursor{}, ErrInvalidCursor
+	}
+	var c Cursor
+	switch data[0] {
+	case 'a':
+	case 'b':
+		c.Before = true
+	default:
+		return Cursor{}, ErrInvalidCursor
+	}
+	at, id, ok := strings.Cut(string(data[1:]), ":")
+	if !ok {
+		return Cursor{}, ErrInvalidCursor
+	}
+	micros, err := strconv.ParseInt(at, 10, 64)
+	if err != nil {
+		return Cursor{}, ErrInvalidCursor
+	}
+	id, asOf, hasAsOf := strings.Cut(id, ":")
+	if _, err := uuid.Parse(id); err != nil {
+		return Cursor{}, ErrInvalidCursor
+	}
+	if hasAsOf {
+		asOfMicros, err := strconv.ParseInt(asOf, 10, 64)
+		if err != nil {
+			return Cursor{}, ErrInvalidCursor
+		}
+		c.AsOf = time.UnixMicro(asOfMicros).UTC()
+	}
+	c.At = time.UnixMicro(micros).UTC()
+	c.ID = id
+	return c, nil
+}
+
+// cursorAt возвращает курсор на сообщение чата; ok = false — такого нет.
+func (d *Database) cursorAt(ctx context.Context, chatID, messageID string, before bool) (c Cursor, ok bool, err error) {
+	if _, err := uuid.Parse(messageID); err != nil {
+		return Cursor{}, false, nil
+	}
+	err = d.db.QueryRowContext(ctx,
+		`SELECT created_at, id FROM messages WHERE id = $1 AND chat_id = $2`,
+		messageID, chatID,
+	).Scan(&c.At, &c.ID)
+	if err == sql.ErrNoRows {
+		return Cursor{}, false, nil
+	}
+	if err != nil {
+		return Cursor{}, false, fmt.Errorf("failed to get message position: %w", err)
+	}
+	c.At = c.At.UTC()
+	c.Before = before
+	return c, true, nil
+}
+
+// messageCursor — курсор на соседнюю с msg страницу.
+func messageCursor(msg models.Message, before bool) string {
+	return Cursor{At: msg.CreatedAt.Time, ID: msg.ID, Before: before}.String()
+}
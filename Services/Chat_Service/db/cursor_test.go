@@ -0,0 +1,43 @@
+// Chat_Service/db/cursor_test.go
+package db
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	for _, c := range []Cursor{
+		{At: time.Date(2026, 3, 1, 12, 30, 0, 123456000, time.UTC), ID: "7f1c2e4a-3b5d-4c6e-8f90-a1b2c3d4e5f6", Before: true},
+		{At: time.Date(1999, 12, 31, 23, 59, 59, 0, time.UTC), ID: "00000000-0000-0000-0000-000000000001"},
+		{At: time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC), ID: "00000000-0000-0000-0000-000000000002", Before: true,
+			AsOf: time.Date(2026, 3, 2, 8, 15, 0, 500000000, time.UTC)},
+	} {
+		got, err := ParseCursor(c.String())
+		if err != nil {
+			t.Fatalf("ParseCursor(%q) failed: %v", c.String(), err)
+		}
+		if !got.At.Equal(c.At) || got.ID != c.ID || got.Before != c.Before || !got.AsOf.Equal(c.AsOf) {
+			t.Errorf("Expected %+v, got %+v", c, got)
+		}
+	}
+}
+
+func TestParseCursorRejectsGarbage(t *testing.T) {
+	enc := base64.RawURLEncoding.EncodeToString
+	for _, s := range []string{
+		"",
+		"not base64!",
+		enc([]byte("x123:7f1c2e4a-3b5d-4c6e-8f90-a1b2c3d4e5f6")),
+		enc([]byte("b123")),
+		enc([]byte("bnow:7f1c2e4a-3b5d-4c6e-8f90-a1b2c3d4e5f6")),
+		enc([]byte("b123:'; DROP TABLE messages; --")),
+		enc([]byte("b123:7f1c2e4a-3b5d-4c6e-8f90-a1b2c3d4e5f6:later")),
+	} {
+		if _, err := ParseCursor(s); !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("ParseCursor(%q): expected ErrInvalidCursor, got %v", s, err)
+		}
+	}
+}
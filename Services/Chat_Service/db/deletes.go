@@ -0,0 +1,156 @@
+// Chat_Service/db/deletes.go
+
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"Chat_Service/models"
+)
+
+var ErrDeleteWindowExpired = errors.New("message can no longer be deleted for everyone")
+
+// notHiddenFor — условие на сообщение m: оно не скрыто пользователем из параметра param.
+func notHiddenFor(param string) string {
+	return "NOT EXISTS (SELECT 1 FROM hidden_messages hm WHERE hm.message_id = m.id AND hm.user_id = " + param + ")"
+}
+
+// DeleteMessageForEveryone удаляет сообщение у всех, оставляя «надгробие» с deleted_at:
+// ответы и пересылки продолжают на него ссылаться. Удалить может автор,
+// а в группе или канале — owner/admin; window ограничивает срок (0 — без ограничения).
+// Возвращает store_name вложений, файлы которых больше нигде не нужны, был ли снят закреп
+// и корень ветки, если удалён ответ в ней.
+func (d *Database) DeleteMessageForEveryone(ctx context.Context, chatID, messageID string, actorID int, window time.Duration) (storeNames []string, unpinned bool, threadRootID *string, err error) {
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, false, nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var senderID int
+	var createdAt time.Time
+	var rootID sql.NullString
+	err = tx.QueryRowContext(ctx,
+		`SELECT sender_id, created_at, thread_root_id FROM messages
+		 WHERE id = $1 AND chat_id = $2 AND kind = 'user' AND deleted_at IS NULL
+		 FOR UPDATE`,
+		messageID, chatID,
+	).Scan(&senderID, &createdAt, &rootID)
+	if err == sql.ErrNoRows {
+		return nil, false, nil, ErrMessageNotFound
+	}
+	if err != nil {
+		return nil, false, nil, fmt.Errorf("failed to get message: %w", err)
+	}
+
+	if senderID != actorID {
+		var chatType, role string
+		err := tx.QueryRowContext(ctx,
+			`SELECT c.type, cm.role FROM chats c
+			 JOIN chat_members cm ON cm.chat_id = c.id AND cm.user_id = $2
+			 WHERE c.id = $1`,
+			chatID, actorID,
+		).Scan(&chatType, &role)
+		if err != nil && err != sql.ErrNoRows {
+			return nil, false, nil, fmt.Errorf("failed to check rights: %w", err)
+		}
+		if err == sql.ErrNoRows || chatType == models.ChatTypeDirect || !canManage(role) {
+			return nil, false, nil, ErrNoPermission
+		}
+	}
+
+	now := time.Now().UTC()
+	if window > 0 && now.Sub(createdAt) > window {
+		return nil, false, nil, ErrDeleteWindowExpired
+	}
+
+	// Закреп снимаем явно, чтобы обработчик разослал chat:unpinned
+	res, err := tx.ExecContext(ctx,
+		`DELETE FROM chat_pins WHERE message_id = $1`,
+		messageID,
+	)
+	if err != nil {
+		return nil, false, nil, fmt.Errorf("failed to unpin message: %w", err)
+	}
+	n, _ := res.RowsAffected()
+
+	attachmentIDs, err := collectAttachmentIDs(ctx, tx, []string{messageID})
+	if err != nil {
+		return nil, false, nil, err
+	}
+
+	for _, q := range []string{
+		`DELETE FROM forwarded_attachments WHERE message_id = $1`,
+		`DELETE FROM message_reactions WHERE message_id = $1`,
+		`DELETE FROM message_revisions WHERE message_id = $1`,
+		`DELETE FROM message_mentions WHERE message_id = $1`,
+		`UPDATE messages SET text = '', entities = NULL, link_preview_url = NULL, forwarded_text = NULL, deleted_at = NOW() WHERE id = $1`,
+	} {
+		if _, err := tx.ExecContext(ctx, q, messageID); err != nil {
+			return nil, false, nil, fmt.Errorf("failed to delete message: %w", err)
+		}
+	}
+
+	// Свои вложения, которые уже переслали, остаются жить у пересланных копий;
+	// пересланные уходят, если это была последняя копия, а оригинал удалён
+	storeNames, err = releaseAttachments(ctx, tx, attachmentIDs)
+	if err != nil {
+		return nil, false, nil, err
+	}
+
+	if rootID.Valid {
+		if _, err := tx.ExecContext(ctx,
+			`UPDATE messages SET
+				thread_reply_count = GREATEST(thread_reply_count - 1, 0),
+				thread_last_reply_at = (
+					SELECT MAX(created_at) FROM messages
+					WHERE thread_root_id = $1 AND deleted_at IS NULL
+				)
+			 WHERE id = $1`,
+			rootID.String,
+		); err != nil {
+			return nil, false, nil, fmt.Errorf("failed to update thread root: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, false, nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	if rootID.Valid {
+		threadRootID = &rootID.String
+	}
+	return storeNames, n > 0, threadRootID, nil
+}
+
+// HideMessage скрывает сообщение чата только для userID («удалить у себя»).
+// Повторное скрытие ничего не меняет.
+func (d *Database) HideMessage(ctx context.Context, chatID, messageID string, userID int) error {
+	res, err := d.db.ExecContext(ctx,
+		`INSERT INTO hidden_messages (user_id, message_id)
+		 SELECT $3, id FROM messages WHERE id = $1 AND chat_id = $2
+		 ON CONFLICT DO NOTHING`,
+		messageID, chatID, userID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to hide message: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		return nil
+	}
+
+	var exists bool
+	if err := d.db.QueryRowContext(ctx,
+		`SELECT EXISTS(SELECT 1 FROM messages WHERE id = $1 AND chat_id = $2)`,
+		messageID, chatID,
+	).Scan(&exists); err != nil {
+		return fmt.Errorf("failed to check message: %w", err)
+	}
+	if !exists {
+		return ErrMessageNotFound
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+// Chat_Service/db/drafts.go
+
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"Chat_Service/models"
+
+	"github.com/google/uuid"
+)
+
+// SaveDraft сохраняет черновик участника чата (последняя запись побеждает).
+// ErrNotMember — пользователь не участник, ErrMessageNotFound — нет сообщения для ответа.
+func (d *Database) SaveDraft(ctx context.Context, chatID string, userID int, text string, replyToID *string) (*models.Draft, error) {
+	if replyToID != nil {
+		var exists bool
+		if _, err := uuid.Parse(*replyToID); err != nil {
+			return nil, ErrMessageNotFound
+		}
+		if err := d.db.QueryRowContext(ctx,
+			`SELECT EXISTS(SELECT 1 FROM messages WHERE id = $1 AND chat_id = $2 AND deleted_at IS NULL)`,
+			*replyToID, chatID,
+		).Scan(&exists); err != nil {
+			return nil, fmt.Errorf("failed to check reply target: %w", err)
+		}
+		if !exists {
+			return nil, ErrMessageNotFound
+		}
+	}
+
+	now := time.Now().UTC()
+	err := d.db.QueryRowContext(ctx,
+		`INSERT INTO chat_drafts (chat_id, user_id, text, reply_to_id, updated_at)
+		 SELECT $1, $2, $3, $4, $5
+		 WHERE EXISTS (SELECT 1 FROM chat_members WHERE chat_id = $1 AND user_id = $2)
+		 ON CONFLICT (chat_id, user_id) DO UPDATE
+		 SET text = EXCLUDED.text, reply_to_id = EXCLUDED.reply_to_id, updated_at = EXCLUDED.updated_at
+		 RETURNING updated_at`,
+		chatID, userID, text, replyToID, now,
+	).Scan(&now)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotMember
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to save draft: %w", err)
+	}
+
+	return &models.Draft{Text: text, ReplyToID: replyToID, UpdatedAt: models.UTCTime{Time: now}}, nil
+}
+
+// DeleteDraft удаляет черновик; deleted = false — его и не было.
+func (d *Database) DeleteDraft(ctx context.Context, chatID string, userID int) (deleted bool, err error) {
+	res, err := d.db.ExecContext(ctx,
+		`DELETE FROM chat_drafts WHERE chat_id = $1 AND user_id = $2`,
+		chatID, userID,
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete draft: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
@@ -47,10 +47,14 @@ func (d *Database) forwardOne(ctx context.Context, tx *sql.Tx, toChatID string,
 	var fwdSenderID sql.NullInt64
 	var fwdText, fwdOrigID sql.NullString
 
+	// Переслать можно только из чата, где отправитель состоит
 	err := d.db.QueryRowContext(ctx,
-		`SELECT id, sender_id, text, forwarded_sender_id, forwarded_text, forwarded_from_message_id
-		 FROM messages WHERE id = $1 AND deleted_at IS NULL`,
-		origID,
+		`SELECT m.id, m.sender_id, m.text, m.forwarded_sender_id, m.forwarded_text, m.forwarded_from_message_id
+		 FROM messages m
+		 JOIN chat_members cm ON cm.chat_id = m.chat_id AND cm.user_id = $2
+		 WHERE m.id = $1 AND m.kind = 'user' AND m.deleted_at IS NULL
+		   AND `+notHiddenFor("$2"),
+		origID, senderID,
 	).Scan(&orig.ID, &orig.SenderID, &orig.Text, &fwdSenderID, &fwdText, &fwdOrigID)
 	if err != nil {
 		return nil, fmt.Errorf("original message not found: %w", err)
@@ -69,11 +73,13 @@ func (d *Database) forwardOne(ctx context.Context, tx *sql.Tx, toChatID string,
 	}
 
 	newID := uuid.NewString()
-	_, err = tx.ExecContext(ctx,
-		`INSERT INTO messages (id, chat_id, sender_id, text, forwarded_sender_id, forwarded_text, forwarded_from_message_id, created_at)
-		 VALUES ($1, $2, $3, '', $4, $5, $6, $7)`,
+	var expiresAt sql.NullTime
+	err = tx.QueryRowContext(ctx,
+		`INSERT INTO messages (id, chat_id, sender_id, text, forwarded_sender_id, forwarded_text, forwarded_from_message_id, created_at, expires_at)
+		 VALUES ($1, $2, $3, '', $4, $5, $6, $7, `+expiresAtFor("$2", "$7")+`)
+		 RETURNING expires_at`,
 		newID, toChatID, senderID, snapshotSenderID, snapshotText, snapshotOrigID, now,
-	)
+	).Scan(&expiresAt)
 	if err != nil {
 		return nil, fmt.Errorf("failed to insert forwarded message: %w", err)
 	}
@@ -93,17 +99,22 @@ func (d *Database) forwardOne(ctx context.Context, tx *sql.Tx, toChatID string,
 		}
 	}
 
-	return &models.Message{
+	msg := &models.Message{
 		ID:        newID,
 		ChatID:    toChatID,
 		SenderID:  senderID,
+		Kind:      models.MessageKindUser,
 		CreatedAt: models.UTCTime{Time: now},
 		ForwardedFrom: &models.ForwardedMeta{
 			OriginalMessageID: snapshotOrigID,
 			SenderID:          snapshotSenderID,
 			Text:              snapshotText,
 		},
-	}, nil
+	}
+	if expiresAt.Valid {
+		msg.ExpiresAt = &models.UTCTime{Time: expiresAt.Time.UTC()}
+	}
+	return msg, nil
 }
 
 // resolveAttachmentIDs возвращает id вложений сообщения:
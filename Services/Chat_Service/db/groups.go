@@ -0,0 +1,289 @@
+// Chat_Service/db/groups.go
+
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"Chat_Service/models"
+)
+
+// Ошибки администрирования групп; обработчики переводят их в HTTP статусы.
+var (
+	ErrNotGroup          = errors.New("chat is not a group or channel")
+	ErrNotMember         = errors.New("user is not a member of this chat")
+	ErrNoPermission      = errors.New("not enough rights in this chat")
+	ErrGroupFull         = errors.New("group member limit reached")
+	ErrOwnerMustTransfer = errors.New("owner must transfer ownership before leaving")
+)
+
+// roleRank — старшинство ролей: действовать можно только над младшими.
+var roleRank = map[string]int{
+	models.RoleMember: 0,
+	models.RoleAdmin:  1,
+	models.RoleOwner:  2,
+}
+
+func canManage(role string) bool {
+	return roleRank[role] >= roleRank[models.RoleAdmin]
+}
+
+// lockMember проверяет, что чат — группа или канал, и возвращает роль участника.
+// Строка участника блокируется до конца транзакции.
+func lockMember(ctx context.Context, tx *sql.Tx, chatID string, userID int) (string, error) {
+	var chatType, role string
+	err := tx.QueryRowContext(ctx,
+		`SELECT c.type, cm.role
+		 FROM chats c
+		 JOIN chat_members cm ON cm.chat_id = c.id AND cm.user_id = $2
+		 WHERE c.id = $1
+		 FOR UPDATE OF cm`,
+		chatID, userID,
+	).Scan(&chatType, &role)
+	if err == sql.ErrNoRows {
+		return "", ErrNotMember
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get member role: %w", err)
+	}
+	if chatType == models.ChatTypeDirect {
+		return "", ErrNotGroup
+	}
+	return role, nil
+}
+
+// lockChatMembers блокирует строку чата, чтобы параллельные вступления
+// не превысили лимит, и возвращает тип чата и текущее число участников.
+func lockChatMembers(ctx context.Context, tx *sql.Tx, chatID string) (chatType string, count int, err error) {
+	if err = tx.QueryRowContext(ctx,
+		`SELECT type FROM chats WHERE id = $1 FOR UPDATE`, chatID,
+	).Scan(&chatType); err != nil {
+		return "", 0, fmt.Errorf("failed to lock chat: %w", err)
+	}
+	if err = tx.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM chat_members WHERE chat_id = $1`, chatID,
+	).Scan(&count); err != nil {
+		return "", 0, fmt.Errorf("failed to count members: %w", err)
+	}
+	return chatType, count, nil
+}
+
+// groupTx выполняет действие над группой в транзакции: блокирует участника actorID,
+// передаёт его роль в fn и коммитит вместе с системным сообщением, которое вернул fn.
+func (d *Database) groupTx(ctx context.Context, chatID string, actorID int, fn func(tx *sql.Tx, role string) (*models.SystemPayload, error)) (*models.Message, error) {
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	role, err := lockMember(ctx, tx, chatID, actorID)
+	if err != nil {
+		return nil, err
+	}
+
+	payload, err := fn(tx, role)
+	if err != nil {
+		return nil, err
+	}
+
+	var msg *models.Message
+	if payload != nil {
+		if msg, err = insertSystemMessage(ctx, tx, chatID, actorID, *payload); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return msg, nil
+}
+
+// AddMembers добавляет участников в группу или канал (owner/admin).
+// Уже состоящие пропускаются; если добавлять некого, системное сообщение не пишется.
+// maxMembers ограничивает размер группы; на каналы не действует.
+func (d *Database) AddMembers(ctx context.Context, chatID string, actorID int, userIDs []int, maxMembers int) ([]int, *models.Message, error) {
+	var added []int
+	msg, err := d.groupTx(ctx, chatID, actorID, func(tx *sql.Tx, role string) (*models.SystemPayload, error) {
+		if !canManage(role) {
+			return nil, ErrNoPermission
+		}
+
+		chatType, count, err := lockChatMembers(ctx, tx, chatID)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, uid := range userIDs {
+			res, err := tx.ExecContext(ctx,
+				`INSERT INTO chat_members (chat_id, user_id, role) VALUES ($1, $2, $3)
+				 ON CONFLICT DO NOTHING`,
+				chatID, uid, models.RoleMember,
+			)
+			if err != nil {
+				return nil, fmt.Errorf("failed to add member: %w", err)
+			}
+			if n, _ := res.RowsAffected(); n > 0 {
+				added = append(added, uid)
+			}
+		}
+
+		if chatType == models.ChatTypeGroup && count+len(added) > maxMembers {
+			return nil, ErrGroupFull
+		}
+		if len(added) == 0 {
+			return nil, nil
+		}
+		return &models.SystemPayload{Type: models.SystemMemberAdded, UserIDs: added}, nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return added, msg, nil
+}
+
+// RemoveMember исключает участника. Owner исключает кого угодно, admin — только member.
+func (d *Database) RemoveMember(ctx context.Context, chatID string, actorID, userID int) (*models.Message, error) {
+	return d.groupTx(ctx, chatID, actorID, func(tx *sql.Tx, role string) (*models.SystemPayload, error) {
+		if actorID == userID {
+			return nil, ErrNoPermission // для себя есть LeaveChat
+		}
+		targetRole, err := lockMember(ctx, tx, chatID, userID)
+		if err != nil {
+			return nil, err
+		}
+		if !canManage(role) || roleRank[role] <= roleRank[targetRole] {
+			return nil, ErrNoPermission
+		}
+
+		if _, err := tx.ExecContext(ctx,
+			`DELETE FROM chat_members WHERE chat_id = $1 AND user_id = $2`, chatID, userID,
+		); err != nil {
+			return nil, fmt.Errorf("failed to remove member: %w", err)
+		}
+		return &models.SystemPayload{Type: models.SystemMemberRemoved, UserIDs: []int{userID}}, nil
+	})
+}
+
+// LeaveChat выводит пользователя из группы. Владелец должен сначала передать
+// права, если в группе остаётся кто-то ещё.
+func (d *Database) LeaveChat(ctx context.Context, chatID string, userID int) (*models.Message, error) {
+	return d.groupTx(ctx, chatID, userID, func(tx *sql.Tx, role string) (*models.SystemPayload, error) {
+		if role == models.RoleOwner {
+			var others bool
+			if err := tx.QueryRowContext(ctx,
+				`SELECT EXISTS(SELECT 1 FROM chat_members WHERE chat_id = $1 AND user_id <> $2)`,
+				chatID, userID,
+			).Scan(&others); err != nil {
+				return nil, fmt.Errorf("failed to check members: %w", err)
+			}
+			if others {
+				return nil, ErrOwnerMustTransfer
+			}
+		}
+
+		if _, err := tx.ExecContext(ctx,
+			`DELETE FROM chat_members WHERE chat_id = $1 AND user_id = $2`, chatID, userID,
+		); err != nil {
+			return nil, fmt.Errorf("failed to leave chat: %w", err)
+		}
+		return &models.SystemPayload{Type: models.SystemMemberLeft, UserIDs: []int{userID}}, nil
+	})
+}
+
+// RenameChat меняет название группы (owner/admin).
+func (d *Database) RenameChat(ctx context.Context, chatID string, actorID int, name string) (*models.Message, error) {
+	return d.groupTx(ctx, chatID, actorID, func(tx *sql.Tx, role string) (*models.SystemPayload, error) {
+		if !canManage(role) {
+			return nil, ErrNoPermission
+		}
+		if _, err := tx.ExecContext(ctx,
+			`UPDATE chats SET name = $2 WHERE id = $1`, chatID, name,
+		); err != nil {
+			return nil, fmt.Errorf("failed to rename chat: %w", err)
+		}
+		return &models.SystemPayload{Type: models.SystemChatRenamed, Name: name}, nil
+	})
+}
+
+// SetChatAvatar ставит (или снимает, если avatar пустой) аватар группы (owner/admin).
+// Возвращает store_name прежнего аватара, чтобы удалить файл.
+func (d *Database) SetChatAvatar(ctx context.Context, chatID string, actorID int, avatar string) (string, *models.Message, error) {
+	var old sql.NullString
+	msg, err := d.groupTx(ctx, chatID, actorID, func(tx *sql.Tx, role string) (*models.SystemPayload, error) {
+		if !canManage(role) {
+			return nil, ErrNoPermission
+		}
+		if err := tx.QueryRowContext(ctx,
+			`SELECT avatar FROM chats WHERE id = $1 FOR UPDATE`, chatID,
+		).Scan(&old); err != nil {
+			return nil, fmt.Errorf("failed to get avatar: %w", err)
+		}
+		if _, err := tx.ExecContext(ctx,
+			`UPDATE chats SET avatar = NULLIF($2, '') WHERE id = $1`, chatID, avatar,
+		); err != nil {
+			return nil, fmt.Errorf("failed to set avatar: %w", err)
+		}
+		return &models.SystemPayload{Type: models.SystemAvatarChanged}, nil
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	return old.String, msg, nil
+}
+
+// SetMemberRole назначает или снимает администратора (только owner).
+func (d *Database) SetMemberRole(ctx context.Context, chatID string, actorID, userID int, role string) (*models.Message, error) {
+	return d.groupTx(ctx, chatID, actorID, func(tx *sql.Tx, actorRole string) (*models.SystemPayload, error) {
+		if actorRole != models.RoleOwner || actorID == userID {
+			return nil, ErrNoPermission
+		}
+		current, err := lockMember(ctx, tx, chatID, userID)
+		if err != nil {
+			return nil, err
+		}
+		if current == role {
+			return nil, nil
+		}
+
+		if _, err := tx.ExecContext(ctx,
+			`UPDATE chat_members SET role = $3 WHERE chat_id = $1 AND user_id = $2`,
+			chatID, userID, role,
+		); err != nil {
+			return nil, fmt.Errorf("failed to set role: %w", err)
+		}
+		return &models.SystemPayload{Type: models.SystemRoleChanged, UserIDs: []int{userID}, Role: role}, nil
+	})
+}
+
+// TransferOwnership передаёт владение группой другому участнику;
+// прежний владелец остаётся администратором.
+func (d *Database) TransferOwnership(ctx context.Context, chatID string, actorID, userID int) (*models.Message, error) {
+	return d.groupTx(ctx, chatID, actorID, func(tx *sql.Tx, role string) (*models.SystemPayload, error) {
+		if role != models.RoleOwner || actorID == userID {
+			return nil, ErrNoPermission
+		}
+		if _, err := lockMember(ctx, tx, chatID, userID); err != nil {
+			return nil, err
+		}
+
+		// Сначала понижаем владельца: уникальный индекс допускает одного owner
+		if _, err := tx.ExecContext(ctx,
+			`UPDATE chat_members SET role = $3 WHERE chat_id = $1 AND user_id = $2`,
+			chatID, actorID, models.RoleAdmin,
+		); err != nil {
+			return nil, fmt.Errorf("failed to demote owner: %w", err)
+		}
+		if _, err := tx.ExecContext(ctx,
+			`UPDATE chat_members SET role = $3 WHERE chat_id = $1 AND user_id = $2`,
+			chatID, userID, models.RoleOwner,
+		); err != nil {
+			return nil, fmt.Errorf("failed to promote owner: %w", err)
+		}
+		return &models.SystemPayload{Type: models.SystemOwnerChanged, UserIDs: []int{userID}}, nil
+	})
+}
@@ -0,0 +1,430 @@
+// Chat_Service/db/invites.go
+
+package db
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+
+	"Chat_Service/models"
+)
+
+var (
+	ErrInviteNotFound      = errors.New("invite not found")
+	ErrInviteInvalid       = errors.New("invite is expired, revoked or used up")
+	ErrJoinRequestNotFound = errors.New("join request not found")
+)
+
+// newInviteCode — случайный код ссылки (96 бит, base64url без паддинга).
+func newInviteCode() (string, error) {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate invite code: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// inviteUsable — ссылка не отозвана, не истекла и не исчерпала лимит.
+func inviteUsable(expiresAt sql.NullTime, usageLimit sql.NullInt64, usageCount int, revokedAt sql.NullTime) bool {
+	if revokedAt.Valid {
+		return false
+	}
+	if expiresAt.Valid && !expiresAt.Time.After(time.Now().UTC()) {
+		return false
+	}
+	return !usageLimit.Valid || int64(usageCount) < usageLimit.Int64
+}
+
+// lockedInvite — строка chat_invites, заблокированная до конца транзакции.
+type lockedInvite struct {
+	chatID           string
+	requiresApproval bool
+	usageLimit       sql.NullInt64
+	usageCount       int
+}
+
+// lockInvite блокирует ссылку (FOR UPDATE) и проверяет, что по ней ещё можно вступить.
+func lockInvite(ctx context.Context, tx *sql.Tx, code string) (*lockedInvite, error) {
+	var inv lockedInvite
+	var expiresAt, revokedAt sql.NullTime
+	err := tx.QueryRowContext(ctx,
+		`SELECT chat_id, requires_approval, expires_at, usage_limit, usage_count, revoked_at
+		 FROM chat_invites WHERE code = $1
+		 FOR UPDATE`,
+		code,
+	).Scan(&inv.chatID, &inv.requiresApproval, &expiresAt, &inv.usageLimit, &inv.usageCount, &revokedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrInviteNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get invite: %w", err)
+	}
+	if !inviteUsable(expiresAt, inv.usageLimit, inv.usageCount, revokedAt) {
+		return nil, ErrInviteInvalid
+	}
+	return &inv, nil
+}
+
+// checkManager проверяет, что userID — owner/admin группы или канала.
+func (d *Database) checkManager(ctx context.Context, chatID string, userID int) error {
+	var chatType, role string
+	err := d.db.QueryRowContext(ctx,
+		`SELECT c.type, cm.role
+		 FROM chats c
+		 JOIN chat_members cm ON cm.chat_id = c.id AND cm.user_id = $2
+		 WHERE c.id = $1`,
+		chatID, userID,
+	).Scan(&chatType, &role)
+	if err == sql.ErrNoRows {
+		return ErrNotMember
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get member role: %w", err)
+	}
+	if chatType == models.ChatTypeDirect {
+		return ErrNotGroup
+	}
+	if !canManage(role) {
+		return ErrNoPermission
+	}
+	return nil
+}
+
+// CreateInvite создаёт ссылку-приглашение (owner/admin).
+func (d *Database) CreateInvite(ctx context.Context, chatID string, actorID int, req models.CreateInviteRequest) (*models.ChatInvite, error) {
+	if err := d.checkManager(ctx, chatID, actorID); err != nil {
+		return nil, err
+	}
+
+	code, err := newInviteCode()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	var expiresAt *time.Time
+	if req.ExpiresAt != nil {
+		t := req.ExpiresAt.UTC()
+		expiresAt = &t
+	}
+	_, err = d.db.ExecContext(ctx,
+		`INSERT INTO chat_invites (code, chat_id, created_by, created_at, expires_at, usage_limit, requires_approval)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		code, chatID, actorID, now, expiresAt, req.UsageLimit, req.RequiresApproval,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create invite: %w", err)
+	}
+
+	invite := &models.ChatInvite{
+		Code:             code,
+		ChatID:           chatID,
+		CreatedBy:        actorID,
+		CreatedAt:        models.UTCTime{Time: now},
+		UsageLimit:       req.UsageLimit,
+		RequiresApproval: req.RequiresApproval,
+	}
+	if expiresAt != nil {
+		invite.ExpiresAt = &models.UTCTime{Time: *expiresAt}
+	}
+	return invite, nil
+}
+
+// ListInvites возвращает неотозванные ссылки чата (owner/admin).
+func (d *Database) ListInvites(ctx context.Context, chatID string, actorID int) ([]models.ChatInvite, error) {
+	if err := d.checkManager(ctx, chatID, actorID); err != nil {
+		return nil, err
+	}
+
+	rows, err := d.db.QueryContext(ctx,
+		`SELECT code, created_by, created_at, expires_at, usage_limit, usage_count, requires_approval
+		 FROM chat_invites
+		 WHERE chat_id = $1 AND revoked_at IS NULL
+		 ORDER BY created_at DESC`,
+		chatID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get invites: %w", err)
+	}
+	defer rows.Close()
+
+	invites := []models.ChatInvite{}
+	for rows.Next() {
+		inv := models.ChatInvite{ChatID: chatID}
+		var createdAt time.Time
+		var expiresAt sql.NullTime
+		var usageLimit sql.NullInt64
+		if err := rows.Scan(&inv.Code, &inv.CreatedBy, &createdAt, &expiresAt,
+			&usageLimit, &inv.UsageCount, &inv.RequiresApproval); err != nil {
+			return nil, fmt.Errorf("failed to scan invite: %w", err)
+		}
+		inv.CreatedAt = models.UTCTime{Time: createdAt.UTC()}
+		if expiresAt.Valid {
+			inv.ExpiresAt = &models.UTCTime{Time: expiresAt.Time.UTC()}
+		}
+		if usageLimit.Valid {
+			limit := int(usageLimit.Int64)
+			inv.UsageLimit = &limit
+		}
+		invites = append(invites, inv)
+	}
+	return invites, rows.Err()
+}
+
+// RevokeInvite отзывает ссылку (owner/admin). Поданные по ней заявки остаются,
+// но одобрить их уже нельзя — только отклонить.
+func (d *Database) RevokeInvite(ctx context.Context, chatID string, actorID int, code string) error {
+	if err := d.checkManager(ctx, chatID, actorID); err != nil {
+		return err
+	}
+
+	res, err := d.db.ExecContext(ctx,
+		`UPDATE chat_invites SET revoked_at = NOW()
+		 WHERE code = $1 AND chat_id = $2 AND revoked_at IS NULL`,
+		code, chatID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to revoke invite: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrInviteNotFound
+	}
+	return nil
+}
+
+// GetInvitePreview возвращает сведения о чате по действующей ссылке.
+func (d *Database) GetInvitePreview(ctx context.Context, code string) (*models.InvitePreview, error) {
+	var p models.InvitePreview
+	var expiresAt, revokedAt sql.NullTime
+	var usageLimit sql.NullInt64
+	var usageCount int
+	err := d.db.QueryRowContext(ctx,
+		`SELECT c.id, c.type, COALESCE(c.name, ''), COALESCE(c.avatar, ''),
+		        (SELECT COUNT(*) FROM chat_members WHERE chat_id = c.id),
+		        i.requires_approval, i.expires_at, i.usage_limit, i.usage_count, i.revoked_at
+		 FROM chat_invites i
+		 JOIN chats c ON c.id = i.chat_id
+		 WHERE i.code = $1`,
+		code,
+	).Scan(&p.ChatID, &p.Type, &p.Name, &p.Avatar, &p.MemberCount,
+		&p.RequiresApproval, &expiresAt, &usageLimit, &usageCount, &revokedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrInviteNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get invite: %w", err)
+	}
+	if !inviteUsable(expiresAt, usageLimit, usageCount, revokedAt) {
+		return nil, ErrInviteInvalid
+	}
+	return &p, nil
+}
+
+// JoinByInvite вступает в чат по ссылке. Если ссылка требует одобрения,
+// создаётся заявка (JoinStatusPending); иначе пользователь добавляется
+// и в чат пишется системное сообщение. maxMembers действует только на группы.
+func (d *Database) JoinByInvite(ctx context.Context, code string, userID int, maxMembers int) (*models.JoinResult, error) {
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	inv, err := lockInvite(ctx, tx, code)
+	if err != nil {
+		return nil, err
+	}
+	chatID := inv.chatID
+
+	result := &models.JoinResult{ChatID: chatID}
+
+	var isMember bool
+	if err := tx.QueryRowContext(ctx,
+		`SELECT EXISTS(SELECT 1 FROM chat_members WHERE chat_id = $1 AND user_id = $2)`,
+		chatID, userID,
+	).Scan(&isMember); err != nil {
+		return nil, fmt.Errorf("failed to check membership: %w", err)
+	}
+
+	switch {
+	case isMember:
+		result.Status = models.JoinStatusMember
+
+	case inv.requiresApproval:
+		// Ждущие одобрения заявки тоже занимают лимит ссылки
+		if inv.usageLimit.Valid {
+			var pending int
+			if err := tx.QueryRowContext(ctx,
+				`SELECT COUNT(*) FROM chat_join_requests WHERE invite_code = $1 AND user_id <> $2`,
+				code, userID,
+			).Scan(&pending); err != nil {
+				return nil, fmt.Errorf("failed to count join requests: %w", err)
+			}
+			if int64(inv.usageCount+pending) >= inv.usageLimit.Int64 {
+				return nil, ErrInviteInvalid
+			}
+		}
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO chat_join_requests (chat_id, user_id, invite_code) VALUES ($1, $2, $3)
+			 ON CONFLICT (chat_id, user_id) DO NOTHING`,
+			chatID, userID, code,
+		); err != nil {
+			return nil, fmt.Errorf("failed to create join request: %w", err)
+		}
+		result.Status = models.JoinStatusPending
+
+	default:
+		if err := joinMember(ctx, tx, chatID, userID, code, maxMembers); err != nil {
+			return nil, err
+		}
+		msg, err := insertSystemMessage(ctx, tx, chatID, userID, models.SystemPayload{
+			Type:    models.SystemMemberJoined,
+			UserIDs: []int{userID},
+		})
+		if err != nil {
+			return nil, err
+		}
+		result.Status = models.JoinStatusJoined
+		result.Message = msg
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return result, nil
+}
+
+// joinMember добавляет участника по ссылке code с учётом лимита группы
+// и засчитывает использование ссылки.
+func joinMember(ctx context.Context, tx *sql.Tx, chatID string, userID int, code string, maxMembers int) error {
+	chatType, count, err := lockChatMembers(ctx, tx, chatID)
+	if err != nil {
+		return err
+	}
+	if chatType == models.ChatTypeGroup && count+1 > maxMembers {
+		return ErrGroupFull
+	}
+
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO chat_members (chat_id, user_id, role) VALUES ($1, $2, $3)`,
+		chatID, userID, models.RoleMember,
+	); err != nil {
+		return fmt.Errorf("failed to add member: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE chat_invites SET usage_count = usage_count + 1 WHERE code = $1`, code,
+	); err != nil {
+		return fmt.Errorf("failed to count invite usage: %w", err)
+	}
+	return nil
+}
+
+// ListJoinRequests возвращает заявки на вступление (owner/admin).
+func (d *Database) ListJoinRequests(ctx context.Context, chatID string, actorID int) ([]models.JoinRequest, error) {
+	if err := d.checkManager(ctx, chatID, actorID); err != nil {
+		return nil, err
+	}
+
+	rows, err := d.db.QueryContext(ctx,
+		`SELECT user_id, invite_code, created_at FROM chat_join_requests
+		 WHERE chat_id = $1
+		 ORDER BY created_at`,
+		chatID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get join requests: %w", err)
+	}
+	defer rows.Close()
+
+	requests := []models.JoinRequest{}
+	for rows.Next() {
+		var jr models.JoinRequest
+		var createdAt time.Time
+		if err := rows.Scan(&jr.UserID, &jr.InviteCode, &createdAt); err != nil {
+			return nil, fmt.Errorf("failed to scan join request: %w", err)
+		}
+		jr.CreatedAt = models.UTCTime{Time: createdAt.UTC()}
+		requests = append(requests, jr)
+	}
+	return requests, rows.Err()
+}
+
+// ApproveJoinRequest принимает заявку (owner/admin): пользователь становится
+// участником, а в чат пишется системное сообщение от одобрившего. Ссылка,
+// по которой подана заявка, должна быть ещё действующей.
+func (d *Database) ApproveJoinRequest(ctx context.Context, chatID string, actorID, userID int, maxMembers int) (*models.Message, error) {
+	return d.groupTx(ctx, chatID, actorID, func(tx *sql.Tx, role string) (*models.SystemPayload, error) {
+		if !canManage(role) {
+			return nil, ErrNoPermission
+		}
+
+		var code string
+		err := tx.QueryRowContext(ctx,
+			`DELETE FROM chat_join_requests WHERE chat_id = $1 AND user_id = $2
+			 RETURNING invite_code`,
+			chatID, userID,
+		).Scan(&code)
+		if err == sql.ErrNoRows {
+			return nil, ErrJoinRequestNotFound
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to take join request: %w", err)
+		}
+		// С момента заявки ссылку могли отозвать, она могла истечь или исчерпаться
+		if _, err := lockInvite(ctx, tx, code); err != nil {
+			return nil, err
+		}
+
+		if err := joinMember(ctx, tx, chatID, userID, code, maxMembers); err != nil {
+			return nil, err
+		}
+		return &models.SystemPayload{Type: models.SystemMemberAdded, UserIDs: []int{userID}}, nil
+	})
+}
+
+// DeclineJoinRequest отклоняет заявку (owner/admin).
+func (d *Database) DeclineJoinRequest(ctx context.Context, chatID string, actorID, userID int) error {
+	if err := d.checkManager(ctx, chatID, actorID); err != nil {
+		return err
+	}
+
+	res, err := d.db.ExecContext(ctx,
+		`DELETE FROM chat_join_requests WHERE chat_id = $1 AND user_id = $2`,
+		chatID, userID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to decline join request: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrJoinRequestNotFound
+	}
+	return nil
+}
+
+// GetChatManagers возвращает owner и admin чата — адресатов заявок на вступление.
+func (d *Database) GetChatManagers(ctx context.Context, chatID string) ([]int, error) {
+	rows, err := d.db.QueryContext(ctx,
+		`SELECT user_id FROM chat_members
+		 WHERE chat_id = $1 AND role IN ('owner', 'admin')`,
+		chatID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get managers: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var uid int
+		if err := rows.Scan(&uid); err != nil {
+			return nil, fmt.Errorf("failed to scan manager: %w", err)
+		}
+		ids = append(ids, uid)
+	}
+	return ids, rows.Err()
+}
@@ -5,16 +5,67 @@ package db
 import (
 	"context"
 	"fmt"
+	"time"
+
+	"Chat_Service/models"
 )
 
-// GetChatMembers возвращает список user_id участников чата.
-func (d *Database) GetChatMembers(ctx context.Context, chatID string) ([]int, error) {
+// GetChatMembersPage возвращает страницу участников в порядке вступления
+// и общее их число.
+func (d *Database) GetChatMembersPage(ctx context.Context, chatID string, limit, offset int) ([]models.ChatMember, int, error) {
+	var total int
+	if err := d.db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM chat_members WHERE chat_id = $1`, chatID,
+	).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count members: %w", err)
+	}
+
+	rows, err := d.db.QueryContext(ctx,
+		`SELECT user_id, role, joined_at FROM chat_members
+		 WHERE chat_id = $1
+		 ORDER BY joined_at, user_id
+		 LIMIT $2 OFFSET $3`,
+		chatID, limit, offset,
+	)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get members: %w", err)
+	}
+	defer rows.Close()
+
+	members := make([]models.ChatMember, 0, limit)
+	for rows.Next() {
+		var m models.ChatMember
+		var joinedAt time.Time
+		if err := rows.Scan(&m.UserID, &m.Role, &joinedAt); err != nil {
+			return nil, 0, fmt.Errorf("failed to scan member: %w", err)
+		}
+		m.JoinedAt = models.UTCTime{Time: joinedAt.UTC()}
+		members = append(members, m)
+	}
+	return members, total, rows.Err()
+}
+
+// GetMemberRole возвращает роль участника и число участников чата.
+func (d *Database) GetMemberRole(ctx context.Context, chatID string, userID int) (role string, memberCount int, err error) {
+	err = d.db.QueryRowContext(ctx,
+		`SELECT role, (SELECT COUNT(*) FROM chat_members WHERE chat_id = $1)
+		 FROM chat_members WHERE chat_id = $1 AND user_id = $2`,
+		chatID, userID,
+	).Scan(&role, &memberCount)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to get member role: %w", err)
+	}
+	return role, memberCount, nil
+}
+
+// GetChatMemberIDs возвращает id всех участников чата.
+func (d *Database) GetChatMemberIDs(ctx context.Context, chatID string) ([]int, error) {
 	rows, err := d.db.QueryContext(ctx,
 		`SELECT user_id FROM chat_members WHERE chat_id = $1`,
 		chatID,
 	)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get members: %w", err)
+		return nil, fmt.Errorf("failed to get member ids: %w", err)
 	}
 	defer rows.Close()
 
@@ -26,8 +77,7 @@ func (d *Database) GetChatMembers(ctx context.Context, chatID string) ([]int, er
 		}
 		members = append(members, uid)
 	}
-
-	return members, nil
+	return members, rows.Err()
 }
 
 // IsMember проверяет, является ли пользователь участником чата.
@@ -0,0 +1,114 @@
+// Chat_Service/db/mentions.go
+
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"Chat_Service/models"
+
+	"github.com/lib/pq"
+)
+
+var ErrInvalidMention = errors.New("mentioned user is not a chat member")
+
+// encodeEntities готовит сущности к записи в JSONB; пустые — NULL.
+func encodeEntities(entities []models.Entity) ([]byte, error) {
+	if len(entities) == 0 {
+		return nil, nil
+	}
+	data, err := json.Marshal(entities)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode entities: %w", err)
+	}
+	return data, nil
+}
+
+func decodeEntities(data []byte) ([]models.Entity, error) {
+	if data == nil {
+		return nil, nil
+	}
+	var entities []models.Entity
+	if err := json.Unmarshal(data, &entities); err != nil {
+		return nil, fmt.Errorf("failed to decode entities: %w", err)
+	}
+	return entities, nil
+}
+
+func sameEntities(a, b []models.Entity) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// checkMentions проверяет, что все userIDs (без повторов) — участники чата.
+func checkMentions(ctx context.Context, tx *sql.Tx, chatID string, userIDs []int) error {
+	if len(userIDs) == 0 {
+		return nil
+	}
+	var n int
+	if err := tx.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM chat_members WHERE chat_id = $1 AND user_id = ANY($2)`,
+		chatID, pq.Array(userIDs),
+	).Scan(&n); err != nil {
+		return fmt.Errorf("failed to check mentions: %w", err)
+	}
+	if n != len(userIDs) {
+		return ErrInvalidMention
+	}
+	return nil
+}
+
+// replaceMentions записывает упоминания сообщения взамен прежних
+// и возвращает тех, кого раньше в нём не упоминали.
+func replaceMentions(ctx context.Context, tx *sql.Tx, messageID string, userIDs []int) ([]int, error) {
+	rows, err := tx.QueryContext(ctx,
+		`DELETE FROM message_mentions WHERE message_id = $1 RETURNING user_id`,
+		messageID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to clear mentions: %w", err)
+	}
+	previous := map[int]bool{}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan mention: %w", err)
+		}
+		previous[id] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(userIDs) == 0 {
+		return nil, nil
+	}
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO message_mentions (message_id, user_id)
+		 SELECT $1, unnest($2::int[])`,
+		messageID, pq.Array(userIDs),
+	); err != nil {
+		return nil, fmt.Errorf("failed to save mentions: %w", err)
+	}
+
+	var added []int
+	for _, id := range userIDs {
+		if !previous[id] {
+			added = append(added, id)
+		}
+	}
+	return added, nil
+}
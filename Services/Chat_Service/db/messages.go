@@ -5,117 +5,300 @@ package db
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 
+	"Chat_Service/markup"
 	"Chat_Service/models"
 
 	"github.com/google/uuid"
 )
 
-// SaveMessage сохраняет новое сообщение и возвращает его модель.
-func (d *Database) SaveMessage(ctx context.Context, chatID string, senderID int, text string, replyToID *string) (*models.Message, error) {
+// messageSelect — общий SELECT для scanMessage: сообщение + превью цитаты.
+const messageSelect = `SELECT
+		m.id, m.chat_id, m.sender_id, m.text,
+		m.reply_to_id, m.edited_at, m.deleted_at, m.created_at,
+		r.id, r.sender_id, r.text, r.deleted_at IS NOT NULL,
+		m.forwarded_sender_id, m.forwarded_text, m.forwarded_from_message_id,
+		m.client_message_id, m.kind, m.payload,
+		m.thread_root_id, m.thread_reply_count, m.thread_last_reply_at, m.expires_at,
+		m.entities,
+		lp.url, lp.title, lp.description, lp.image_url, lp.site_name
+	FROM messages m
+	LEFT JOIN messages r ON r.id = m.reply_to_id
+	LEFT JOIN link_previews lp ON lp.url = m.link_preview_url AND lp.ok`
+
+// SaveMessage сохраняет новое сообщение вместе с вложениями и возвращает его модель.
+// Если clientMessageID уже встречался у этого отправителя в этом чате,
+// новая строка не создаётся: возвращается ранее сохранённое сообщение и duplicate = true
+// (до проверок ветки и упоминаний — повтор не должен падать, если они устарели).
+// Сообщение с clientMessageID сохраняется неразосланным, см. MarkMessagePublished.
+// threadRootID != nil — ответ в ветке: у корня растёт счётчик ответов,
+// а ветка у автора ответа считается прочитанной.
+// Упомянуть в entities можно только участников чата (иначе ErrInvalidMention).
+func (d *Database) SaveMessage(ctx context.Context, chatID string, senderID int, text string, entities []models.Entity, replyToID, threadRootID, clientMessageID *string, attachments []models.Attachment) (msg *models.Message, duplicate bool, err error) {
+	if clientMessageID != nil {
+		existing, err := d.GetMessageByClientID(ctx, chatID, senderID, *clientMessageID)
+		if err == nil {
+			return existing, true, nil
+		}
+		if !errors.Is(err, ErrMessageNotFound) {
+			return nil, false, err
+		}
+	}
+
 	messageID := uuid.NewString()
 	now := time.Now().UTC()
+	var expiresAt sql.NullTime
 
-	_, err := d.db.ExecContext(ctx,
-		`INSERT INTO messages (id, chat_id, sender_id, text, reply_to_id, created_at)
-		 VALUES ($1, $2, $3, $4, $5, $6)`,
-		messageID, chatID, senderID, text, replyToID, now,
-	)
+	entitiesJSON, err := encodeEntities(entities)
 	if err != nil {
-		return nil, fmt.Errorf("failed to save message: %w", err)
+		return nil, false, err
 	}
 
-	return &models.Message{
-		ID:        messageID,
-		ChatID:    chatID,
-		SenderID:  senderID,
-		Text:      text,
-		ReplyToID: replyToID,
-		CreatedAt: models.UTCTime{Time: now},
-	}, nil
-}
-
-// EditMessage обновляет текст сообщения. Только автор может редактировать.
-func (d *Database) EditMessage(ctx context.Context, messageID string, senderID int, newText string) error {
-	result, err := d.db.ExecContext(ctx,
-		`UPDATE messages SET text = $1, edited_at = NOW()
-		 WHERE id = $2 AND sender_id = $3 AND deleted_at IS NULL`,
-		newText, messageID, senderID,
-	)
+	tx, err := d.db.BeginTx(ctx, nil)
 	if err != nil {
-		return fmt.Errorf("failed to edit message: %w", err)
+		return nil, false, fmt.Errorf("failed to begin transaction: %w", err)
 	}
-	rows, _ := result.RowsAffected()
-	if rows == 0 {
-		return fmt.Errorf("message not found or not yours")
+	defer tx.Rollback()
+
+	if threadRootID != nil {
+		if err := lockThreadRoot(ctx, tx, chatID, *threadRootID); err != nil {
+			return nil, false, err
+		}
+	}
+	mentions := markup.Mentions(entities)
+	if err := checkMentions(ctx, tx, chatID, mentions); err != nil {
+		return nil, false, err
 	}
-	return nil
-}
 
-// DeleteMessage удаляет сообщение и возвращает store_name вложений для удаления файлов.
-// Только автор может удалить своё сообщение.
-func (d *Database) DeleteMessage(ctx context.Context, messageID string, senderID int) ([]string, error) {
-	var ownerID int
-	err := d.db.QueryRowContext(ctx,
-		`SELECT sender_id FROM messages WHERE id = $1 AND deleted_at IS NULL`,
-		messageID,
-	).Scan(&ownerID)
-	if err == sql.ErrNoRows {
-		return nil, fmt.Errorf("message not found")
+	err = tx.QueryRowContext(ctx,
+		`INSERT INTO messages (id, chat_id, sender_id, text, reply_to_id, thread_root_id, client_message_id, created_at, entities, expires_at)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, `+expiresAtFor("$2", "$8")+`)
+		 ON CONFLICT (chat_id, sender_id, client_message_id) WHERE client_message_id IS NOT NULL
+		 DO NOTHING
+		 RETURNING id, expires_at`,
+		messageID, chatID, senderID, text, replyToID, threadRootID, clientMessageID, now, entitiesJSON,
+	).Scan(&messageID, &expiresAt)
+	// Параллельный повтор успел вставить строку между поиском и INSERT
+	if err == sql.ErrNoRows && clientMessageID != nil {
+		tx.Rollback()
+		existing, err := d.GetMessageByClientID(ctx, chatID, senderID, *clientMessageID)
+		if err != nil {
+			return nil, false, err
+		}
+		return existing, true, nil
 	}
 	if err != nil {
-		return nil, err
+		return nil, false, fmt.Errorf("failed to save message: %w", err)
 	}
-	if ownerID != senderID {
-		return nil, fmt.Errorf("not your message")
+	if _, err := replaceMentions(ctx, tx, messageID, mentions); err != nil {
+		return nil, false, err
+	}
+	if clientMessageID != nil {
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO unpublished_messages (message_id) VALUES ($1)`,
+			messageID,
+		); err != nil {
+			return nil, false, fmt.Errorf("failed to mark message unpublished: %w", err)
+		}
+	}
+	for i := range attachments {
+		a := &attachments[i]
+		a.ID = NewAttachmentID()
+		a.MessageID = messageID
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO attachments (id, message_id, file_name, store_name, mime_type, size, width, height)
+			 VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+			a.ID, a.MessageID, a.FileName, a.StoreName, a.MimeType, a.Size, a.Width, a.Height,
+		); err != nil {
+			return nil, false, fmt.Errorf("failed to save attachment: %w", err)
+		}
+	}
+
+	if threadRootID != nil {
+		if _, err := tx.ExecContext(ctx,
+			`UPDATE messages SET thread_reply_count = thread_reply_count + 1, thread_last_reply_at = $2
+			 WHERE id = $1`,
+			*threadRootID, now,
+		); err != nil {
+			return nil, false, fmt.Errorf("failed to update thread root: %w", err)
+		}
+		if err := markThreadRead(ctx, tx, *threadRootID, senderID, now); err != nil {
+			return nil, false, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, false, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	msg = &models.Message{
+		ID:              messageID,
+		ChatID:          chatID,
+		SenderID:        senderID,
+		Kind:            models.MessageKindUser,
+		Text:            text,
+		Entities:        entities,
+		ReplyToID:       replyToID,
+		ThreadRootID:    threadRootID,
+		ClientMessageID: clientMessageID,
+		Attachments:     attachments,
+		CreatedAt:       models.UTCTime{Time: now},
 	}
+	if expiresAt.Valid {
+		msg.ExpiresAt = &models.UTCTime{Time: expiresAt.Time.UTC()}
+	}
+	return msg, false, nil
+}
 
+// GetMessageByClientID ищет сообщение по клиентскому идентификатору отправителя.
+func (d *Database) GetMessageByClientID(ctx context.Context, chatID string, senderID int, clientMessageID string) (*models.Message, error) {
 	rows, err := d.db.QueryContext(ctx,
-		`SELECT store_name FROM attachments WHERE message_id = $1`,
-		messageID,
+		messageSelect+`
+		WHERE m.chat_id = $1 AND m.sender_id = $2 AND m.client_message_id = $3`,
+		chatID, senderID, clientMessageID,
 	)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("failed to get message by client id: %w", err)
 	}
 	defer rows.Close()
 
-	var storeNames []string
-	for rows.Next() {
-		var s string
-		if err := rows.Scan(&s); err != nil {
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
 			return nil, err
 		}
-		storeNames = append(storeNames, s)
+		return nil, ErrMessageNotFound
 	}
+	msg, err := scanMessage(rows)
+	if err != nil {
+		return nil, err
+	}
+	return &msg, nil
+}
 
-	// attachments каскадно удалятся вместе с сообщением
-	_, err = d.db.ExecContext(ctx,
-		`DELETE FROM messages WHERE id = $1`,
+// MarkMessagePublished отмечает сообщение разосланным.
+// claimed = true, если до этого оно разослано не было: так повтор по
+// clientMessageId узнаёт, что первая попытка не дошла до рассылки.
+func (d *Database) MarkMessagePublished(ctx context.Context, messageID string) (claimed bool, err error) {
+	res, err := d.db.ExecContext(ctx,
+		`DELETE FROM unpublished_messages WHERE message_id = $1`,
 		messageID,
 	)
 	if err != nil {
-		return nil, fmt.Errorf("failed to delete message: %w", err)
+		return false, fmt.Errorf("failed to mark message published: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// EditMessage меняет текст и разметку своего сообщения, сохраняя прежние в message_revisions.
+// window и maxEdits ограничивают срок и число правок (0 — без ограничения).
+// Тот же текст с той же разметкой правкой не считается (changed=false).
+// newMentions — участники, упомянутые впервые этой правкой.
+func (d *Database) EditMessage(ctx context.Context, chatID, messageID string, senderID int, newText string, entities []models.Entity, window time.Duration, maxEdits int) (editedAt time.Time, newMentions []int, changed bool, err error) {
+	entitiesJSON, err := encodeEntities(entities)
+	if err != nil {
+		return time.Time{}, nil, false, err
 	}
 
-	return storeNames, nil
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return time.Time{}, nil, false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var ownerID int
+	var oldText string
+	var oldEntities []byte
+	var createdAt time.Time
+	var prevEditedAt sql.NullTime
+	err = tx.QueryRowContext(ctx,
+		`SELECT sender_id, text, entities, created_at, edited_at FROM messages
+		 WHERE id = $1 AND chat_id = $2 AND kind = 'user' AND deleted_at IS NULL
+		 FOR UPDATE`,
+		messageID, chatID,
+	).Scan(&ownerID, &oldText, &oldEntities, &createdAt, &prevEditedAt)
+	if err == sql.ErrNoRows {
+		return time.Time{}, nil, false, ErrMessageNotFound
+	}
+	if err != nil {
+		return time.Time{}, nil, false, fmt.Errorf("failed to get message: %w", err)
+	}
+	if ownerID != senderID {
+		return time.Time{}, nil, false, ErrNoPermission
+	}
+	if oldText == newText {
+		prev, err := decodeEntities(oldEntities)
+		if err != nil {
+			return time.Time{}, nil, false, err
+		}
+		if sameEntities(prev, entities) {
+			return time.Time{}, nil, false, nil
+		}
+	}
+
+	now := time.Now().UTC()
+	if window > 0 && now.Sub(createdAt) > window {
+		return time.Time{}, nil, false, ErrEditWindowExpired
+	}
+
+	var revisions int
+	if err := tx.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM message_revisions WHERE message_id = $1`,
+		messageID,
+	).Scan(&revisions); err != nil {
+		return time.Time{}, nil, false, fmt.Errorf("failed to count revisions: %w", err)
+	}
+	if maxEdits > 0 && revisions >= maxEdits {
+		return time.Time{}, nil, false, ErrTooManyEdits
+	}
+
+	mentions := markup.Mentions(entities)
+	if err := checkMentions(ctx, tx, chatID, mentions); err != nil {
+		return time.Time{}, nil, false, err
+	}
+
+	writtenAt := createdAt
+	if prevEditedAt.Valid {
+		writtenAt = prevEditedAt.Time
+	}
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO message_revisions (message_id, revision, text, entities, written_at, replaced_at)
+		 VALUES ($1, $2, $3, $4, $5, $6)`,
+		messageID, revisions+1, oldText, oldEntities, writtenAt, now,
+	); err != nil {
+		return time.Time{}, nil, false, fmt.Errorf("failed to save revision: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE messages SET text = $1, entities = $2, edited_at = $3 WHERE id = $4`,
+		newText, entitiesJSON, now, messageID,
+	); err != nil {
+		return time.Time{}, nil, false, fmt.Errorf("failed to edit message: %w", err)
+	}
+	newMentions, err = replaceMentions(ctx, tx, messageID, mentions)
+	if err != nil {
+		return time.Time{}, nil, false, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return time.Time{}, nil, false, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return now, newMentions, true, nil
 }
 
 // GetChatMessages возвращает сообщения чата с пагинацией (новые → старые, потом реверсируются).
-func (d *Database) GetChatMessages(ctx context.Context, chatID string, limit, offset int) ([]models.Message, error) {
+// Ответы в ветках и скрытые зрителем сообщения в основную ленту не входят.
+func (d *Database) GetChatMessages(ctx context.Context, chatID string, viewerID, limit, offset int) ([]models.Message, error) {
 	rows, err := d.db.QueryContext(ctx,
-		`SELECT
-			m.id, m.chat_id, m.sender_id, m.text,
-			m.reply_to_id, m.edited_at, m.deleted_at, m.created_at,
-			r.id, r.sender_id, r.text,
-			m.forwarded_sender_id, m.forwarded_text, m.forwarded_from_message_id
-		FROM messages m
-		LEFT JOIN messages r ON r.id = m.reply_to_id AND r.deleted_at IS NULL
-		WHERE m.chat_id = $1
-		ORDER BY m.created_at DESC
+		messageSelect+`
+		WHERE m.chat_id = $1 AND m.thread_root_id IS NULL AND `+notHiddenFor("$4")+`
+		ORDER BY m.created_at DESC, m.id DESC
 		LIMIT $2 OFFSET $3`,
-		chatID, limit, offset,
+		chatID, limit, offset, viewerID,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get messages: %w", err)
@@ -130,6 +313,9 @@ func (d *Database) GetChatMessages(ctx context.Context, chatID string, limit, of
 		}
 		messages = append(messages, msg)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read messages: %w", err)
+	}
 
 	// Разворачиваем: в БД читали DESC, отдаём хронологически
 	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
@@ -142,18 +328,26 @@ func (d *Database) GetChatMessages(ctx context.Context, chatID string, limit, of
 // scanMessage читает одну строку из запроса GetChatMessages.
 func scanMessage(rows *sql.Rows) (models.Message, error) {
 	var msg models.Message
-	var replyID, rID, fwdOrigID sql.NullString
+	var replyID, rID, fwdOrigID, clientID, threadRootID sql.NullString
 	var rSenderID, fwdSenderID sql.NullInt64
 	var rText, fwdText sql.NullString
+	var lpURL, lpTitle, lpDescription, lpImage, lpSite sql.NullString
+	var rDeleted sql.NullBool
+	var payload, entities []byte
 
 	var createdAt time.Time
-	var editedAt, deletedAt sql.NullTime
+	var editedAt, deletedAt, lastReplyAt, expiresAt sql.NullTime
+	var replyCount int
 
 	if err := rows.Scan(
 		&msg.ID, &msg.ChatID, &msg.SenderID, &msg.Text,
 		&replyID, &editedAt, &deletedAt, &createdAt,
-		&rID, &rSenderID, &rText,
+		&rID, &rSenderID, &rText, &rDeleted,
 		&fwdSenderID, &fwdText, &fwdOrigID,
+		&clientID, &msg.Kind, &payload,
+		&threadRootID, &replyCount, &lastReplyAt, &expiresAt,
+		&entities,
+		&lpURL, &lpTitle, &lpDescription, &lpImage, &lpSite,
 	); err != nil {
 		return msg, fmt.Errorf("failed to scan message: %w", err)
 	}
@@ -163,6 +357,41 @@ func scanMessage(rows *sql.Rows) (models.Message, error) {
 	if replyID.Valid {
 		msg.ReplyToID = &replyID.String
 	}
+	if payload != nil {
+		msg.System = &models.SystemPayload{}
+		if err := json.Unmarshal(payload, msg.System); err != nil {
+			return msg, fmt.Errorf("failed to decode system payload: %w", err)
+		}
+	}
+	decoded, err := decodeEntities(entities)
+	if err != nil {
+		return msg, err
+	}
+	msg.Entities = decoded
+	if lpURL.Valid && !deletedAt.Valid {
+		msg.LinkPreview = &models.LinkPreview{
+			URL:         lpURL.String,
+			Title:       lpTitle.String,
+			Description: lpDescription.String,
+			ImageURL:    lpImage.String,
+			SiteName:    lpSite.String,
+		}
+	}
+	if clientID.Valid {
+		msg.ClientMessageID = &clientID.String
+	}
+	if threadRootID.Valid {
+		msg.ThreadRootID = &threadRootID.String
+	}
+	if expiresAt.Valid {
+		msg.ExpiresAt = &models.UTCTime{Time: expiresAt.Time.UTC()}
+	}
+	if replyCount > 0 {
+		msg.Thread = &models.ThreadInfo{ReplyCount: replyCount}
+		if lastReplyAt.Valid {
+			msg.Thread.LastReplyAt = &models.UTCTime{Time: lastReplyAt.Time.UTC()}
+		}
+	}
 	if editedAt.Valid {
 		t := models.UTCTime{Time: editedAt.Time.UTC()}
 		msg.EditedAt = &t
@@ -171,6 +400,7 @@ func scanMessage(rows *sql.Rows) (models.Message, error) {
 		t := models.UTCTime{Time: deletedAt.Time.UTC()}
 		msg.DeletedAt = &t
 		msg.Text = ""
+		msg.Entities = nil
 		msg.Attachments = nil
 	}
 	if rID.Valid && !deletedAt.Valid {
@@ -178,6 +408,7 @@ func scanMessage(rows *sql.Rows) (models.Message, error) {
 			ID:       rID.String,
 			SenderID: int(rSenderID.Int64),
 			Text:     rText.String,
+			Deleted:  rDeleted.Bool,
 		}
 	}
 	if fwdSenderID.Valid {
@@ -195,70 +426,113 @@ func scanMessage(rows *sql.Rows) (models.Message, error) {
 	return msg, nil
 }
 
-func (d *Database) GetMessagesAfterID(ctx context.Context, chatID, messageID string, limit int) ([]models.Message, error) {
-	rows, err := d.db.QueryContext(ctx,
-		`SELECT
-            m.id, m.chat_id, m.sender_id, m.text,
-            m.reply_to_id, m.edited_at, m.deleted_at, m.created_at,
-            r.id, r.sender_id, r.text,
-            m.forwarded_sender_id, m.forwarded_text, m.forwarded_from_message_id
-        FROM messages m
-        LEFT JOIN messages r ON r.id = m.reply_to_id AND r.deleted_at IS NULL
-        WHERE m.chat_id = $1
-          AND m.created_at > (SELECT created_at FROM messages WHERE id = $2)
-        ORDER BY m.created_at ASC
-        LIMIT $3`,
-		chatID, messageID, limit,
-	)
+// GetMessagesAfterID — сообщения основной ленты после messageID.
+func (d *Database) GetMessagesAfterID(ctx context.Context, chatID string, viewerID int, messageID string, limit int) ([]models.Message, error) {
+	return d.getMessagesFrom(ctx, chatID, viewerID, "", messageID, false, limit)
+}
+
+// GetMessagesBeforeID — сообщения основной ленты до messageID.
+func (d *Database) GetMessagesBeforeID(ctx context.Context, chatID string, viewerID int, messageID string, limit int) ([]models.Message, error) {
+	return d.getMessagesFrom(ctx, chatID, viewerID, "", messageID, true, limit)
+}
+
+// GetMessagesPage возвращает страницу основной ленты от курсора (nil — последние
+// сообщения). NextCursor ведёт к более старым сообщениям, PrevCursor — к более новым.
+func (d *Database) GetMessagesPage(ctx context.Context, chatID string, viewerID int, cur *Cursor, limit int) (*models.MessagePage, error) {
+	from := Cursor{Before: true}
+	if cur != nil {
+		from = *cur
+	}
+	messages, more, err := d.getMessagesPage(ctx, chatID, viewerID, "", from, cur == nil, limit)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get messages after: %w", err)
+		return nil, err
 	}
-	defer rows.Close()
 
-	var messages []models.Message
-	for rows.Next() {
-		msg, err := scanMessage(rows)
-		if err != nil {
-			return nil, err
-		}
-		messages = append(messages, msg)
+	page := &models.MessagePage{Messages: messages}
+	if page.Messages == nil {
+		page.Messages = []models.Message{}
 	}
-	return messages, nil
+	if len(messages) == 0 {
+		return page, nil
+	}
+	// В сторону чтения знаем точно; обратно — страница начата с курсора,
+	// значит за ним что-то было
+	olderMore, newerMore := more, cur != nil
+	if cur != nil && !cur.Before {
+		olderMore, newerMore = true, more
+	}
+	if olderMore {
+		page.NextCursor = messageCursor(messages[0], true)
+	}
+	if newerMore {
+		page.PrevCursor = messageCursor(messages[len(messages)-1], false)
+	}
+	return page, nil
 }
 
-func (d *Database) GetMessagesBeforeID(ctx context.Context, chatID, messageID string, limit int) ([]models.Message, error) {
+// getMessagesFrom — страница до/после messageID; если его нет в чате, пусто.
+func (d *Database) getMessagesFrom(ctx context.Context, chatID string, viewerID int, rootID, messageID string, before bool, limit int) ([]models.Message, error) {
+	cur, ok, err := d.cursorAt(ctx, chatID, messageID, before)
+	if err != nil || !ok {
+		return nil, err
+	}
+	messages, _, err := d.getMessagesPage(ctx, chatID, viewerID, rootID, cur, false, limit)
+	return messages, err
+}
+
+// getMessagesPage возвращает до limit сообщений до/после курсора в хронологическом порядке:
+// из основной ленты (rootID == "") или из ветки rootID, без скрытых зрителем.
+// latest — игнорировать позицию курсора и взять самые новые. more — за страницей есть ещё.
+func (d *Database) getMessagesPage(ctx context.Context, chatID string, viewerID int, rootID string, cur Cursor, latest bool, limit int) (messages []models.Message, more bool, err error) {
+	args := []interface{}{chatID, limit + 1, viewerID}
+	thread := "m.thread_root_id IS NULL"
+	if rootID != "" {
+		args = append(args, rootID)
+		thread = fmt.Sprintf("m.thread_root_id = $%d", len(args))
+	}
+	cmp, order := ">", "ASC"
+	if cur.Before {
+		cmp, order = "<", "DESC"
+	}
+	position := ""
+	if !latest {
+		args = append(args, cur.At, cur.ID)
+		position = fmt.Sprintf("AND (m.created_at, m.id) %s ($%d, $%d)", cmp, len(args)-1, len(args))
+	}
+
 	rows, err := d.db.QueryContext(ctx,
-		`SELECT
-            m.id, m.chat_id, m.sender_id, m.text,
-            m.reply_to_id, m.edited_at, m.deleted_at, m.created_at,
-            r.id, r.sender_id, r.text,
-            m.forwarded_sender_id, m.forwarded_text, m.forwarded_from_message_id
-        FROM messages m
-        LEFT JOIN messages r ON r.id = m.reply_to_id AND r.deleted_at IS NULL
-        WHERE m.chat_id = $1
-          AND m.created_at < (SELECT created_at FROM messages WHERE id = $2)
-        ORDER BY m.created_at DESC
-        LIMIT $3`,
-		chatID, messageID, limit,
+		messageSelect+`
+        WHERE m.chat_id = $1 AND `+thread+` AND `+notHiddenFor("$3")+`
+          `+position+`
+        ORDER BY m.created_at `+order+`, m.id `+order+`
+        LIMIT $2`,
+		args...,
 	)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get messages before: %w", err)
+		return nil, false, fmt.Errorf("failed to get messages page: %w", err)
 	}
 	defer rows.Close()
 
-	var messages []models.Message
 	for rows.Next() {
 		msg, err := scanMessage(rows)
 		if err != nil {
-			return nil, err
+			return nil, false, err
 		}
 		messages = append(messages, msg)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, false, err
+	}
+	if len(messages) > limit {
+		messages, more = messages[:limit], true
+	}
 
-	// разворачиваем — читали DESC, отдаём хронологически
-	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
-		messages[i], messages[j] = messages[j], messages[i]
+	// читали DESC — разворачиваем, отдаём хронологически
+	if cur.Before {
+		for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+			messages[i], messages[j] = messages[j], messages[i]
+		}
 	}
 
-	return messages, nil
+	return messages, more, nil
 }
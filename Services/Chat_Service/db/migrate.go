@@ -74,6 +74,280 @@ func (d *Database) Migrate(cfg config.DatabaseConfig) error {
             attachment_id UUID REFERENCES attachments(id) ON DELETE CASCADE,
             PRIMARY KEY (message_id, attachment_id)
         );`,
+
+		// идемпотентная отправка: клиентский id сообщения
+		`ALTER TABLE messages ADD COLUMN IF NOT EXISTS client_message_id TEXT;`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_messages_client_id
+			ON messages(chat_id, sender_id, client_message_id)
+			WHERE client_message_id IS NOT NULL;`,
+		// сохранённые, но ещё не разосланные: повтор по client_message_id досылает их
+		`CREATE TABLE IF NOT EXISTS unpublished_messages (
+			message_id UUID PRIMARY KEY REFERENCES messages(id) ON DELETE CASCADE
+		);`,
+
+		// системные сообщения: вид сообщения и описание события (models.SystemPayload)
+		`ALTER TABLE messages ADD COLUMN IF NOT EXISTS kind TEXT NOT NULL DEFAULT 'user';`,
+		`ALTER TABLE messages ADD COLUMN IF NOT EXISTS payload JSONB;`,
+
+		// администрирование групп: роли, аватар
+		`ALTER TABLE chat_members ADD COLUMN IF NOT EXISTS role TEXT NOT NULL DEFAULT 'member';`,
+		`ALTER TABLE chats ADD COLUMN IF NOT EXISTS avatar TEXT;`,
+		// у групп, созданных до появления ролей, владельцем становится участник с наименьшим id
+		`UPDATE chat_members cm SET role = 'owner'
+			FROM (
+				SELECT m.chat_id, MIN(m.user_id) AS user_id
+				FROM chat_members m
+				JOIN chats c ON c.id = m.chat_id AND c.type = 'group'
+				GROUP BY m.chat_id
+				HAVING bool_and(m.role <> 'owner')
+			) o
+			WHERE cm.chat_id = o.chat_id AND cm.user_id = o.user_id;`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_chat_members_owner
+			ON chat_members(chat_id) WHERE role = 'owner';`,
+
+		// большие группы и каналы: постраничный список участников
+		`ALTER TABLE chat_members ADD COLUMN IF NOT EXISTS joined_at TIMESTAMP NOT NULL DEFAULT NOW();`,
+
+		// ссылки-приглашения и заявки на вступление
+		`CREATE TABLE IF NOT EXISTS chat_invites (
+			code              TEXT      PRIMARY KEY,
+			chat_id           UUID      NOT NULL REFERENCES chats(id) ON DELETE CASCADE,
+			created_by        INTEGER   NOT NULL,
+			created_at        TIMESTAMP NOT NULL DEFAULT NOW(),
+			expires_at        TIMESTAMP,
+			usage_limit       INTEGER,
+			usage_count       INTEGER   NOT NULL DEFAULT 0,
+			requires_approval BOOLEAN   NOT NULL DEFAULT FALSE,
+			revoked_at        TIMESTAMP
+		);`,
+		`CREATE TABLE IF NOT EXISTS chat_join_requests (
+			chat_id     UUID      NOT NULL REFERENCES chats(id) ON DELETE CASCADE,
+			user_id     INTEGER   NOT NULL,
+			invite_code TEXT      NOT NULL REFERENCES chat_invites(code) ON DELETE CASCADE,
+			created_at  TIMESTAMP NOT NULL DEFAULT NOW(),
+			PRIMARY KEY (chat_id, user_id)
+		);`,
+
+		// реакции на сообщения
+		`CREATE TABLE IF NOT EXISTS message_reactions (
+			message_id UUID      NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+			user_id    INTEGER   NOT NULL,
+			emoji      TEXT      NOT NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			PRIMARY KEY (message_id, user_id, emoji)
+		);`,
+
+		// курсор доставки для статусов ✓/✓✓
+		`ALTER TABLE chat_members ADD COLUMN IF NOT EXISTS last_delivered_message_id UUID
+			REFERENCES messages(id) ON DELETE SET NULL;`,
+
+		// полнотекстовый поиск: конфигурация russian стеммит кириллицу
+		// русским стеммером, а латиницу — английским
+		`ALTER TABLE messages ADD COLUMN IF NOT EXISTS search_tsv tsvector
+			GENERATED ALWAYS AS (to_tsvector('russian'::regconfig, text)) STORED;`,
+
+		// закреплённые сообщения; position растёт с каждым новым закрепом
+		`ALTER TABLE chats ADD COLUMN IF NOT EXISTS members_can_pin BOOLEAN NOT NULL DEFAULT TRUE;`,
+		`CREATE TABLE IF NOT EXISTS chat_pins (
+			chat_id    UUID      NOT NULL REFERENCES chats(id) ON DELETE CASCADE,
+			message_id UUID      NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+			pinned_by  INTEGER   NOT NULL,
+			pinned_at  TIMESTAMP NOT NULL DEFAULT NOW(),
+			position   INTEGER   NOT NULL,
+			PRIMARY KEY (chat_id, message_id)
+		);`,
+
+		// ветки: ответы ссылаются на корень, корень хранит счётчик и время последнего ответа
+		`ALTER TABLE messages ADD COLUMN IF NOT EXISTS thread_root_id UUID
+			REFERENCES messages(id) ON DELETE CASCADE;`,
+		`ALTER TABLE messages ADD COLUMN IF NOT EXISTS thread_reply_count INTEGER NOT NULL DEFAULT 0;`,
+		`ALTER TABLE messages ADD COLUMN IF NOT EXISTS thread_last_reply_at TIMESTAMP;`,
+		`CREATE TABLE IF NOT EXISTS thread_reads (
+			root_id      UUID      NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+			user_id      INTEGER   NOT NULL,
+			last_read_at TIMESTAMP NOT NULL,
+			PRIMARY KEY (root_id, user_id)
+		);`,
+
+		// история правок: прежний текст сообщения до каждой правки
+		`CREATE TABLE IF NOT EXISTS message_revisions (
+			message_id  UUID      NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+			revision    INTEGER   NOT NULL,
+			text        TEXT      NOT NULL,
+			written_at  TIMESTAMP NOT NULL,
+			replaced_at TIMESTAMP NOT NULL,
+			PRIMARY KEY (message_id, revision)
+		);`,
+
+		// «удалить у себя»: сообщения, скрытые отдельным пользователем
+		`CREATE TABLE IF NOT EXISTS hidden_messages (
+			user_id    INTEGER   NOT NULL,
+			message_id UUID      NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+			hidden_at  TIMESTAMP NOT NULL DEFAULT NOW(),
+			PRIMARY KEY (user_id, message_id)
+		);`,
+
+		// исчезающие сообщения: срок жизни в чате и момент удаления у сообщения
+		`ALTER TABLE chats ADD COLUMN IF NOT EXISTS message_ttl INTEGER;`,
+		`ALTER TABLE messages ADD COLUMN IF NOT EXISTS expires_at TIMESTAMP;`,
+
+		// отложенные сообщения; locked_until — аренда воркера, чтобы экземпляры не отправили дважды
+		`CREATE TABLE IF NOT EXISTS scheduled_messages (
+			id              UUID      PRIMARY KEY,
+			chat_id         UUID      NOT NULL REFERENCES chats(id) ON DELETE CASCADE,
+			sender_id       INTEGER   NOT NULL,
+			text            TEXT      NOT NULL DEFAULT '',
+			reply_to_id     UUID,
+			thread_root_id  UUID,
+			send_at         TIMESTAMP NOT NULL,
+			status          TEXT      NOT NULL DEFAULT 'pending',
+			error           TEXT,
+			locked_until    TIMESTAMP,
+			created_at      TIMESTAMP NOT NULL DEFAULT NOW()
+		);`,
+		`CREATE TABLE IF NOT EXISTS scheduled_attachments (
+			id           UUID    PRIMARY KEY,
+			scheduled_id UUID    NOT NULL REFERENCES scheduled_messages(id) ON DELETE CASCADE,
+			position     INTEGER NOT NULL,
+			file_name    TEXT    NOT NULL,
+			store_name   TEXT    NOT NULL,
+			mime_type    TEXT    NOT NULL,
+			size         BIGINT  NOT NULL,
+			width        INTEGER,
+			height       INTEGER
+		);`,
+		`ALTER TABLE scheduled_messages ADD COLUMN IF NOT EXISTS client_message_id TEXT;`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_scheduled_client_id
+			ON scheduled_messages(chat_id, sender_id, client_message_id)
+			WHERE client_message_id IS NOT NULL;`,
+
+		// разметка текста; упоминания — отдельно, для счётчика непрочитанных упоминаний
+		`ALTER TABLE messages ADD COLUMN IF NOT EXISTS entities JSONB;`,
+		`ALTER TABLE message_revisions ADD COLUMN IF NOT EXISTS entities JSONB;`,
+		`CREATE TABLE IF NOT EXISTS message_mentions (
+			message_id UUID    NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+			user_id    INTEGER NOT NULL,
+			PRIMARY KEY (message_id, user_id)
+		);`,
+
+		// кэш превью ссылок; ok = false — загрузить не удалось, до истечения кэша не повторяем
+		`CREATE TABLE IF NOT EXISTS link_previews (
+			url         TEXT      PRIMARY KEY,
+			ok          BOOLEAN   NOT NULL,
+			title       TEXT      NOT NULL DEFAULT '',
+			description TEXT      NOT NULL DEFAULT '',
+			image_url   TEXT      NOT NULL DEFAULT '',
+			site_name   TEXT      NOT NULL DEFAULT '',
+			fetched_at  TIMESTAMP NOT NULL DEFAULT NOW()
+		);`,
+		`ALTER TABLE messages ADD COLUMN IF NOT EXISTS link_preview_url TEXT;`,
+
+		// черновики: по одному на пользователя и чат, общие для всех устройств
+		`CREATE TABLE IF NOT EXISTS chat_drafts (
+			chat_id     UUID      NOT NULL REFERENCES chats(id) ON DELETE CASCADE,
+			user_id     INTEGER   NOT NULL,
+			text        TEXT      NOT NULL DEFAULT '',
+			reply_to_id UUID      REFERENCES messages(id) ON DELETE SET NULL,
+			updated_at  TIMESTAMP NOT NULL DEFAULT NOW(),
+			PRIMARY KEY (chat_id, user_id)
+		);`,
+
+		// личные настройки чата в списке
+		`ALTER TABLE chat_members ADD COLUMN IF NOT EXISTS muted_until TIMESTAMP;`,
+		`ALTER TABLE chat_members ADD COLUMN IF NOT EXISTS archived_at TIMESTAMP;`,
+		`ALTER TABLE chat_members ADD COLUMN IF NOT EXISTS archive_permanent BOOLEAN NOT NULL DEFAULT FALSE;`,
+		`ALTER TABLE chat_members ADD COLUMN IF NOT EXISTS pinned_position INTEGER;`,
+		`ALTER TABLE chat_members ADD COLUMN IF NOT EXISTS marked_unread BOOLEAN NOT NULL DEFAULT FALSE;`,
+
+		// журнал изменений для /api/sync; пишется триггерами, поэтому
+		// покрывает любые записи в эти таблицы. user_id = NULL — изменение
+		// видно всем участникам чата, иначе только этому пользователю
+		`CREATE TABLE IF NOT EXISTS sync_changes (
+			seq        BIGSERIAL PRIMARY KEY,
+			xid        xid8      NOT NULL DEFAULT pg_current_xact_id(),
+			chat_id    UUID      NOT NULL,
+			user_id    INTEGER,
+			entity     TEXT      NOT NULL, -- message, member, chat
+			entity_id  TEXT      NOT NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW()
+		);`,
+
+		`CREATE OR REPLACE FUNCTION sync_track_message() RETURNS trigger AS $$
+		BEGIN
+			IF TG_OP = 'DELETE' THEN
+				INSERT INTO sync_changes (chat_id, entity, entity_id) VALUES (OLD.chat_id, 'message', OLD.id::text);
+				RETURN OLD;
+			END IF;
+			IF TG_OP = 'UPDATE' AND OLD IS NOT DISTINCT FROM NEW THEN
+				RETURN NEW;
+			END IF;
+			INSERT INTO sync_changes (chat_id, entity, entity_id) VALUES (NEW.chat_id, 'message', NEW.id::text);
+			RETURN NEW;
+		END $$ LANGUAGE plpgsql;`,
+		`CREATE OR REPLACE TRIGGER messages_sync AFTER INSERT OR UPDATE OR DELETE ON messages
+			FOR EACH ROW EXECUTE FUNCTION sync_track_message();`,
+
+		// реакции и скрытие меняют сообщение, не трогая его строку
+		`CREATE OR REPLACE FUNCTION sync_track_message_ref() RETURNS trigger AS $$
+		DECLARE
+			ref RECORD;
+		BEGIN
+			IF TG_OP = 'DELETE' THEN ref := OLD; ELSE ref := NEW; END IF;
+			INSERT INTO sync_changes (chat_id, user_id, entity, entity_id)
+			SELECT m.chat_id, CASE WHEN TG_TABLE_NAME = 'hidden_messages' THEN ref.user_id END, 'message', m.id::text
+			FROM messages m WHERE m.id = ref.message_id;
+			RETURN NULL;
+		END $$ LANGUAGE plpgsql;`,
+		`CREATE OR REPLACE TRIGGER message_reactions_sync AFTER INSERT OR DELETE ON message_reactions
+			FOR EACH ROW EXECUTE FUNCTION sync_track_message_ref();`,
+		`CREATE OR REPLACE TRIGGER hidden_messages_sync AFTER INSERT ON hidden_messages
+			FOR EACH ROW EXECUTE FUNCTION sync_track_message_ref();`,
+
+		// состав, роли и курсоры видят все; личные настройки — только сам участник
+		`CREATE OR REPLACE FUNCTION sync_track_member() RETURNS trigger AS $$
+		BEGIN
+			IF TG_OP = 'DELETE' THEN
+				INSERT INTO sync_changes (chat_id, entity, entity_id) VALUES (OLD.chat_id, 'member', OLD.user_id::text);
+				RETURN NULL;
+			END IF;
+			IF TG_OP = 'INSERT' THEN
+				INSERT INTO sync_changes (chat_id, entity, entity_id) VALUES (NEW.chat_id, 'member', NEW.user_id::text);
+				RETURN NULL;
+			END IF;
+			IF (OLD.role, OLD.last_read_message_id, OLD.last_delivered_message_id)
+				IS DISTINCT FROM (NEW.role, NEW.last_read_message_id, NEW.last_delivered_message_id) THEN
+				INSERT INTO sync_changes (chat_id, entity, entity_id) VALUES (NEW.chat_id, 'member', NEW.user_id::text);
+			END IF;
+			IF (OLD.muted_until, OLD.archived_at, OLD.archive_permanent, OLD.pinned_position, OLD.marked_unread)
+				IS DISTINCT FROM (NEW.muted_until, NEW.archived_at, NEW.archive_permanent, NEW.pinned_position, NEW.marked_unread) THEN
+				INSERT INTO sync_changes (chat_id, user_id, entity, entity_id) VALUES (NEW.chat_id, NEW.user_id, 'chat', NEW.chat_id::text);
+			END IF;
+			RETURN NULL;
+		END $$ LANGUAGE plpgsql;`,
+		`CREATE OR REPLACE TRIGGER chat_members_sync AFTER INSERT OR UPDATE OR DELETE ON chat_members
+			FOR EACH ROW EXECUTE FUNCTION sync_track_member();`,
+
+		// удаление чата видно по удалению участников (каскад)
+		`CREATE OR REPLACE FUNCTION sync_track_chat() RETURNS trigger AS $$
+		BEGIN
+			IF OLD IS DISTINCT FROM NEW THEN
+				INSERT INTO sync_changes (chat_id, entity, entity_id) VALUES (NEW.id, 'chat', NEW.id::text);
+			END IF;
+			RETURN NULL;
+		END $$ LANGUAGE plpgsql;`,
+		`CREATE OR REPLACE TRIGGER chats_sync AFTER UPDATE ON chats
+			FOR EACH ROW EXECUTE FUNCTION sync_track_chat();`,
+
+		`CREATE OR REPLACE FUNCTION sync_track_draft() RETURNS trigger AS $$
+		DECLARE
+			ref RECORD;
+		BEGIN
+			IF TG_OP = 'DELETE' THEN ref := OLD; ELSE ref := NEW; END IF;
+			INSERT INTO sync_changes (chat_id, user_id, entity, entity_id) VALUES (ref.chat_id, ref.user_id, 'chat', ref.chat_id::text);
+			RETURN NULL;
+		END $$ LANGUAGE plpgsql;`,
+		`CREATE OR REPLACE TRIGGER chat_drafts_sync AFTER INSERT OR UPDATE OR DELETE ON chat_drafts
+			FOR EACH ROW EXECUTE FUNCTION sync_track_draft();`,
 	}
 
 	for _, q := range queries {
@@ -93,6 +367,24 @@ func (d *Database) Migrate(cfg config.DatabaseConfig) error {
 		`CREATE INDEX IF NOT EXISTS idx_chat_members_user_id ON chat_members(user_id);`,
 		`CREATE INDEX IF NOT EXISTS idx_chat_members_last_read ON chat_members(last_read_message_id);`,
 		`CREATE INDEX IF NOT EXISTS idx_messages_deleted_at ON messages(deleted_at);`,
+		`CREATE INDEX IF NOT EXISTS idx_attachments_store_name ON attachments(store_name);`,
+		`CREATE INDEX IF NOT EXISTS idx_chat_members_joined ON chat_members(chat_id, joined_at, user_id);`,
+		`CREATE INDEX IF NOT EXISTS idx_chat_invites_chat ON chat_invites(chat_id);`,
+		`CREATE INDEX IF NOT EXISTS idx_chat_join_requests_invite ON chat_join_requests(invite_code);`,
+		`CREATE INDEX IF NOT EXISTS idx_messages_search ON messages USING GIN (search_tsv);`,
+		`CREATE INDEX IF NOT EXISTS idx_chat_pins_message ON chat_pins(message_id);`,
+		`CREATE INDEX IF NOT EXISTS idx_messages_thread ON messages(thread_root_id, created_at)
+			WHERE thread_root_id IS NOT NULL;`,
+		`CREATE INDEX IF NOT EXISTS idx_thread_reads_user ON thread_reads(user_id);`,
+		`CREATE INDEX IF NOT EXISTS idx_messages_expires ON messages(expires_at)
+			WHERE expires_at IS NOT NULL;`,
+		`CREATE INDEX IF NOT EXISTS idx_scheduled_due ON scheduled_messages(send_at)
+			WHERE status = 'pending';`,
+		`CREATE INDEX IF NOT EXISTS idx_scheduled_sender ON scheduled_messages(chat_id, sender_id);`,
+		`CREATE INDEX IF NOT EXISTS idx_scheduled_attachments ON scheduled_attachments(scheduled_id);`,
+		`CREATE INDEX IF NOT EXISTS idx_message_mentions_user ON message_mentions(user_id);`,
+		`CREATE INDEX IF NOT EXISTS idx_sync_changes_xid ON sync_changes(xid);`,
+		`CREATE INDEX IF NOT EXISTS idx_sync_changes_created ON sync_changes(created_at);`,
 	}
 
 	for _, idx := range indexes {
@@ -0,0 +1,207 @@
+// Chat_Service/db/pins.go
+
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"Chat_Service/models"
+
+	"github.com/lib/pq"
+)
+
+var ErrTooManyPins = errors.New("pinned messages limit reached")
+
+// lockPinRights проверяет право закреплять в чате и блокирует строку чата,
+// чтобы позиции параллельных закрепов не совпали.
+// В direct закрепляют оба участника, в канале — owner/admin,
+// в группе — owner/admin, а рядовые участники — если это разрешено.
+func lockPinRights(ctx context.Context, tx *sql.Tx, chatID string, userID int) error {
+	var chatType, role string
+	var membersCanPin bool
+	err := tx.QueryRowContext(ctx,
+		`SELECT c.type, c.members_can_pin, cm.role
+		 FROM chats c
+		 JOIN chat_members cm ON cm.chat_id = c.id AND cm.user_id = $2
+		 WHERE c.id = $1
+		 FOR UPDATE OF c`,
+		chatID, userID,
+	).Scan(&chatType, &membersCanPin, &role)
+	if err == sql.ErrNoRows {
+		return ErrNotMember
+	}
+	if err != nil {
+		return fmt.Errorf("failed to check pin rights: %w", err)
+	}
+
+	switch {
+	case chatType == models.ChatTypeDirect, canManage(role):
+		return nil
+	case chatType == models.ChatTypeGroup && membersCanPin:
+		return nil
+	}
+	return ErrNoPermission
+}
+
+// PinMessage закрепляет сообщение поверх остальных закрепов.
+// Повторный закреп ничего не меняет (changed=false).
+func (d *Database) PinMessage(ctx context.Context, chatID, messageID string, userID int) (pin *models.PinnedMessage, changed bool, err error) {
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := lockPinRights(ctx, tx, chatID, userID); err != nil {
+		return nil, false, err
+	}
+
+	var exists bool
+	if err := tx.QueryRowContext(ctx,
+		`SELECT EXISTS(
+			SELECT 1 FROM messages
+			WHERE id = $1 AND chat_id = $2 AND kind = 'user' AND deleted_at IS NULL
+		)`,
+		messageID, chatID,
+	).Scan(&exists); err != nil {
+		return nil, false, fmt.Errorf("failed to check message: %w", err)
+	}
+	if !exists {
+		return nil, false, ErrMessageNotFound
+	}
+
+	var count, maxPosition int
+	if err := tx.QueryRowContext(ctx,
+		`SELECT COUNT(*), COALESCE(MAX(position), 0) FROM chat_pins WHERE chat_id = $1`,
+		chatID,
+	).Scan(&count, &maxPosition); err != nil {
+		return nil, false, fmt.Errorf("failed to count pins: %w", err)
+	}
+
+	pin = &models.PinnedMessage{MessageID: messageID, PinnedBy: userID, Position: maxPosition + 1}
+	now := time.Now().UTC()
+	res, err := tx.ExecContext(ctx,
+		`INSERT INTO chat_pins (chat_id, message_id, pinned_by, pinned_at, position)
+		 VALUES ($1, $2, $3, $4, $5)
+		 ON CONFLICT DO NOTHING`,
+		chatID, messageID, userID, now, pin.Position,
+	)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to pin message: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, false, nil
+	}
+	if count >= models.MaxPinnedMessages {
+		return nil, false, ErrTooManyPins
+	}
+	pin.PinnedAt = models.UTCTime{Time: now}
+
+	if err := tx.Commit(); err != nil {
+		return nil, false, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return pin, true, nil
+}
+
+// UnpinMessage открепляет сообщение. Возвращает false, если оно не было закреплено.
+func (d *Database) UnpinMessage(ctx context.Context, chatID, messageID string, userID int) (bool, error) {
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := lockPinRights(ctx, tx, chatID, userID); err != nil {
+		return false, err
+	}
+
+	res, err := tx.ExecContext(ctx,
+		`DELETE FROM chat_pins WHERE chat_id = $1 AND message_id = $2`,
+		chatID, messageID,
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to unpin message: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// GetPins возвращает закрепы чата вместе с сообщениями, последний закреп — первым.
+func (d *Database) GetPins(ctx context.Context, chatID string) ([]models.PinnedMessage, error) {
+	rows, err := d.db.QueryContext(ctx,
+		`SELECT message_id, pinned_by, pinned_at, position
+		 FROM chat_pins WHERE chat_id = $1
+		 ORDER BY position DESC`,
+		chatID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pins: %w", err)
+	}
+	defer rows.Close()
+
+	pins := []models.PinnedMessage{}
+	var ids []string
+	for rows.Next() {
+		var p models.PinnedMessage
+		var pinnedAt time.Time
+		if err := rows.Scan(&p.MessageID, &p.PinnedBy, &pinnedAt, &p.Position); err != nil {
+			return nil, fmt.Errorf("failed to scan pin: %w", err)
+		}
+		p.PinnedAt = models.UTCTime{Time: pinnedAt.UTC()}
+		pins = append(pins, p)
+		ids = append(ids, p.MessageID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return pins, nil
+	}
+
+	msgRows, err := d.db.QueryContext(ctx,
+		messageSelect+`
+		WHERE m.id = ANY($1) AND m.chat_id = $2`,
+		pq.Array(ids), chatID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pinned messages: %w", err)
+	}
+	defer msgRows.Close()
+
+	byID := make(map[string]*models.Message, len(ids))
+	for msgRows.Next() {
+		msg, err := scanMessage(msgRows)
+		if err != nil {
+			return nil, err
+		}
+		byID[msg.ID] = &msg
+	}
+	for i := range pins {
+		pins[i].Message = byID[pins[i].MessageID]
+	}
+	return pins, msgRows.Err()
+}
+
+// SetChatPermissions меняет права рядовых участников группы (owner/admin).
+func (d *Database) SetChatPermissions(ctx context.Context, chatID string, actorID int, perms models.ChatPermissions) error {
+	if err := d.checkManager(ctx, chatID, actorID); err != nil {
+		return err
+	}
+
+	_, err := d.db.ExecContext(ctx,
+		`UPDATE chats SET members_can_pin = $2 WHERE id = $1`,
+		chatID, perms.MembersCanPin,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update permissions: %w", err)
+	}
+	return nil
+}
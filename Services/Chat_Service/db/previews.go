@@ -0,0 +1,90 @@
+// Chat_Service/db/previews.go
+
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"Chat_Service/models"
+)
+
+// GetLinkPreview ищет превью url в кэше не старше maxAge.
+// found = false — кэша нет или он устарел; preview = nil при found — загрузить не удалось.
+func (d *Database) GetLinkPreview(ctx context.Context, url string, maxAge time.Duration) (preview *models.LinkPreview, found bool, err error) {
+	var ok bool
+	p := models.LinkPreview{URL: url}
+	err = d.db.QueryRowContext(ctx,
+		`SELECT ok, title, description, image_url, site_name FROM link_previews
+		 WHERE url = $1 AND fetched_at > $2`,
+		url, time.Now().UTC().Add(-maxAge),
+	).Scan(&ok, &p.Title, &p.Description, &p.ImageURL, &p.SiteName)
+	if err == sql.ErrNoRows {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to get link preview: %w", err)
+	}
+	if !ok {
+		return nil, true, nil
+	}
+	return &p, true, nil
+}
+
+// SaveLinkPreview кладёт результат загрузки в кэш; preview = nil — загрузка не удалась.
+func (d *Database) SaveLinkPreview(ctx context.Context, url string, preview *models.LinkPreview) error {
+	p := models.LinkPreview{}
+	if preview != nil {
+		p = *preview
+	}
+	_, err := d.db.ExecContext(ctx,
+		`INSERT INTO link_previews (url, ok, title, description, image_url, site_name, fetched_at)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7)
+		 ON CONFLICT (url) DO UPDATE SET
+			ok = EXCLUDED.ok, title = EXCLUDED.title, description = EXCLUDED.description,
+			image_url = EXCLUDED.image_url, site_name = EXCLUDED.site_name, fetched_at = EXCLUDED.fetched_at`,
+		url, preview != nil, p.Title, p.Description, p.ImageURL, p.SiteName, time.Now().UTC(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save link preview: %w", err)
+	}
+	return nil
+}
+
+// SetMessageLinkPreview запоминает, для какой ссылки сообщению нужно превью ("" — ни для какой).
+// changed = false — сообщение удалено или ссылка та же.
+func (d *Database) SetMessageLinkPreview(ctx context.Context, chatID, messageID, url string) (changed bool, err error) {
+	res, err := d.db.ExecContext(ctx,
+		`UPDATE messages SET link_preview_url = NULLIF($3, '')
+		 WHERE id = $1 AND chat_id = $2 AND deleted_at IS NULL
+		   AND link_preview_url IS DISTINCT FROM NULLIF($3, '')`,
+		messageID, chatID, url,
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to set link preview: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// MessageWantsLinkPreview — сообщение не удалено и по-прежнему ждёт превью url
+// (правка могла заменить ссылку, пока оно загружалось).
+func (d *Database) MessageWantsLinkPreview(ctx context.Context, messageID, url string) (bool, error) {
+	var wants bool
+	err := d.db.QueryRowContext(ctx,
+		`SELECT EXISTS(
+			SELECT 1 FROM messages
+			WHERE id = $1 AND link_preview_url = $2 AND deleted_at IS NULL
+		)`,
+		messageID, url,
+	).Scan(&wants)
+	if err != nil {
+		return false, fmt.Errorf("failed to check link preview: %w", err)
+	}
+	return wants, nil
+}
@@ -0,0 +1,117 @@
+// Chat_Service/db/reactions.go
+
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"Chat_Service/models"
+
+	"github.com/lib/pq"
+)
+
+var ErrMessageNotFound = errors.New("message not found")
+
+// SetReaction ставит (add=true) или снимает реакцию пользователя на сообщение чата.
+// Возвращает, изменилось ли что-то, и новое число таких реакций на сообщении.
+// Реагировать можно только на неудалённые пользовательские сообщения.
+func (d *Database) SetReaction(ctx context.Context, chatID, messageID string, userID int, emoji string, add bool) (changed bool, count int, err error) {
+	var exists bool
+	if err := d.db.QueryRowContext(ctx,
+		`SELECT EXISTS(
+			SELECT 1 FROM messages
+			WHERE id = $1 AND chat_id = $2 AND kind = 'user' AND deleted_at IS NULL
+		)`,
+		messageID, chatID,
+	).Scan(&exists); err != nil {
+		return false, 0, fmt.Errorf("failed to check message: %w", err)
+	}
+	if !exists {
+		return false, 0, ErrMessageNotFound
+	}
+
+	query := `INSERT INTO message_reactions (message_id, user_id, emoji) VALUES ($1, $2, $3)
+		ON CONFLICT DO NOTHING`
+	if !add {
+		query = `DELETE FROM message_reactions WHERE message_id = $1 AND user_id = $2 AND emoji = $3`
+	}
+	res, err := d.db.ExecContext(ctx, query, messageID, userID, emoji)
+	if err != nil {
+		return false, 0, fmt.Errorf("failed to update reaction: %w", err)
+	}
+	n, _ := res.RowsAffected()
+
+	if err := d.db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM message_reactions WHERE message_id = $1 AND emoji = $2`,
+		messageID, emoji,
+	).Scan(&count); err != nil {
+		return false, 0, fmt.Errorf("failed to count reactions: %w", err)
+	}
+	return n > 0, count, nil
+}
+
+// GetReactionsByMessageIDs возвращает сводку реакций по сообщениям
+// в порядке первой реакции каждым эмодзи; ReactedByMe — для userID.
+func (d *Database) GetReactionsByMessageIDs(ctx context.Context, messageIDs []string, userID int) (map[string][]models.Reaction, error) {
+	result := make(map[string][]models.Reaction)
+	if len(messageIDs) == 0 {
+		return result, nil
+	}
+
+	rows, err := d.db.QueryContext(ctx,
+		`SELECT message_id, emoji, COUNT(*), bool_or(user_id = $2)
+		 FROM message_reactions
+		 WHERE message_id = ANY($1)
+		 GROUP BY message_id, emoji
+		 ORDER BY message_id, MIN(created_at)`,
+		pq.Array(messageIDs), userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get reactions: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var messageID string
+		var r models.Reaction
+		if err := rows.Scan(&messageID, &r.Emoji, &r.Count, &r.ReactedByMe); err != nil {
+			return nil, fmt.Errorf("failed to scan reaction: %w", err)
+		}
+		result[messageID] = append(result[messageID], r)
+	}
+	return result, rows.Err()
+}
+
+// GetReactionUsers возвращает, кто и чем отреагировал на сообщение чата
+// (emoji != "" — только этой реакцией), новые первыми.
+func (d *Database) GetReactionUsers(ctx context.Context, chatID, messageID, emoji string, limit, offset int) ([]models.ReactionUser, error) {
+	rows, err := d.db.QueryContext(ctx,
+		`SELECT r.user_id, r.emoji, r.created_at
+		 FROM message_reactions r
+		 JOIN messages m ON m.id = r.message_id
+		 WHERE r.message_id = $1 AND m.chat_id = $2
+		   AND ($3 = '' OR r.emoji = $3)
+		 ORDER BY r.created_at DESC, r.user_id
+		 LIMIT $4 OFFSET $5`,
+		messageID, chatID, emoji, limit, offset,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get reaction users: %w", err)
+	}
+	defer rows.Close()
+
+	users := []models.ReactionUser{}
+	for rows.Next() {
+		var u models.ReactionUser
+		var createdAt time.Time
+		if err := rows.Scan(&u.UserID, &u.Emoji, &createdAt); err != nil {
+			return nil, fmt.Errorf("failed to scan reaction user: %w", err)
+		}
+		u.CreatedAt = models.UTCTime{Time: createdAt.UTC()}
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
@@ -12,51 +12,167 @@ import (
 )
 
 // MarkChatRead обновляет курсор последнего прочитанного сообщения для пользователя.
-func (d *Database) MarkChatRead(ctx context.Context, chatID string, userID int, lastMessageID string) error {
-	_, err := d.db.ExecContext(ctx,
-		`UPDATE chat_members SET last_read_message_id = $1
-         WHERE chat_id = $2 AND user_id = $3
+// Прочитанное считается и доставленным. Возвращает true, если курсор сдвинулся.
+// Курсоры сравниваются по (created_at, id), как и страницы сообщений.
+func (d *Database) MarkChatRead(ctx context.Context, chatID string, userID int, lastMessageID string) (bool, error) {
+	res, err := d.db.ExecContext(ctx,
+		`UPDATE chat_members cm SET
+             last_read_message_id = nm.id,
+             last_delivered_message_id = CASE
+                 WHEN cm.last_delivered_message_id IS NULL
+                   OR (nm.created_at, nm.id) >
+                      (SELECT created_at, id FROM messages WHERE id = cm.last_delivered_message_id)
+                 THEN nm.id ELSE cm.last_delivered_message_id END
+         FROM messages nm
+         WHERE nm.id = $1 AND nm.chat_id = $2
+           AND cm.chat_id = $2 AND cm.user_id = $3
            AND (
-               last_read_message_id IS NULL
-               OR (
-                   SELECT created_at FROM messages WHERE id = $1
-               ) > (
-                   SELECT created_at FROM messages WHERE id = last_read_message_id
-               )
+               cm.last_read_message_id IS NULL
+               OR (nm.created_at, nm.id) >
+                  (SELECT created_at, id FROM messages WHERE id = cm.last_read_message_id)
            )`,
 		lastMessageID, chatID, userID,
 	)
-	return err
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// MarkChatDelivered сдвигает курсор доставленных сообщений вперёд.
+// Возвращает true, если курсор сдвинулся.
+func (d *Database) MarkChatDelivered(ctx context.Context, chatID string, userID int, lastMessageID string) (bool, error) {
+	res, err := d.db.ExecContext(ctx,
+		`UPDATE chat_members cm SET last_delivered_message_id = nm.id
+         FROM messages nm
+         WHERE nm.id = $1 AND nm.chat_id = $2
+           AND cm.chat_id = $2 AND cm.user_id = $3
+           AND (
+               cm.last_delivered_message_id IS NULL
+               OR (nm.created_at, nm.id) >
+                  (SELECT created_at, id FROM messages WHERE id = cm.last_delivered_message_id)
+           )`,
+		lastMessageID, chatID, userID,
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to mark delivered: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// GetReadCursors возвращает курсоры прочтения и доставки всех участников чата.
+func (d *Database) GetReadCursors(ctx context.Context, chatID string) ([]models.ReadCursor, error) {
+	rows, err := d.db.QueryContext(ctx,
+		`SELECT user_id, last_read_message_id, last_delivered_message_id
+         FROM chat_members WHERE chat_id = $1`,
+		chatID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get read cursors: %w", err)
+	}
+	defer rows.Close()
+
+	cursors := []models.ReadCursor{}
+	for rows.Next() {
+		var c models.ReadCursor
+		var readID, deliveredID sql.NullString
+		if err := rows.Scan(&c.UserID, &readID, &deliveredID); err != nil {
+			return nil, fmt.Errorf("failed to scan read cursor: %w", err)
+		}
+		if readID.Valid {
+			c.LastReadMessageID = &readID.String
+		}
+		if deliveredID.Valid {
+			c.LastDeliveredMessageID = &deliveredID.String
+		}
+		cursors = append(cursors, c)
+	}
+	return cursors, rows.Err()
+}
+
+// GetPeerCursorTimes возвращает самые дальние курсоры прочтения и доставки
+// среди остальных участников — по ним считается статус собственных сообщений.
+func (d *Database) GetPeerCursorTimes(ctx context.Context, chatID string, userID int) (readAt, deliveredAt time.Time, err error) {
+	var read, delivered sql.NullTime
+	err = d.db.QueryRowContext(ctx,
+		`SELECT MAX(rm.created_at), MAX(dm.created_at)
+         FROM chat_members cm
+         LEFT JOIN messages rm ON rm.id = cm.last_read_message_id
+         LEFT JOIN messages dm ON dm.id = cm.last_delivered_message_id
+         WHERE cm.chat_id = $1 AND cm.user_id <> $2`,
+		chatID, userID,
+	).Scan(&read, &delivered)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("failed to get peer cursors: %w", err)
+	}
+	return read.Time, delivered.Time, nil
+}
+
+// GetSeenBy возвращает участников (кроме автора), чей курсор прочтения
+// дошёл до сообщения.
+func (d *Database) GetSeenBy(ctx context.Context, chatID, messageID string, limit, offset int) ([]int, error) {
+	rows, err := d.db.QueryContext(ctx,
+		`SELECT cm.user_id
+         FROM messages m
+         JOIN chat_members cm ON cm.chat_id = m.chat_id AND cm.user_id <> m.sender_id
+         JOIN messages rm ON rm.id = cm.last_read_message_id
+         WHERE m.id = $1 AND m.chat_id = $2
+           AND (rm.created_at, rm.id) >= (m.created_at, m.id)
+         ORDER BY cm.user_id
+         LIMIT $3 OFFSET $4`,
+		messageID, chatID, limit, offset,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get seen by: %w", err)
+	}
+	defer rows.Close()
+
+	userIDs := []int{}
+	for rows.Next() {
+		var uid int
+		if err := rows.Scan(&uid); err != nil {
+			return nil, fmt.Errorf("failed to scan seen by: %w", err)
+		}
+		userIDs = append(userIDs, uid)
+	}
+	return userIDs, rows.Err()
 }
 
 // GetMessagesAroundID возвращает сообщения вокруг указанного id (±around штук).
 // Используется для перехода к цитируемому или найденному сообщению.
-func (d *Database) GetMessagesAroundID(ctx context.Context, chatID string, messageID string, around int) ([]models.Message, error) {
-	before, err := d.GetMessagesBeforeID(ctx, chatID, messageID, around)
+func (d *Database) GetMessagesAroundID(ctx context.Context, chatID string, viewerID int, messageID string, around int) ([]models.Message, error) {
+	messages, _, _, err := d.messagesAround(ctx, chatID, viewerID, messageID, around)
+	return messages, err
+}
+
+// messagesAround — GetMessagesAroundID, плюс есть ли сообщения до и после загруженных.
+func (d *Database) messagesAround(ctx context.Context, chatID string, viewerID int, messageID string, around int) (messages []models.Message, moreBefore, moreAfter bool, err error) {
+	cur, ok, err := d.cursorAt(ctx, chatID, messageID, true)
+	if err != nil || !ok {
+		return nil, false, false, err
+	}
+
+	before, moreBefore, err := d.getMessagesPage(ctx, chatID, viewerID, "", cur, false, around)
 	if err != nil {
-		return nil, err
+		return nil, false, false, err
 	}
 
-	after, err := d.GetMessagesAfterID(ctx, chatID, messageID, around)
+	cur.Before = false
+	after, moreAfter, err := d.getMessagesPage(ctx, chatID, viewerID, "", cur, false, around)
 	if err != nil {
-		return nil, err
+		return nil, false, false, err
 	}
 
-	// Берём само целевое сообщение через GetMessagesAfterID с limit=1 не подойдёт,
-	// поэтому делаем отдельный запрос с тем же SELECT что в scanMessage
+	// Само целевое сообщение — отдельным запросом с тем же SELECT, что в scanMessage
 	rows, err := d.db.QueryContext(ctx,
-		`SELECT
-			m.id, m.chat_id, m.sender_id, m.text,
-			m.reply_to_id, m.edited_at, m.deleted_at, m.created_at,
-			r.id, r.sender_id, r.text,
-			m.forwarded_sender_id, m.forwarded_text, m.forwarded_from_message_id
-		FROM messages m
-		LEFT JOIN messages r ON r.id = m.reply_to_id AND r.deleted_at IS NULL
-		WHERE m.id = $1`,
-		messageID,
+		messageSelect+`
+		WHERE m.id = $1 AND m.chat_id = $2 AND `+notHiddenFor("$3"),
+		messageID, chatID, viewerID,
 	)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get target message: %w", err)
+		return nil, false, false, fmt.Errorf("failed to get target message: %w", err)
 	}
 	defer rows.Close()
 
@@ -64,17 +180,17 @@ func (d *Database) GetMessagesAroundID(ctx context.Context, chatID string, messa
 	if rows.Next() {
 		msg, err := scanMessage(rows)
 		if err != nil {
-			return nil, err
+			return nil, false, false, err
 		}
 		target = &msg
 	}
 
-	result := before
+	messages = before
 	if target != nil {
-		result = append(result, *target)
+		messages = append(messages, *target)
 	}
-	result = append(result, after...)
-	return result, nil
+	messages = append(messages, after...)
+	return messages, moreBefore, moreAfter, nil
 }
 
 func (d *Database) GetMessagesFromUnread(ctx context.Context, chatID string, userID int, around int) (*models.UnreadResult, error) {
@@ -91,18 +207,22 @@ func (d *Database) GetMessagesFromUnread(ctx context.Context, chatID string, use
 	if !lastReadID.Valid {
 		return nil, nil
 	}
+	lastRead, ok, err := d.cursorAt(ctx, chatID, lastReadID.String, false)
+	if err != nil || !ok {
+		return nil, err
+	}
 
 	var firstUnreadID string
 	err = d.db.QueryRowContext(ctx,
-		`SELECT id FROM messages
+		`SELECT id FROM messages m
          WHERE chat_id = $1
            AND deleted_at IS NULL
-           AND created_at > (
-               SELECT created_at FROM messages WHERE id = $2
-           )
-         ORDER BY created_at ASC
+           AND thread_root_id IS NULL
+           AND `+notHiddenFor("$4")+`
+           AND (created_at, id) > ($2, $3)
+         ORDER BY created_at ASC, id ASC
          LIMIT 1`,
-		chatID, lastReadID.String,
+		chatID, lastRead.At, lastRead.ID, userID,
 	).Scan(&firstUnreadID)
 	if err == sql.ErrNoRows {
 		return nil, nil
@@ -113,65 +233,41 @@ func (d *Database) GetMessagesFromUnread(ctx context.Context, chatID string, use
 
 	var totalUnread int
 	err = d.db.QueryRowContext(ctx,
-		`SELECT COUNT(*) FROM messages
+		`SELECT COUNT(*) FROM messages m
          WHERE chat_id = $1
            AND sender_id != $2
+           AND kind = 'user'
            AND deleted_at IS NULL
-           AND created_at > (
-               SELECT created_at FROM messages WHERE id = $3
-           )`,
-		chatID, userID, lastReadID.String,
+           AND thread_root_id IS NULL
+           AND `+notHiddenFor("$2")+`
+           AND (created_at, id) > ($3, $4)`,
+		chatID, userID, lastRead.At, lastRead.ID,
 	).Scan(&totalUnread)
 	if err != nil {
 		return nil, fmt.Errorf("failed to count unread: %w", err)
 	}
 
-	messages, err := d.GetMessagesAroundID(ctx, chatID, firstUnreadID, around)
+	messages, hasMoreTop, hasMoreBottom, err := d.messagesAround(ctx, chatID, userID, firstUnreadID, around)
 	if err != nil {
 		return nil, err
 	}
 
-	var hasMoreTop bool
-	if len(messages) > 0 {
-		firstLoaded := messages[0]
-		err = d.db.QueryRowContext(ctx,
-			`SELECT EXISTS(
-            SELECT 1 FROM messages
-            WHERE chat_id = $1
-              AND created_at < $2
-              AND deleted_at IS NULL
-        )`,
-			chatID, firstLoaded.CreatedAt.Time,
-		).Scan(&hasMoreTop)
-		if err != nil {
-			return nil, fmt.Errorf("failed to check hasMoreTop: %w", err)
-		}
-	}
-	// Проверяем есть ли сообщения после последнего загруженного
-	var hasMoreBottom bool
-	if len(messages) > 0 {
-		lastLoaded := messages[len(messages)-1]
-		err = d.db.QueryRowContext(ctx,
-			`SELECT EXISTS(
-				SELECT 1 FROM messages
-				WHERE chat_id = $1
-				  AND created_at > $2
-				  AND deleted_at IS NULL
-			)`,
-			chatID, lastLoaded.CreatedAt.Time,
-		).Scan(&hasMoreBottom)
-		if err != nil {
-			return nil, fmt.Errorf("failed to check hasMoreBottom: %w", err)
-		}
-	}
-
-	return &models.UnreadResult{
+	result := &models.UnreadResult{
 		Messages:      messages,
 		FirstUnreadID: firstUnreadID,
 		TotalUnread:   totalUnread,
 		HasMoreBottom: hasMoreBottom,
 		HasMoreTop:    hasMoreTop,
-	}, nil
+	}
+	if len(messages) > 0 {
+		if hasMoreTop {
+			result.NextCursor = messageCursor(messages[0], true)
+		}
+		if hasMoreBottom {
+			result.PrevCursor = messageCursor(messages[len(messages)-1], false)
+		}
+	}
+	return result, nil
 }
 
 // scanAroundMessage читает одну строку из запроса GetMessagesAroundID.
@@ -0,0 +1,63 @@
+// Chat_Service/db/revisions.go
+
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"Chat_Service/models"
+)
+
+var (
+	ErrEditWindowExpired = errors.New("message can no longer be edited")
+	ErrTooManyEdits      = errors.New("message edit limit reached")
+)
+
+// GetMessageRevisions возвращает прежние версии текста (с разметкой) сообщения, от исходной к последней.
+// У удалённых сообщений истории нет.
+func (d *Database) GetMessageRevisions(ctx context.Context, chatID, messageID string) ([]models.MessageRevision, error) {
+	var exists bool
+	if err := d.db.QueryRowContext(ctx,
+		`SELECT EXISTS(
+			SELECT 1 FROM messages
+			WHERE id = $1 AND chat_id = $2 AND kind = 'user' AND deleted_at IS NULL
+		)`,
+		messageID, chatID,
+	).Scan(&exists); err != nil {
+		return nil, fmt.Errorf("failed to check message: %w", err)
+	}
+	if !exists {
+		return nil, ErrMessageNotFound
+	}
+
+	rows, err := d.db.QueryContext(ctx,
+		`SELECT revision, text, entities, written_at, replaced_at
+		 FROM message_revisions WHERE message_id = $1
+		 ORDER BY revision`,
+		messageID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get revisions: %w", err)
+	}
+	defer rows.Close()
+
+	revisions := []models.MessageRevision{}
+	for rows.Next() {
+		var rev models.MessageRevision
+		var entities []byte
+		var writtenAt, replacedAt time.Time
+		if err := rows.Scan(&rev.Revision, &rev.Text, &entities, &writtenAt, &replacedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan revision: %w", err)
+		}
+		if rev.Entities, err = decodeEntities(entities); err != nil {
+			return nil, err
+		}
+		rev.WrittenAt = models.UTCTime{Time: writtenAt.UTC()}
+		rev.ReplacedAt = models.UTCTime{Time: replacedAt.UTC()}
+		revisions = append(revisions, rev)
+	}
+	return revisions, rows.Err()
+}
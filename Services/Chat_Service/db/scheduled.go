@@ -0,0 +1,401 @@
+// Chat_Service/db/scheduled.go
+
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"Chat_Service/models"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+var (
+	ErrScheduledNotFound = errors.New("scheduled message not found")
+	ErrScheduledBusy     = errors.New("scheduled message is being sent")
+)
+
+const scheduledColumns = `s.id, s.chat_id, s.sender_id, s.text, s.reply_to_id, s.thread_root_id,
+		s.client_message_id, s.send_at, s.status, s.error, s.created_at`
+
+const scheduledSelect = `SELECT ` + scheduledColumns + `
+	FROM scheduled_messages s`
+
+// CreateScheduledMessage сохраняет сообщение к отправке в sendAt.
+// Вложения уже лежат в хранилище; их запись переедет в attachments при отправке.
+// Если у отправителя в чате уже есть отложенное с тем же ClientMessageID,
+// возвращает его и duplicate = true, а вложения s не сохраняет.
+func (d *Database) CreateScheduledMessage(ctx context.Context, s models.ScheduledMessage, sendAt time.Time) (*models.ScheduledMessage, bool, error) {
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	s.ID = uuid.NewString()
+	s.Status = models.ScheduledPending
+	now := time.Now().UTC()
+	res, err := tx.ExecContext(ctx,
+		`INSERT INTO scheduled_messages (id, chat_id, sender_id, text, reply_to_id, thread_root_id, client_message_id, send_at, created_at)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		 ON CONFLICT (chat_id, sender_id, client_message_id) WHERE client_message_id IS NOT NULL
+		 DO NOTHING`,
+		s.ID, s.ChatID, s.SenderID, s.Text, s.ReplyToID, s.ThreadRootID, s.ClientMessageID, sendAt.UTC(), now,
+	)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to save scheduled message: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 && s.ClientMessageID != nil {
+		tx.Rollback()
+		existing, err := d.GetScheduledByClientID(ctx, s.ChatID, s.SenderID, *s.ClientMessageID)
+		if err != nil {
+			return nil, false, err
+		}
+		return existing, true, nil
+	}
+
+	for i := range s.Attachments {
+		a := &s.Attachments[i]
+		a.ID = NewAttachmentID()
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO scheduled_attachments
+				(id, scheduled_id, position, file_name, store_name, mime_type, size, width, height)
+			 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+			a.ID, s.ID, i, a.FileName, a.StoreName, a.MimeType, a.Size, a.Width, a.Height,
+		); err != nil {
+			return nil, false, fmt.Errorf("failed to save scheduled attachment: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, false, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	s.SendAt = models.UTCTime{Time: sendAt.UTC()}
+	s.CreatedAt = models.UTCTime{Time: now}
+	return &s, false, nil
+}
+
+// GetScheduledByClientID ищет отложенное сообщение по клиентскому идентификатору отправителя.
+func (d *Database) GetScheduledByClientID(ctx context.Context, chatID string, senderID int, clientMessageID string) (*models.ScheduledMessage, error) {
+	rows, err := d.db.QueryContext(ctx,
+		scheduledSelect+`
+		WHERE s.chat_id = $1 AND s.sender_id = $2 AND s.client_message_id = $3`,
+		chatID, senderID, clientMessageID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get scheduled message by client id: %w", err)
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+		return nil, ErrScheduledNotFound
+	}
+	s, err := scanScheduled(rows)
+	if err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	list := []models.ScheduledMessage{s}
+	if err := d.loadScheduledAttachments(ctx, list); err != nil {
+		return nil, err
+	}
+	return &list[0], nil
+}
+
+// GetScheduledMessages возвращает отложенные сообщения пользователя в чате, ближайшие первыми.
+func (d *Database) GetScheduledMessages(ctx context.Context, chatID string, senderID int) ([]models.ScheduledMessage, error) {
+	rows, err := d.db.QueryContext(ctx,
+		scheduledSelect+`
+		WHERE s.chat_id = $1 AND s.sender_id = $2
+		ORDER BY s.send_at`,
+		chatID, senderID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get scheduled messages: %w", err)
+	}
+	defer rows.Close()
+
+	result := []models.ScheduledMessage{}
+	for rows.Next() {
+		s, err := scanScheduled(rows)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return result, d.loadScheduledAttachments(ctx, result)
+}
+
+// UpdateScheduledMessage меняет текст и/или время отправки (nil — не менять).
+// Неудавшееся сообщение снова становится pending. Отправляемое прямо сейчас не трогаем.
+func (d *Database) UpdateScheduledMessage(ctx context.Context, chatID, id string, senderID int, text *string, sendAt *time.Time) (*models.ScheduledMessage, error) {
+	var sendAtUTC *time.Time
+	if sendAt != nil {
+		t := sendAt.UTC()
+		sendAtUTC = &t
+	}
+
+	rows, err := d.db.QueryContext(ctx,
+		`UPDATE scheduled_messages s SET
+			text = COALESCE($4, s.text),
+			send_at = COALESCE($5, s.send_at),
+			status = 'pending',
+			error = NULL
+		 WHERE s.id = $1 AND s.chat_id = $2 AND s.sender_id = $3
+		   AND (s.locked_until IS NULL OR s.locked_until < $6)
+		 RETURNING `+scheduledColumns,
+		id, chatID, senderID, text, sendAtUTC, time.Now().UTC(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update scheduled message: %w", err)
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+		return nil, d.scheduledMissing(ctx, chatID, id, senderID)
+	}
+	s, err := scanScheduled(rows)
+	if err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	list := []models.ScheduledMessage{s}
+	if err := d.loadScheduledAttachments(ctx, list); err != nil {
+		return nil, err
+	}
+	return &list[0], nil
+}
+
+// CancelScheduledMessage удаляет отложенное сообщение и возвращает store_name его файлов.
+func (d *Database) CancelScheduledMessage(ctx context.Context, chatID, id string, senderID int) ([]string, error) {
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var lockedUntil sql.NullTime
+	err = tx.QueryRowContext(ctx,
+		`SELECT locked_until FROM scheduled_messages
+		 WHERE id = $1 AND chat_id = $2 AND sender_id = $3
+		 FOR UPDATE`,
+		id, chatID, senderID,
+	).Scan(&lockedUntil)
+	if err == sql.ErrNoRows {
+		return nil, ErrScheduledNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get scheduled message: %w", err)
+	}
+	if lockedUntil.Valid && lockedUntil.Time.After(time.Now().UTC()) {
+		return nil, ErrScheduledBusy
+	}
+
+	rows, err := tx.QueryContext(ctx,
+		`SELECT store_name FROM scheduled_attachments WHERE scheduled_id = $1`,
+		id,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get scheduled attachments: %w", err)
+	}
+	var storeNames []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan store name: %w", err)
+		}
+		storeNames = append(storeNames, name)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// scheduled_attachments удалятся каскадно
+	if _, err := tx.ExecContext(ctx,
+		`DELETE FROM scheduled_messages WHERE id = $1`,
+		id,
+	); err != nil {
+		return nil, fmt.Errorf("failed to cancel scheduled message: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return storeNames, nil
+}
+
+// scheduledMissing различает «нет такого» и «уже отправляется».
+func (d *Database) scheduledMissing(ctx context.Context, chatID, id string, senderID int) error {
+	var exists bool
+	if err := d.db.QueryRowContext(ctx,
+		`SELECT EXISTS(SELECT 1 FROM scheduled_messages WHERE id = $1 AND chat_id = $2 AND sender_id = $3)`,
+		id, chatID, senderID,
+	).Scan(&exists); err != nil {
+		return fmt.Errorf("failed to check scheduled message: %w", err)
+	}
+	if exists {
+		return ErrScheduledBusy
+	}
+	return ErrScheduledNotFound
+}
+
+// ClaimDueScheduledMessages берёт в аренду до limit созревших сообщений.
+// SKIP LOCKED и locked_until не дают двум экземплярам сервиса взять одно и то же;
+// если экземпляр упал, аренда истечёт и сообщение возьмёт другой.
+func (d *Database) ClaimDueScheduledMessages(ctx context.Context, limit int, lease time.Duration) ([]models.ScheduledMessage, error) {
+	now := time.Now().UTC()
+	rows, err := d.db.QueryContext(ctx,
+		`UPDATE scheduled_messages s SET locked_until = $2
+		 WHERE s.id IN (
+			SELECT id FROM scheduled_messages
+			WHERE status = 'pending' AND send_at <= $3
+			  AND (locked_until IS NULL OR locked_until < $3)
+			ORDER BY send_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		 )
+		 RETURNING `+scheduledColumns,
+		limit, now.Add(lease), now,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim scheduled messages: %w", err)
+	}
+	defer rows.Close()
+
+	var result []models.ScheduledMessage
+	for rows.Next() {
+		s, err := scanScheduled(rows)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, s)
+	}
+	return result, rows.Err()
+}
+
+// CompleteScheduledMessage переносит вложения к отправленному сообщению и удаляет запись.
+// Повторный вызов после сбоя безопасен: вложения вставляются со своими id.
+func (d *Database) CompleteScheduledMessage(ctx context.Context, id, messageID string) error {
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO attachments (id, message_id, file_name, store_name, mime_type, size, width, height)
+		 SELECT id, $2, file_name, store_name, mime_type, size, width, height
+		 FROM scheduled_attachments WHERE scheduled_id = $1
+		 ORDER BY position
+		 ON CONFLICT (id) DO NOTHING`,
+		id, messageID,
+	); err != nil {
+		return fmt.Errorf("failed to move scheduled attachments: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx,
+		`DELETE FROM scheduled_messages WHERE id = $1`,
+		id,
+	); err != nil {
+		return fmt.Errorf("failed to delete scheduled message: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+// FailScheduledMessage помечает сообщение неотправленным и снимает аренду.
+func (d *Database) FailScheduledMessage(ctx context.Context, id, reason string) error {
+	_, err := d.db.ExecContext(ctx,
+		`UPDATE scheduled_messages SET status = 'failed', error = $2, locked_until = NULL WHERE id = $1`,
+		id, reason,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to mark scheduled message failed: %w", err)
+	}
+	return nil
+}
+
+// loadScheduledAttachments подставляет вложения в список отложенных сообщений.
+func (d *Database) loadScheduledAttachments(ctx context.Context, list []models.ScheduledMessage) error {
+	if len(list) == 0 {
+		return nil
+	}
+	ids := make([]string, len(list))
+	index := make(map[string]int, len(list))
+	for i, s := range list {
+		ids[i] = s.ID
+		index[s.ID] = i
+	}
+
+	rows, err := d.db.QueryContext(ctx,
+		`SELECT id, scheduled_id, file_name, store_name, mime_type, size, width, height
+		 FROM scheduled_attachments WHERE scheduled_id = ANY($1)
+		 ORDER BY scheduled_id, position`,
+		pq.Array(ids),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to get scheduled attachments: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var a models.Attachment
+		var scheduledID string
+		var width, height sql.NullInt64
+		if err := rows.Scan(&a.ID, &scheduledID, &a.FileName, &a.StoreName, &a.MimeType, &a.Size, &width, &height); err != nil {
+			return fmt.Errorf("failed to scan scheduled attachment: %w", err)
+		}
+		if width.Valid {
+			w := int(width.Int64)
+			a.Width = &w
+		}
+		if height.Valid {
+			h := int(height.Int64)
+			a.Height = &h
+		}
+		i := index[scheduledID]
+		list[i].Attachments = append(list[i].Attachments, a)
+	}
+	return rows.Err()
+}
+
+func scanScheduled(rows *sql.Rows) (models.ScheduledMessage, error) {
+	var s models.ScheduledMessage
+	var replyToID, threadRootID, clientMessageID, errText sql.NullString
+	var sendAt, createdAt time.Time
+	if err := rows.Scan(&s.ID, &s.ChatID, &s.SenderID, &s.Text, &replyToID, &threadRootID,
+		&clientMessageID, &sendAt, &s.Status, &errText, &createdAt); err != nil {
+		return s, fmt.Errorf("failed to scan scheduled message: %w", err)
+	}
+	if replyToID.Valid {
+		s.ReplyToID = &replyToID.String
+	}
+	if threadRootID.Valid {
+		s.ThreadRootID = &threadRootID.String
+	}
+	if clientMessageID.Valid {
+		s.ClientMessageID = &clientMessageID.String
+	}
+	s.Error = errText.String
+	s.SendAt = models.UTCTime{Time: sendAt.UTC()}
+	s.CreatedAt = models.UTCTime{Time: createdAt.UTC()}
+	return s, nil
+}
@@ -0,0 +1,91 @@
+// Chat_Service/db/search.go
+
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"Chat_Service/models"
+)
+
+// SearchMessages ищет сообщения полнотекстовым поиском в чатах, где userID — участник.
+// Запрос разбирается websearch_to_tsquery ("фраза", OR, -исключение).
+func (d *Database) SearchMessages(ctx context.Context, userID int, p models.SearchParams) ([]models.SearchHit, error) {
+	args := []interface{}{p.Query, userID}
+	where := []string{
+		"m.search_tsv @@ q.query",
+		"m.kind = 'user'",
+		"m.deleted_at IS NULL",
+		notHiddenFor("$2"),
+	}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if p.ChatID != "" {
+		where = append(where, "m.chat_id = "+arg(p.ChatID))
+	}
+	if p.SenderID != nil {
+		where = append(where, "m.sender_id = "+arg(*p.SenderID))
+	}
+	if p.From != nil {
+		where = append(where, "m.created_at >= "+arg(p.From.UTC()))
+	}
+	if p.To != nil {
+		where = append(where, "m.created_at < "+arg(p.To.UTC()))
+	}
+	if p.HasAttachment != nil {
+		cond := "EXISTS (SELECT 1 FROM attachments a WHERE a.message_id = m.id)" +
+			" OR EXISTS (SELECT 1 FROM forwarded_attachments fa WHERE fa.message_id = m.id)"
+		if *p.HasAttachment {
+			where = append(where, "("+cond+")")
+		} else {
+			where = append(where, "NOT ("+cond+")")
+		}
+	}
+
+	// Текст экранируется до ts_headline, поэтому сниппет — безопасный HTML
+	query := `
+		SELECT m.id, m.chat_id, m.sender_id, m.thread_root_id,
+		       ts_headline('russian',
+		           replace(replace(replace(m.text, '&', '&amp;'), '<', '&lt;'), '>', '&gt;'),
+		           q.query,
+		           'StartSel=<mark>, StopSel=</mark>, MaxWords=30, MinWords=10, MaxFragments=2'),
+		       EXISTS (SELECT 1 FROM attachments a WHERE a.message_id = m.id)
+		           OR EXISTS (SELECT 1 FROM forwarded_attachments fa WHERE fa.message_id = m.id),
+		       m.created_at
+		FROM websearch_to_tsquery('russian', $1) AS q(query)
+		JOIN messages m ON true
+		JOIN chat_members cm ON cm.chat_id = m.chat_id AND cm.user_id = $2
+		WHERE ` + strings.Join(where, " AND ") + `
+		ORDER BY m.created_at DESC, m.id DESC
+		LIMIT ` + arg(p.Limit) + ` OFFSET ` + arg(p.Offset)
+
+	rows, err := d.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search messages: %w", err)
+	}
+	defer rows.Close()
+
+	hits := []models.SearchHit{}
+	for rows.Next() {
+		var hit models.SearchHit
+		var createdAt time.Time
+		var threadRootID sql.NullString
+		if err := rows.Scan(&hit.MessageID, &hit.ChatID, &hit.SenderID, &threadRootID, &hit.Snippet,
+			&hit.HasAttachments, &createdAt); err != nil {
+			return nil, fmt.Errorf("failed to scan search hit: %w", err)
+		}
+		hit.CreatedAt = models.UTCTime{Time: createdAt.UTC()}
+		if threadRootID.Valid {
+			hit.ThreadRootID = &threadRootID.String
+		}
+		hits = append(hits, hit)
+	}
+	return hits, rows.Err()
+}
@@ -0,0 +1,269 @@
+// Chat_Service/db/settings.go
+
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"Chat_Service/models"
+
+	"github.com/lib/pq"
+)
+
+var (
+	ErrTooManyPinnedChats = errors.New("too many pinned chats")
+	ErrPinnedMismatch     = errors.New("chat list must match pinned chats")
+)
+
+// UpdateChatSettings меняет личные настройки чата у участника: заданы
+// только поля из req. Новый закреплённый чат встаёт первым.
+func (d *Database) UpdateChatSettings(ctx context.Context, chatID string, userID int, req models.UpdateChatSettingsRequest) (*models.ChatSettings, error) {
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var pinned sql.NullInt64
+	err = tx.QueryRowContext(ctx,
+		`SELECT pinned_position FROM chat_members WHERE chat_id = $1 AND user_id = $2 FOR UPDATE`,
+		chatID, userID,
+	).Scan(&pinned)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotMember
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock chat member: %w", err)
+	}
+
+	if req.Mute != nil {
+		var until *time.Time
+		switch {
+		case req.Mute.Forever:
+			until = &models.MutedForever
+		case req.Mute.Until != nil:
+			t := req.Mute.Until.UTC()
+			until = &t
+		}
+		if _, err := tx.ExecContext(ctx,
+			`UPDATE chat_members SET muted_until = $1 WHERE chat_id = $2 AND user_id = $3`,
+			until, chatID, userID,
+		); err != nil {
+			return nil, fmt.Errorf("failed to update mute: %w", err)
+		}
+	}
+
+	if req.Archive != nil {
+		var archivedAt *time.Time
+		if *req.Archive != models.ArchiveNone {
+			now := time.Now().UTC()
+			archivedAt = &now
+		}
+		if _, err := tx.ExecContext(ctx,
+			`UPDATE chat_members SET archived_at = $1, archive_permanent = $2
+			 WHERE chat_id = $3 AND user_id = $4`,
+			archivedAt, *req.Archive == models.ArchivePermanent, chatID, userID,
+		); err != nil {
+			return nil, fmt.Errorf("failed to update archive: %w", err)
+		}
+	}
+
+	if req.Pinned != nil && *req.Pinned != pinned.Valid {
+		if *req.Pinned {
+			err = pinChat(ctx, tx, chatID, userID)
+		} else {
+			_, err = tx.ExecContext(ctx,
+				`UPDATE chat_members SET pinned_position = NULL WHERE chat_id = $1 AND user_id = $2`,
+				chatID, userID,
+			)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if req.MarkedUnread != nil {
+		if _, err := tx.ExecContext(ctx,
+			`UPDATE chat_members SET marked_unread = $1 WHERE chat_id = $2 AND user_id = $3`,
+			*req.MarkedUnread, chatID, userID,
+		); err != nil {
+			return nil, fmt.Errorf("failed to update unread mark: %w", err)
+		}
+	}
+
+	settings, err := chatSettings(ctx, tx, chatID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return settings, nil
+}
+
+// pinChat ставит чат перед остальными закреплёнными.
+func pinChat(ctx context.Context, tx *sql.Tx, chatID string, userID int) error {
+	// Строки закреплённых чатов пользователя блокируются, чтобы два
+	// параллельных закрепления не обошли лимит
+	rows, err := tx.QueryContext(ctx,
+		`SELECT pinned_position FROM chat_members
+		 WHERE user_id = $1 AND pinned_position IS NOT NULL
+		 FOR UPDATE`,
+		userID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to get pinned chats: %w", err)
+	}
+	count, top := 0, 0
+	for rows.Next() {
+		var pos int
+		if err := rows.Scan(&pos); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan pinned chat: %w", err)
+		}
+		if count == 0 || pos < top {
+			top = pos
+		}
+		count++
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if count >= models.MaxPinnedChats {
+		return ErrTooManyPinnedChats
+	}
+
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE chat_members SET pinned_position = $1 WHERE chat_id = $2 AND user_id = $3`,
+		top-1, chatID, userID,
+	); err != nil {
+		return fmt.Errorf("failed to pin chat: %w", err)
+	}
+	return nil
+}
+
+// ReorderPinnedChats задаёт порядок закреплённых чатов. chatIDs должен
+// содержать ровно все закреплённые чаты пользователя, иначе ErrPinnedMismatch.
+func (d *Database) ReorderPinnedChats(ctx context.Context, userID int, chatIDs []string) error {
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx,
+		`SELECT chat_id FROM chat_members
+		 WHERE user_id = $1 AND pinned_position IS NOT NULL
+		 FOR UPDATE`,
+		userID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to get pinned chats: %w", err)
+	}
+	pinned := map[string]bool{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan pinned chat: %w", err)
+		}
+		pinned[id] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if len(chatIDs) != len(pinned) {
+		return ErrPinnedMismatch
+	}
+	for _, id := range chatIDs {
+		if !pinned[id] {
+			return ErrPinnedMismatch
+		}
+		delete(pinned, id) // повтор id тоже ошибка
+	}
+
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE chat_members cm SET pinned_position = o.pos
+		 FROM unnest($2::uuid[]) WITH ORDINALITY AS o(chat_id, pos)
+		 WHERE cm.user_id = $1 AND cm.chat_id = o.chat_id`,
+		userID, pq.Array(chatIDs),
+	); err != nil {
+		return fmt.Errorf("failed to reorder pinned chats: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+// ClearMarkedUnread снимает ручную отметку «непрочитано»; true — она была.
+func (d *Database) ClearMarkedUnread(ctx context.Context, chatID string, userID int) (bool, error) {
+	res, err := d.db.ExecContext(ctx,
+		`UPDATE chat_members SET marked_unread = FALSE
+		 WHERE chat_id = $1 AND user_id = $2 AND marked_unread`,
+		chatID, userID,
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to clear unread mark: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// GetChatSettings возвращает личные настройки чата у участника.
+func (d *Database) GetChatSettings(ctx context.Context, chatID string, userID int) (*models.ChatSettings, error) {
+	tx, err := d.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	return chatSettings(ctx, tx, chatID, userID)
+}
+
+func chatSettings(ctx context.Context, tx *sql.Tx, chatID string, userID int) (*models.ChatSettings, error) {
+	var s models.ChatSettings
+	var mutedUntil sql.NullTime
+	var pinned sql.NullInt64
+	err := tx.QueryRowContext(ctx,
+		`SELECT
+		 CASE WHEN cm.muted_until > NOW() THEN cm.muted_until END,
+		 cm.archived_at IS NOT NULL AND (
+			 cm.archive_permanent OR COALESCE((
+				 SELECT MAX(created_at) FROM messages
+				 WHERE chat_id = cm.chat_id AND deleted_at IS NULL AND thread_root_id IS NULL
+				 AND NOT EXISTS (
+					 SELECT 1 FROM hidden_messages hm
+					 WHERE hm.message_id = messages.id AND hm.user_id = cm.user_id
+				 )
+			 ), '-infinity') <= cm.archived_at
+		 ),
+		 cm.archive_permanent, cm.pinned_position, cm.marked_unread
+		 FROM chat_members cm WHERE cm.chat_id = $1 AND cm.user_id = $2`,
+		chatID, userID,
+	).Scan(&mutedUntil, &s.Archived, &s.ArchivePermanent, &pinned, &s.MarkedUnread)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotMember
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get chat settings: %w", err)
+	}
+	s = settingsFrom(s, mutedUntil, pinned)
+	return &s, nil
+}
+
+// settingsFrom дополняет настройки полями, которые в БД могут быть NULL.
+func settingsFrom(s models.ChatSettings, mutedUntil sql.NullTime, pinned sql.NullInt64) models.ChatSettings {
+	if mutedUntil.Valid {
+		s.MutedUntil = &models.UTCTime{Time: mutedUntil.Time.UTC()}
+	}
+	if pinned.Valid {
+		pos := int(pinned.Int64)
+		s.PinnedPosition = &pos
+	}
+	return s
+}
@@ -0,0 +1,272 @@
+// Chat_Service/db/sync.go
+
+package db
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"Chat_Service/models"
+
+	"github.com/lib/pq"
+)
+
+var ErrInvalidSyncToken = errors.New("invalid sync token")
+
+// Сущности журнала sync_changes
+const (
+	syncEntityMessage = "message"
+	syncEntityMember  = "member"
+	syncEntityChat    = "chat"
+)
+
+// SyncToken — до какого места клиент получил журнал изменений: все записи
+// транзакций с xid < Horizon. Номер записи (seq) для этого не годится —
+// транзакции коммитятся не по порядку, и запись с меньшим seq может появиться
+// уже после выдачи токена. Ниже горизонта снимка все транзакции завершены.
+type SyncToken struct {
+	Horizon  uint64
+	IssuedAt time.Time
+}
+
+func (t SyncToken) String() string {
+	raw := strconv.FormatUint(t.Horizon, 10) + "." + strconv.FormatInt(t.IssuedAt.Unix(), 10)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// ParseSyncToken разбирает строку из String(); любая ошибка — ErrInvalidSyncToken.
+func ParseSyncToken(s string) (SyncToken, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return SyncToken{}, ErrInvalidSyncToken
+	}
+	horizon, issued, ok := strings.Cut(string(data), ".")
+	if !ok {
+		return SyncToken{}, ErrInvalidSyncToken
+	}
+	h, err := strconv.ParseUint(horizon, 10, 64)
+	if err != nil {
+		return SyncToken{}, ErrInvalidSyncToken
+	}
+	sec, err := strconv.ParseInt(issued, 10, 64)
+	if err != nil {
+		return SyncToken{}, ErrInvalidSyncToken
+	}
+	return SyncToken{Horizon: h, IssuedAt: time.Unix(sec, 0).UTC()}, nil
+}
+
+type syncChange struct {
+	chatID   string
+	entity   string
+	entityID string
+}
+
+// GetSync собирает изменения для userID с токена since (nil — первый запуск).
+// Токен старше retention или больше maxChanges изменений — FullResync.
+// Вложения и реакции сообщений заполняет вызывающий.
+func (d *Database) GetSync(ctx context.Context, userID int, since *SyncToken, retention time.Duration, maxChanges int) (*models.SyncResponse, error) {
+	until, err := d.currentSyncToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+	resp := &models.SyncResponse{
+		Token:           until.String(),
+		Chats:           []models.ChatListItem{},
+		RemovedChats:    []string{},
+		Messages:        []models.Message{},
+		DeletedMessages: []models.SyncMessageRef{},
+		Members:         []models.SyncMember{},
+	}
+	// Горизонт впереди текущего — токен не от этой базы
+	if since == nil || since.IssuedAt.Before(until.IssuedAt.Add(-retention)) || since.Horizon > until.Horizon {
+		resp.FullResync = true
+		return resp, nil
+	}
+
+	changes, err := d.getSyncChanges(ctx, userID, *since, until, maxChanges+1)
+	if err != nil {
+		return nil, err
+	}
+	if len(changes) > maxChanges {
+		resp.FullResync = true
+		return resp, nil
+	}
+
+	touched := map[string]bool{}
+	var chatIDs, messageIDs, memberChats []string
+	var memberUsers []int
+	messageChat := map[string]string{}
+	for _, c := range changes {
+		if !touched[c.chatID] {
+			touched[c.chatID] = true
+			chatIDs = append(chatIDs, c.chatID)
+		}
+		switch c.entity {
+		case syncEntityMessage:
+			messageIDs = append(messageIDs, c.entityID)
+			messageChat[c.entityID] = c.chatID
+		case syncEntityMember:
+			if id, err := strconv.Atoi(c.entityID); err == nil {
+				memberChats = append(memberChats, c.chatID)
+				memberUsers = append(memberUsers, id)
+			}
+		}
+	}
+
+	if len(messageIDs) > 0 {
+		messages, err := d.getMessagesByIDs(ctx, userID, messageIDs)
+		if err != nil {
+			return nil, err
+		}
+		resp.Messages = append(resp.Messages, messages...)
+		found := map[string]bool{}
+		for _, m := range messages {
+			found[m.ID] = true
+		}
+		for _, id := range messageIDs {
+			if !found[id] {
+				resp.DeletedMessages = append(resp.DeletedMessages, models.SyncMessageRef{ChatID: messageChat[id], MessageID: id})
+			}
+		}
+	}
+
+	if len(memberUsers) > 0 {
+		members, err := d.getSyncMembers(ctx, memberChats, memberUsers)
+		if err != nil {
+			return nil, err
+		}
+		for i, uid := range memberUsers {
+			m, ok := members[memberChats[i]+"/"+strconv.Itoa(uid)]
+			if !ok {
+				m = models.SyncMember{ChatID: memberChats[i], UserID: uid, Removed: true}
+				if uid == userID {
+					resp.RemovedChats = append(resp.RemovedChats, memberChats[i])
+				}
+			}
+			resp.Members = append(resp.Members, m)
+		}
+	}
+
+	if len(chatIDs) > 0 {
+		chats, _, err := d.getUserChats(ctx, userID, nil, time.Time{}, 0, chatIDs)
+		if err != nil {
+			return nil, err
+		}
+		resp.Chats = append(resp.Chats, chats...)
+	}
+
+	return resp, nil
+}
+
+// currentSyncToken — горизонт снимка: транзакции до него уже завершены.
+func (d *Database) currentSyncToken(ctx context.Context) (SyncToken, error) {
+	var horizon string
+	if err := d.db.QueryRowContext(ctx,
+		`SELECT pg_snapshot_xmin(pg_current_snapshot())::text`,
+	).Scan(&horizon); err != nil {
+		return SyncToken{}, fmt.Errorf("failed to get snapshot horizon: %w", err)
+	}
+	h, err := strconv.ParseUint(horizon, 10, 64)
+	if err != nil {
+		return SyncToken{}, fmt.Errorf("failed to parse snapshot horizon: %w", err)
+	}
+	return SyncToken{Horizon: h, IssuedAt: time.Now().UTC()}, nil
+}
+
+// getSyncChanges возвращает изменения между токенами без повторов: из чатов,
+// где userID сейчас участник, плюс его собственный выход из чатов.
+func (d *Database) getSyncChanges(ctx context.Context, userID int, since, until SyncToken, limit int) ([]syncChange, error) {
+	rows, err := d.db.QueryContext(ctx,
+		`SELECT DISTINCT sc.chat_id, sc.entity, sc.entity_id
+		 FROM sync_changes sc
+		 WHERE sc.xid >= $2::xid8 AND sc.xid < $3::xid8
+		   AND (sc.user_id IS NULL OR sc.user_id = $1)
+		   AND (
+			   EXISTS (SELECT 1 FROM chat_members cm WHERE cm.chat_id = sc.chat_id AND cm.user_id = $1)
+			   OR (sc.entity = 'member' AND sc.entity_id = $1::int::text)
+		   )
+		 LIMIT $4`,
+		userID, strconv.FormatUint(since.Horizon, 10), strconv.FormatUint(until.Horizon, 10), limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get sync changes: %w", err)
+	}
+	defer rows.Close()
+
+	var changes []syncChange
+	for rows.Next() {
+		var c syncChange
+		if err := rows.Scan(&c.chatID, &c.entity, &c.entityID); err != nil {
+			return nil, fmt.Errorf("failed to scan sync change: %w", err)
+		}
+		changes = append(changes, c)
+	}
+	return changes, rows.Err()
+}
+
+// getMessagesByIDs — сообщения по id в хронологическом порядке, без скрытых зрителем.
+func (d *Database) getMessagesByIDs(ctx context.Context, viewerID int, ids []string) ([]models.Message, error) {
+	rows, err := d.db.QueryContext(ctx,
+		messageSelect+`
+		WHERE m.id = ANY($1::uuid[]) AND `+notHiddenFor("$2")+`
+		ORDER BY m.created_at, m.id`,
+		pq.Array(ids), viewerID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get messages: %w", err)
+	}
+	defer rows.Close()
+
+	var messages []models.Message
+	for rows.Next() {
+		msg, err := scanMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, msg)
+	}
+	return messages, rows.Err()
+}
+
+// getSyncMembers читает участников по парам (chatIDs[i], userIDs[i]);
+// ключ результата — "chatID/userID", отсутствующих в чате нет.
+func (d *Database) getSyncMembers(ctx context.Context, chatIDs []string, userIDs []int) (map[string]models.SyncMember, error) {
+	rows, err := d.db.QueryContext(ctx,
+		`SELECT cm.chat_id, cm.user_id, cm.role, cm.last_read_message_id, cm.last_delivered_message_id
+		 FROM chat_members cm
+		 JOIN unnest($1::uuid[], $2::int[]) AS k(chat_id, user_id)
+		   ON k.chat_id = cm.chat_id AND k.user_id = cm.user_id`,
+		pq.Array(chatIDs), pq.Array(userIDs),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get members: %w", err)
+	}
+	defer rows.Close()
+
+	members := map[string]models.SyncMember{}
+	for rows.Next() {
+		var m models.SyncMember
+		if err := rows.Scan(&m.ChatID, &m.UserID, &m.Role, &m.LastReadMessageID, &m.LastDeliveredMessageID); err != nil {
+			return nil, fmt.Errorf("failed to scan member: %w", err)
+		}
+		members[m.ChatID+"/"+strconv.Itoa(m.UserID)] = m
+	}
+	return members, rows.Err()
+}
+
+// PruneSyncChanges удаляет записи журнала старше before.
+func (d *Database) PruneSyncChanges(ctx context.Context, before time.Time) (int64, error) {
+	res, err := d.db.ExecContext(ctx,
+		`DELETE FROM sync_changes WHERE created_at < $1`,
+		before,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune sync changes: %w", err)
+	}
+	return res.RowsAffected()
+}
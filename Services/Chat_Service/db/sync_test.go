@@ -0,0 +1,25 @@
+// Chat_Service/db/sync_test.go
+package db
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSyncTokenRoundTrip(t *testing.T) {
+	token := SyncToken{Horizon: 1<<40 + 7, IssuedAt: time.Date(2026, 5, 4, 10, 0, 0, 0, time.UTC)}
+	got, err := ParseSyncToken(token.String())
+	if err != nil {
+		t.Fatalf("ParseSyncToken failed: %v", err)
+	}
+	if got != token {
+		t.Errorf("Expected %+v, got %+v", token, got)
+	}
+
+	for _, s := range []string{"", "???", "MTIz", "LTEuMTIz"} {
+		if _, err := ParseSyncToken(s); !errors.Is(err, ErrInvalidSyncToken) {
+			t.Errorf("ParseSyncToken(%q): expected ErrInvalidSyncToken, got %v", s, err)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+// Chat_Service/db/system.go
+
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"Chat_Service/models"
+
+	"github.com/google/uuid"
+)
+
+// insertSystemMessage пишет системное сообщение в рамках транзакции действия.
+func insertSystemMessage(ctx context.Context, tx *sql.Tx, chatID string, actorID int, payload models.SystemPayload) (*models.Message, error) {
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode system payload: %w", err)
+	}
+
+	id := uuid.NewString()
+	now := time.Now().UTC()
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO messages (id, chat_id, sender_id, text, kind, payload, created_at)
+		 VALUES ($1, $2, $3, '', $4, $5, $6)`,
+		id, chatID, actorID, models.MessageKindSystem, raw, now,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to insert system message: %w", err)
+	}
+
+	return &models.Message{
+		ID:        id,
+		ChatID:    chatID,
+		SenderID:  actorID,
+		Kind:      models.MessageKindSystem,
+		System:    &payload,
+		CreatedAt: models.UTCTime{Time: now},
+	}, nil
+}
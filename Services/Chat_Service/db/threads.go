@@ -0,0 +1,234 @@
+// Chat_Service/db/threads.go
+
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"Chat_Service/models"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+var ErrInvalidThreadRoot = errors.New("message cannot be a thread root")
+
+// lockThreadRoot проверяет, что rootID — неудалённое пользовательское сообщение чата
+// вне ветки (вложенных веток нет), и блокирует его строку до конца транзакции.
+func lockThreadRoot(ctx context.Context, tx *sql.Tx, chatID, rootID string) error {
+	if _, err := uuid.Parse(rootID); err != nil {
+		return ErrMessageNotFound
+	}
+
+	var kind string
+	var deleted bool
+	var parent sql.NullString
+	err := tx.QueryRowContext(ctx,
+		`SELECT kind, deleted_at IS NOT NULL, thread_root_id FROM messages
+		 WHERE id = $1 AND chat_id = $2
+		 FOR UPDATE`,
+		rootID, chatID,
+	).Scan(&kind, &deleted, &parent)
+	if err == sql.ErrNoRows {
+		return ErrMessageNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to lock thread root: %w", err)
+	}
+	if deleted {
+		return ErrMessageNotFound
+	}
+	if kind != models.MessageKindUser || parent.Valid {
+		return ErrInvalidThreadRoot
+	}
+	return nil
+}
+
+// markThreadRead сдвигает отметку прочтения ветки вперёд (назад — никогда).
+func markThreadRead(ctx context.Context, tx *sql.Tx, rootID string, userID int, readAt time.Time) error {
+	_, err := tx.ExecContext(ctx,
+		`INSERT INTO thread_reads (root_id, user_id, last_read_at) VALUES ($1, $2, $3)
+		 ON CONFLICT (root_id, user_id) DO UPDATE
+		 SET last_read_at = GREATEST(thread_reads.last_read_at, EXCLUDED.last_read_at)`,
+		rootID, userID, readAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to mark thread read: %w", err)
+	}
+	return nil
+}
+
+// GetThreadRoot возвращает корневое сообщение ветки в чате.
+// ErrMessageNotFound — если его нет или это само ответ в ветке.
+func (d *Database) GetThreadRoot(ctx context.Context, chatID, rootID string) (*models.Message, error) {
+	rows, err := d.db.QueryContext(ctx,
+		messageSelect+`
+		WHERE m.id = $1 AND m.chat_id = $2 AND m.thread_root_id IS NULL`,
+		rootID, chatID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get thread root: %w", err)
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+		return nil, ErrMessageNotFound
+	}
+	msg, err := scanMessage(rows)
+	if err != nil {
+		return nil, err
+	}
+	return &msg, nil
+}
+
+// GetThreadMessages возвращает ответы ветки в хронологическом порядке:
+// до before, после after или (оба пустые) последние limit штук.
+// Скрытые зрителем ответы пропускаются.
+func (d *Database) GetThreadMessages(ctx context.Context, chatID string, viewerID int, rootID, before, after string, limit int) ([]models.Message, error) {
+	switch {
+	case before != "":
+		return d.getMessagesFrom(ctx, chatID, viewerID, rootID, before, true, limit)
+	case after != "":
+		return d.getMessagesFrom(ctx, chatID, viewerID, rootID, after, false, limit)
+	}
+
+	rows, err := d.db.QueryContext(ctx,
+		messageSelect+`
+		WHERE m.chat_id = $1 AND m.thread_root_id = $2 AND `+notHiddenFor("$4")+`
+		ORDER BY m.created_at DESC, m.id DESC
+		LIMIT $3`,
+		chatID, rootID, limit, viewerID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get thread messages: %w", err)
+	}
+	defer rows.Close()
+
+	var messages []models.Message
+	for rows.Next() {
+		msg, err := scanMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, msg)
+	}
+	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+		messages[i], messages[j] = messages[j], messages[i]
+	}
+	return messages, rows.Err()
+}
+
+// MarkThreadRead отмечает ветку прочитанной до lastMessageID включительно.
+func (d *Database) MarkThreadRead(ctx context.Context, chatID, rootID string, userID int, lastMessageID string) error {
+	var readAt time.Time
+	err := d.db.QueryRowContext(ctx,
+		`SELECT created_at FROM messages
+		 WHERE id = $1 AND chat_id = $2 AND thread_root_id = $3`,
+		lastMessageID, chatID, rootID,
+	).Scan(&readAt)
+	if err == sql.ErrNoRows {
+		return ErrMessageNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get message: %w", err)
+	}
+
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := markThreadRead(ctx, tx, rootID, userID, readAt); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetUserThreads возвращает ветки, в которых участвует пользователь
+// (автор корня или писал/читал ветку), со свежими ответами первыми.
+// У каждого корня в Thread.UnreadCount — непрочитанные чужие ответы.
+func (d *Database) GetUserThreads(ctx context.Context, userID, limit, offset int) ([]models.Message, error) {
+	rows, err := d.db.QueryContext(ctx,
+		messageSelect+`
+		JOIN chat_members cm ON cm.chat_id = m.chat_id AND cm.user_id = $1
+		LEFT JOIN thread_reads tr ON tr.root_id = m.id AND tr.user_id = $1
+		WHERE m.thread_reply_count > 0
+		  AND (m.sender_id = $1 OR tr.user_id IS NOT NULL)
+		ORDER BY m.thread_last_reply_at DESC
+		LIMIT $2 OFFSET $3`,
+		userID, limit, offset,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get threads: %w", err)
+	}
+	defer rows.Close()
+
+	roots := []models.Message{}
+	var ids []string
+	for rows.Next() {
+		msg, err := scanMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		roots = append(roots, msg)
+		ids = append(ids, msg.ID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return roots, nil
+	}
+
+	unread, err := d.getThreadUnread(ctx, userID, ids)
+	if err != nil {
+		return nil, err
+	}
+	for i := range roots {
+		if roots[i].Thread == nil {
+			continue
+		}
+		n := unread[roots[i].ID]
+		roots[i].Thread.UnreadCount = &n
+	}
+	return roots, nil
+}
+
+// getThreadUnread считает чужие неудалённые ответы после отметки прочтения по каждой ветке.
+func (d *Database) getThreadUnread(ctx context.Context, userID int, rootIDs []string) (map[string]int, error) {
+	rows, err := d.db.QueryContext(ctx,
+		`SELECT r.thread_root_id, COUNT(*)
+		 FROM messages r
+		 LEFT JOIN thread_reads tr ON tr.root_id = r.thread_root_id AND tr.user_id = $1
+		 WHERE r.thread_root_id = ANY($2)
+		   AND r.sender_id <> $1
+		   AND r.deleted_at IS NULL
+		   AND NOT EXISTS (SELECT 1 FROM hidden_messages hm WHERE hm.message_id = r.id AND hm.user_id = $1)
+		   AND (tr.last_read_at IS NULL OR r.created_at > tr.last_read_at)
+		 GROUP BY r.thread_root_id`,
+		userID, pq.Array(rootIDs),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count thread unread: %w", err)
+	}
+	defer rows.Close()
+
+	result := make(map[string]int, len(rootIDs))
+	for rows.Next() {
+		var rootID string
+		var n int
+		if err := rows.Scan(&rootID, &n); err != nil {
+			return nil, fmt.Errorf("failed to scan thread unread: %w", err)
+		}
+		result[rootID] = n
+	}
+	return result, rows.Err()
+}
@@ -0,0 +1,203 @@
+// Chat_Service/db/ttl.go
+
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"Chat_Service/models"
+
+	"github.com/lib/pq"
+)
+
+// ExpiredMessage — сообщение, удалённое по истечении срока жизни.
+type ExpiredMessage struct {
+	ID     string
+	ChatID string
+}
+
+// expiresAtFor — SQL выражение срока жизни нового сообщения:
+// createdAt + message_ttl чата chatID или NULL, если TTL не задан.
+func expiresAtFor(chatID, createdAt string) string {
+	return "(SELECT " + createdAt + "::timestamp + message_ttl * INTERVAL '1 second'" +
+		" FROM chats WHERE id = " + chatID + " AND message_ttl > 0)"
+}
+
+// SetMessageTTL задаёт срок жизни новых сообщений чата (0 — выключить).
+// В direct менять может любой из участников, в группе и канале — owner/admin.
+// Уже отправленные сообщения сохраняют прежний срок.
+func (d *Database) SetMessageTTL(ctx context.Context, chatID string, actorID, ttl int) (*models.Message, error) {
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var chatType, role string
+	err = tx.QueryRowContext(ctx,
+		`SELECT c.type, cm.role
+		 FROM chats c
+		 JOIN chat_members cm ON cm.chat_id = c.id AND cm.user_id = $2
+		 WHERE c.id = $1
+		 FOR UPDATE OF c`,
+		chatID, actorID,
+	).Scan(&chatType, &role)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotMember
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get member role: %w", err)
+	}
+	if chatType != models.ChatTypeDirect && !canManage(role) {
+		return nil, ErrNoPermission
+	}
+
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE chats SET message_ttl = NULLIF($2, 0) WHERE id = $1`,
+		chatID, ttl,
+	); err != nil {
+		return nil, fmt.Errorf("failed to set message ttl: %w", err)
+	}
+
+	msg, err := insertSystemMessage(ctx, tx, chatID, actorID, models.SystemPayload{Type: models.SystemTTLChanged, TTL: ttl})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return msg, nil
+}
+
+// DeleteExpiredMessages окончательно удаляет до limit истёкших сообщений
+// вместе с ответами их веток (каскад) и возвращает удалённые сообщения
+// и store_name их файлов. SKIP LOCKED позволяет запускать чистку на нескольких экземплярах.
+func (d *Database) DeleteExpiredMessages(ctx context.Context, limit int) ([]ExpiredMessage, []string, error) {
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx,
+		`SELECT id FROM messages
+		 WHERE expires_at <= $1
+		 ORDER BY expires_at
+		 LIMIT $2
+		 FOR UPDATE SKIP LOCKED`,
+		time.Now().UTC(), limit,
+	)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to find expired messages: %w", err)
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, nil, fmt.Errorf("failed to scan expired message: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+	if len(ids) == 0 {
+		return nil, nil, nil
+	}
+
+	// Вложения удаляемых сообщений и их ответов в ветках (те уходят каскадом
+	// по thread_root_id независимо от своего срока). Свои вложения отвязываем,
+	// чтобы каскад не удалил их у пересланных копий; лишние уберёт releaseAttachments
+	rows, err = tx.QueryContext(ctx,
+		`SELECT id FROM messages WHERE id = ANY($1) OR thread_root_id = ANY($1)`,
+		pq.Array(ids),
+	)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get thread replies: %w", err)
+	}
+	var messageIDs []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, nil, fmt.Errorf("failed to scan message id: %w", err)
+		}
+		messageIDs = append(messageIDs, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	attachmentIDs, err := collectAttachmentIDs(ctx, tx, messageIDs)
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE attachments SET message_id = NULL WHERE message_id = ANY($1)`,
+		pq.Array(messageIDs),
+	); err != nil {
+		return nil, nil, fmt.Errorf("failed to detach attachments: %w", err)
+	}
+
+	rows, err = tx.QueryContext(ctx,
+		`DELETE FROM messages
+		 WHERE id = ANY($1) OR thread_root_id = ANY($1)
+		 RETURNING id, chat_id, thread_root_id`,
+		pq.Array(ids),
+	)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to delete expired messages: %w", err)
+	}
+	var deleted []ExpiredMessage
+	var roots []string
+	for rows.Next() {
+		var m ExpiredMessage
+		var rootID sql.NullString
+		if err := rows.Scan(&m.ID, &m.ChatID, &rootID); err != nil {
+			rows.Close()
+			return nil, nil, fmt.Errorf("failed to scan deleted message: %w", err)
+		}
+		deleted = append(deleted, m)
+		if rootID.Valid {
+			roots = append(roots, rootID.String)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	storeNames, err := releaseAttachments(ctx, tx, attachmentIDs)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Ветки, у которых истекли ответы, пересчитываем
+	if len(roots) > 0 {
+		if _, err := tx.ExecContext(ctx,
+			`UPDATE messages r SET
+				thread_reply_count = (
+					SELECT COUNT(*) FROM messages WHERE thread_root_id = r.id AND deleted_at IS NULL
+				),
+				thread_last_reply_at = (
+					SELECT MAX(created_at) FROM messages WHERE thread_root_id = r.id AND deleted_at IS NULL
+				)
+			 WHERE r.id = ANY($1)`,
+			pq.Array(roots),
+		); err != nil {
+			return nil, nil, fmt.Errorf("failed to update thread roots: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return deleted, storeNames, nil
+}
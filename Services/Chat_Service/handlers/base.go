@@ -2,20 +2,25 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"Chat_Service/auth"
 	"Chat_Service/config"
 	"Chat_Service/db"
+	"Chat_Service/linkpreview"
+	"Chat_Service/logger"
 	"Chat_Service/models"
 	"Chat_Service/storage"
 	"Chat_Service/ws"
 
+	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 	"github.com/gorilla/websocket"
 )
@@ -30,6 +35,10 @@ type ChatHandler struct {
 	hub        *ws.Hub
 	jwtService *auth.JWTService
 	storage    *storage.FileStorage
+	mediaURLs  *storage.URLSigner
+
+	fetcher     linkpreview.Fetcher
+	previewJobs chan previewJob // nil — превью ссылок выключены
 }
 
 func NewChatHandler(cfg *config.Config, database *db.Database, hub *ws.Hub) *ChatHandler {
@@ -37,13 +46,19 @@ func NewChatHandler(cfg *config.Config, database *db.Database, hub *ws.Hub) *Cha
 	if err != nil {
 		log.Fatalf("Failed to init file storage: %v", err)
 	}
-	return &ChatHandler{
+	h := &ChatHandler{
 		config:     cfg,
 		db:         database,
 		hub:        hub,
 		jwtService: auth.NewJWTService(cfg.JWT.SecretKey),
 		storage:    fileStorage,
+		mediaURLs:  storage.NewURLSigner(cfg.Media.URLSecret, cfg.Media.URLTTL),
+	}
+	if cfg.Previews.Workers > 0 {
+		h.fetcher = linkpreview.NewHTTPFetcher(cfg.Previews.Timeout, cfg.Previews.MaxBytes)
+		h.previewJobs = make(chan previewJob, previewQueueSize)
 	}
+	return h
 }
 
 func (h *ChatHandler) RegisterRoutes(r *mux.Router) {
@@ -54,19 +69,76 @@ func (h *ChatHandler) RegisterRoutes(r *mux.Router) {
 	r.HandleFunc("/api/chats/create", h.CreateChat).Methods("POST", "OPTIONS")
 	r.HandleFunc("/api/chats/forward", h.ForwardMessages).Methods("POST", "OPTIONS")
 	r.HandleFunc("/api/chats", h.GetChats).Methods("GET", "OPTIONS")
-	r.HandleFunc("/api/chats/{chatId}", h.GetChatInfo).Methods("GET", "OPTIONS")
-	r.HandleFunc("/api/chats/{chatId}/read", h.MarkRead).Methods("POST", "OPTIONS")
+	r.HandleFunc("/api/chats/search", h.SearchAllChats).Methods("GET", "OPTIONS")
+	r.HandleFunc("/api/chats/threads", h.GetUserThreads).Methods("GET", "OPTIONS")
+	r.HandleFunc("/api/chats/pinned", h.ReorderPinnedChats).Methods("PUT", "OPTIONS")
+	r.HandleFunc("/api/sync", h.Sync).Methods("GET", "OPTIONS")
+
+	// Вступление по ссылке — до подроутера чата, вызывающий ещё не участник
+	r.HandleFunc("/api/chats/join/{code}", h.PreviewInvite).Methods("GET", "OPTIONS")
+	r.HandleFunc("/api/chats/join/{code}", h.JoinChat).Methods("POST", "OPTIONS")
+
+	// Всё, что адресовано конкретному чату, доступно только его участникам
+	chat := r.PathPrefix("/api/chats/{chatId}").Subrouter()
+	chat.Use(h.requireChatMember)
+
+	chat.HandleFunc("", h.GetChatInfo).Methods("GET", "OPTIONS")
+	chat.HandleFunc("/read", h.MarkRead).Methods("POST", "OPTIONS")
+	chat.HandleFunc("/draft", h.SaveDraft).Methods("PUT", "OPTIONS")
+	chat.HandleFunc("/draft", h.DeleteDraft).Methods("DELETE", "OPTIONS")
+	chat.HandleFunc("/settings", h.UpdateChatSettings).Methods("PUT", "OPTIONS")
 
 	// Сообщения
-	r.HandleFunc("/api/chats/{chatId}/messages/before", h.GetMessagesBefore).Methods("GET", "OPTIONS")
-	r.HandleFunc("/api/chats/{chatId}/messages/after", h.GetMessagesAfter).Methods("GET", "OPTIONS")
-	r.HandleFunc("/api/chats/{chatId}/messages", h.GetMessages).Methods("GET", "OPTIONS")
-	r.HandleFunc("/api/chats/{chatId}/messages", h.SendMessage).Methods("POST", "OPTIONS")
-	r.HandleFunc("/api/chats/{chatId}/messages/{messageId}/context", h.GetMessagesContext).Methods("GET", "OPTIONS")
-	r.HandleFunc("/api/chats/{chatId}/messages/{messageId}", h.EditMessage).Methods("PUT", "OPTIONS")
-	r.HandleFunc("/api/chats/{chatId}/messages/{messageId}", h.DeleteMessage).Methods("DELETE", "OPTIONS")
-	r.HandleFunc("/api/chats/{chatId}/upload", h.UploadFiles).Methods("POST", "OPTIONS")
-	r.HandleFunc("/api/chats/{chatId}/messages/unread", h.GetUnreadMessages).Methods("GET", "OPTIONS")
+	chat.HandleFunc("/messages/before", h.GetMessagesBefore).Methods("GET", "OPTIONS")
+	chat.HandleFunc("/messages/after", h.GetMessagesAfter).Methods("GET", "OPTIONS")
+	chat.HandleFunc("/messages", h.GetMessages).Methods("GET", "OPTIONS")
+	chat.HandleFunc("/messages", h.SendMessage).Methods("POST", "OPTIONS")
+	chat.HandleFunc("/messages/{messageId}/context", h.GetMessagesContext).Methods("GET", "OPTIONS")
+	chat.HandleFunc("/messages/{messageId}", h.EditMessage).Methods("PUT", "OPTIONS")
+	chat.HandleFunc("/messages/{messageId}", h.DeleteMessage).Methods("DELETE", "OPTIONS")
+	chat.HandleFunc("/upload", h.UploadFiles).Methods("POST", "OPTIONS")
+	chat.HandleFunc("/messages/unread", h.GetUnreadMessages).Methods("GET", "OPTIONS")
+	chat.HandleFunc("/search", h.SearchChat).Methods("GET", "OPTIONS")
+	chat.HandleFunc("/messages/{messageId}/seen", h.GetSeenBy).Methods("GET", "OPTIONS")
+	chat.HandleFunc("/messages/{messageId}/revisions", h.GetMessageRevisions).Methods("GET", "OPTIONS")
+	chat.HandleFunc("/messages/{messageId}/reactions", h.GetReactions).Methods("GET", "OPTIONS")
+	chat.HandleFunc("/messages/{messageId}/reactions/{emoji}", h.AddReaction).Methods("PUT", "OPTIONS")
+	chat.HandleFunc("/messages/{messageId}/reactions/{emoji}", h.RemoveReaction).Methods("DELETE", "OPTIONS")
+
+	// Отложенные сообщения
+	chat.HandleFunc("/scheduled", h.GetScheduledMessages).Methods("GET", "OPTIONS")
+	chat.HandleFunc("/scheduled/{id}", h.UpdateScheduledMessage).Methods("PUT", "OPTIONS")
+	chat.HandleFunc("/scheduled/{id}", h.CancelScheduledMessage).Methods("DELETE", "OPTIONS")
+
+	// Ветки
+	chat.HandleFunc("/threads/{rootId}/messages", h.GetThreadMessages).Methods("GET", "OPTIONS")
+	chat.HandleFunc("/threads/{rootId}/read", h.MarkThreadRead).Methods("POST", "OPTIONS")
+
+	// Администрирование групп
+	chat.HandleFunc("/members", h.GetChatMembers).Methods("GET", "OPTIONS")
+	chat.HandleFunc("/members", h.AddMembers).Methods("POST", "OPTIONS")
+	chat.HandleFunc("/members/{userId}", h.RemoveMember).Methods("DELETE", "OPTIONS")
+	chat.HandleFunc("/members/{userId}/role", h.SetMemberRole).Methods("PUT", "OPTIONS")
+	chat.HandleFunc("/owner", h.TransferOwnership).Methods("POST", "OPTIONS")
+	chat.HandleFunc("/leave", h.LeaveChat).Methods("POST", "OPTIONS")
+	chat.HandleFunc("/name", h.RenameChat).Methods("PUT", "OPTIONS")
+	chat.HandleFunc("/avatar", h.SetChatAvatar).Methods("PUT", "OPTIONS")
+	chat.HandleFunc("/avatar", h.DeleteChatAvatar).Methods("DELETE", "OPTIONS")
+	chat.HandleFunc("/permissions", h.SetPermissions).Methods("PUT", "OPTIONS")
+	chat.HandleFunc("/ttl", h.SetMessageTTL).Methods("PUT", "OPTIONS")
+
+	// Закреплённые сообщения
+	chat.HandleFunc("/pins", h.GetPins).Methods("GET", "OPTIONS")
+	chat.HandleFunc("/pins/{messageId}", h.PinMessage).Methods("PUT", "OPTIONS")
+	chat.HandleFunc("/pins/{messageId}", h.UnpinMessage).Methods("DELETE", "OPTIONS")
+
+	// Ссылки-приглашения и заявки на вступление
+	chat.HandleFunc("/invites", h.ListInvites).Methods("GET", "OPTIONS")
+	chat.HandleFunc("/invites", h.CreateInvite).Methods("POST", "OPTIONS")
+	chat.HandleFunc("/invites/{code}", h.RevokeInvite).Methods("DELETE", "OPTIONS")
+	chat.HandleFunc("/join-requests", h.ListJoinRequests).Methods("GET", "OPTIONS")
+	chat.HandleFunc("/join-requests/{userId}/approve", h.ApproveJoinRequest).Methods("POST", "OPTIONS")
+	chat.HandleFunc("/join-requests/{userId}", h.DeclineJoinRequest).Methods("DELETE", "OPTIONS")
 
 	// Медиа
 	r.HandleFunc("/api/media/{filename}", h.ServeMedia).Methods("GET")
@@ -89,9 +161,79 @@ func (h *ChatHandler) extractUserIDFromAuth(r *http.Request) (int, error) {
 	if userID == 0 {
 		return 0, fmt.Errorf("invalid user_id in token")
 	}
+	logger.With(r.Context(), "user_id", userID)
 	return userID, nil
 }
 
+type ctxKey int
+
+const callerIDKey ctxKey = iota
+
+// requireChatMember — единая авторизация маршрутов /api/chats/{chatId}/...:
+// определяет пользователя по токену и пропускает только участников чата.
+// Обработчики берут пользователя через callerID.
+func (h *ChatHandler) requireChatMember(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		userID, err := h.extractUserIDFromAuth(r)
+		if err != nil {
+			respondWithError(w, http.StatusUnauthorized, "unauthorized", err.Error())
+			return
+		}
+
+		chatID := mux.Vars(r)["chatId"]
+		if _, err := uuid.Parse(chatID); err != nil {
+			respondWithError(w, http.StatusNotFound, "chat_not_found", "Chat not found")
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 3*time.Second)
+		defer cancel()
+
+		isMember, err := h.db.IsMember(ctx, chatID, userID)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "database_error", "Failed to check membership")
+			return
+		}
+		if !isMember {
+			respondWithError(w, http.StatusForbidden, "forbidden", "You are not a member of this chat")
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), callerIDKey, userID)))
+	})
+}
+
+// callerID возвращает пользователя, прошедшего requireChatMember.
+func callerID(r *http.Request) int {
+	userID, _ := r.Context().Value(callerIDKey).(int)
+	return userID
+}
+
+// mediaURL — подписанная ссылка на файл, выданный участнику чата chatID.
+func (h *ChatHandler) mediaURL(chatID, storeName string) string {
+	return h.config.Media.BaseURL + "/media/" + storeName + "?" + h.mediaURLs.Sign(chatID, storeName).Encode()
+}
+
+// runEvery вызывает fn каждые interval, пока ctx не отменён.
+func runEvery(ctx context.Context, interval time.Duration, fn func(ctx context.Context)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			fn(ctx)
+		}
+	}
+}
+
 func (h *ChatHandler) getPaginationParams(r *http.Request) (limit, offset int) {
 	limit = 50
 	if l, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && l > 0 && l <= 200 {
@@ -103,6 +245,19 @@ func (h *ChatHandler) getPaginationParams(r *http.Request) (limit, offset int) {
 	return
 }
 
+// getCursorParam разбирает ?cursor=; пустое значение — первая страница (nil).
+func getCursorParam(r *http.Request) (*db.Cursor, error) {
+	s := r.URL.Query().Get("cursor")
+	if s == "" {
+		return nil, nil
+	}
+	cur, err := db.ParseCursor(s)
+	if err != nil {
+		return nil, err
+	}
+	return &cur, nil
+}
+
 func respondWithJSON(w http.ResponseWriter, statusCode int, payload interface{}) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(statusCode)
@@ -4,12 +4,13 @@ package handlers
 import (
 	"context"
 	"encoding/json"
-	"log"
+	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
 	"time"
 
+	"Chat_Service/logger"
 	"Chat_Service/models"
 
 	"github.com/gorilla/mux"
@@ -24,8 +25,9 @@ func (h *ChatHandler) CreateChat(w http.ResponseWriter, r *http.Request) {
 
 	var body struct {
 		ToID      int    `json:"to_id"`      // для direct
-		Name      string `json:"name"`       // для group
-		MemberIDs []int  `json:"member_ids"` // для group
+		Type      string `json:"type"`       // group (по умолчанию при member_ids) или channel
+		Name      string `json:"name"`       // для group/channel
+		MemberIDs []int  `json:"member_ids"` // для group; в канале — необязательные подписчики
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
@@ -33,14 +35,23 @@ func (h *ChatHandler) CreateChat(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// ── GROUP ──────────────────────────────────────────────────────────
-	if len(body.MemberIDs) > 0 {
-		if strings.TrimSpace(body.Name) == "" {
-			respondWithError(w, http.StatusBadRequest, "validation_error", "name required")
+	// ── GROUP / CHANNEL ────────────────────────────────────────────────
+	if body.Type == models.ChatTypeChannel || len(body.MemberIDs) > 0 {
+		chatType := models.ChatTypeGroup
+		minMembers, maxMembers := 2, min(h.config.Chats.MaxGroupMembers-1, models.MaxMembersPerRequest)
+		if body.Type == models.ChatTypeChannel {
+			chatType = models.ChatTypeChannel
+			minMembers, maxMembers = 0, models.MaxMembersPerRequest
+		}
+
+		name := strings.TrimSpace(body.Name)
+		if name == "" || len(name) > models.MaxChatNameLength {
+			respondWithError(w, http.StatusBadRequest, "validation_error", "name must be between 1 and 100 characters")
 			return
 		}
-		if len(body.MemberIDs) < 2 || len(body.MemberIDs) > 9 {
-			respondWithError(w, http.StatusBadRequest, "validation_error", "member_ids must be between 2 and 9")
+		if len(body.MemberIDs) < minMembers || len(body.MemberIDs) > maxMembers {
+			respondWithError(w, http.StatusBadRequest, "validation_error",
+				fmt.Sprintf("member_ids must be between %d and %d", minMembers, maxMembers))
 			return
 		}
 
@@ -56,24 +67,24 @@ func (h *ChatHandler) CreateChat(w http.ResponseWriter, r *http.Request) {
 		ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 		defer cancel()
 
-		chatID, err := h.db.CreateChat(ctx, members, true, "group", strings.TrimSpace(body.Name))
+		chatID, err := h.db.CreateChat(ctx, members, true, chatType, name)
 		if err != nil {
 			respondWithError(w, http.StatusInternalServerError, "database_error", "Failed to create group chat")
 			return
 		}
 
-		h.hub.SendToUsers(members, models.WSMessage{
+		h.hub.SendToUsers(ctx, members, models.WSMessage{
 			Event: "chat:created",
 			Data:  map[string]string{"chatId": chatID},
 		})
 
-		log.Printf("Group chat created: %s %q %v", chatID, body.Name, members)
+		logger.From(ctx).Info("group chat created", "chat_id", chatID, "type", chatType, "members", len(members))
 		respondWithJSON(w, http.StatusCreated, models.Chat{
 			ID:      chatID,
 			Members: members,
 			Active:  true,
-			Type:    "group",
-			Name:    strings.TrimSpace(body.Name),
+			Type:    chatType,
+			Name:    name,
 		})
 		return
 	}
@@ -105,18 +116,18 @@ func (h *ChatHandler) CreateChat(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	chatID, err := h.db.CreateChat(ctx, []int{fromID, body.ToID}, true, "direct", "")
+	chatID, err := h.db.CreateChat(ctx, []int{fromID, body.ToID}, true, models.ChatTypeDirect, "")
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "database_error", "Failed to create chat")
 		return
 	}
 
-	h.hub.SendToUsers([]int{fromID, body.ToID}, models.WSMessage{
+	h.hub.SendToUsers(ctx, []int{fromID, body.ToID}, models.WSMessage{
 		Event: "chat:created",
 		Data:  map[string]string{"chatId": chatID},
 	})
 
-	log.Printf("Chat created: %s [%d, %d]", chatID, fromID, body.ToID)
+	logger.From(ctx).Info("direct chat created", "chat_id", chatID, "peer_id", body.ToID)
 	respondWithJSON(w, http.StatusCreated, models.Chat{
 		ID:      chatID,
 		Members: []int{fromID, body.ToID},
@@ -134,48 +145,150 @@ func (h *ChatHandler) GetChats(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
 
+	// С параметром cursor — постраничный ответ {chats, nextCursor},
+	// без него — весь список массивом, как раньше
+	if r.URL.Query().Has("cursor") {
+		h.getChatsPage(ctx, w, r, userID)
+		return
+	}
+
 	chats, err := h.db.GetUserChats(ctx, userID)
 	if err != nil {
-		log.Printf("GetUserChats error: %v", err)
+		logger.From(ctx).Error("get user chats", "error", err)
 		respondWithError(w, http.StatusInternalServerError, "database_error", "Failed to get chats")
 		return
 	}
 
+	h.fillChatAvatars(chats)
 	respondWithJSON(w, http.StatusOK, chats)
 }
 
+func (h *ChatHandler) getChatsPage(ctx context.Context, w http.ResponseWriter, r *http.Request, userID int) {
+	cur, err := getCursorParam(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "invalid_cursor", err.Error())
+		return
+	}
+	limit, _ := h.getPaginationParams(r)
+
+	page, err := h.db.GetUserChatsPage(ctx, userID, cur, limit)
+	if err != nil {
+		logger.From(ctx).Error("get user chats", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "database_error", "Failed to get chats")
+		return
+	}
+
+	h.fillChatAvatars(page.Chats)
+	respondWithJSON(w, http.StatusOK, page)
+}
+
+func (h *ChatHandler) fillChatAvatars(chats []models.ChatListItem) {
+	for i := range chats {
+		if chats[i].Avatar != "" {
+			chats[i].AvatarURL = h.mediaURL(chats[i].ChatID, chats[i].Avatar)
+		}
+	}
+}
+
 func (h *ChatHandler) GetChatInfo(w http.ResponseWriter, r *http.Request) {
 	chatID := mux.Vars(r)["chatId"]
 
-	ctx, cancel := context.WithTimeout(r.Context(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
 
-	members, err := h.db.GetChatMembers(ctx, chatID)
-	if err != nil || len(members) == 0 {
+	chat, err := h.db.GetChat(ctx, chatID)
+	if err != nil {
 		respondWithError(w, http.StatusNotFound, "chat_not_found", "Chat not found")
 		return
 	}
+	role, memberCount, err := h.db.GetMemberRole(ctx, chatID, callerID(r))
+	if err != nil {
+		logger.From(ctx).Error("get member role", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "database_error", "Failed to get chat")
+		return
+	}
 
-	onlineStatus := make(map[int]bool, len(members))
-	for _, uid := range members {
-		onlineStatus[uid] = h.hub.IsUserOnline(uid)
+	// Участников групп и каналов отдаёт постранично GET /members,
+	// в direct чате оба участника приходят сразу
+	members := []int{}
+	onlineStatus := map[int]bool{}
+	if chat.Type == models.ChatTypeDirect {
+		page, _, err := h.db.GetChatMembersPage(ctx, chatID, 2, 0)
+		if err != nil {
+			logger.From(ctx).Error("get chat members", "error", err)
+			respondWithError(w, http.StatusInternalServerError, "database_error", "Failed to get chat")
+			return
+		}
+		for _, m := range page {
+			members = append(members, m.UserID)
+			onlineStatus[m.UserID] = h.hub.IsUserOnline(m.UserID)
+		}
 	}
 
-	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+	info := map[string]interface{}{
 		"chatId":       chatID,
+		"type":         chat.Type,
+		"name":         chat.Name,
+		"role":         role,
+		"memberCount":  memberCount,
 		"members":      members,
 		"onlineStatus": onlineStatus,
-	})
+		"permissions":  chat.Permissions,
+		"messageTtl":   chat.MessageTTL,
+	}
+	if chat.Avatar != "" {
+		info["avatarUrl"] = h.mediaURL(chatID, chat.Avatar)
+	}
+	// В каналах подписчиков слишком много, а их прочтение не показывается
+	if chat.Type != models.ChatTypeChannel {
+		cursors, err := h.db.GetReadCursors(ctx, chatID)
+		if err != nil {
+			logger.From(ctx).Error("get read cursors", "error", err)
+			respondWithError(w, http.StatusInternalServerError, "database_error", "Failed to get chat")
+			return
+		}
+		info["readCursors"] = cursors
+	}
+
+	pins, err := h.loadPins(ctx, chatID, callerID(r))
+	if err != nil {
+		logger.From(ctx).Error("get pins", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "database_error", "Failed to get chat")
+		return
+	}
+	info["pins"] = pins
+	respondWithJSON(w, http.StatusOK, info)
 }
 
-func (h *ChatHandler) MarkRead(w http.ResponseWriter, r *http.Request) {
+// GetChatMembers — постраничный список участников (?limit=&offset=) с ролями и онлайном.
+func (h *ChatHandler) GetChatMembers(w http.ResponseWriter, r *http.Request) {
 	chatID := mux.Vars(r)["chatId"]
+	limit, offset := h.getPaginationParams(r)
 
-	userID, err := h.extractUserIDFromAuth(r)
+	ctx, cancel := context.WithTimeout(r.Context(), 3*time.Second)
+	defer cancel()
+
+	members, total, err := h.db.GetChatMembersPage(ctx, chatID, limit, offset)
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "unauthorized", err.Error())
+		logger.From(ctx).Error("get chat members", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "database_error", "Failed to get members")
 		return
 	}
+	for i := range members {
+		members[i].Online = h.hub.IsUserOnline(members[i].UserID)
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"members": members,
+		"total":   total,
+		"hasMore": offset+len(members) < total,
+	})
+}
+
+func (h *ChatHandler) MarkRead(w http.ResponseWriter, r *http.Request) {
+	chatID := mux.Vars(r)["chatId"]
+
+	userID := callerID(r)
 
 	var body struct {
 		LastMessageID string `json:"lastMessageId"`
@@ -188,14 +301,44 @@ func (h *ChatHandler) MarkRead(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
 
-	if err := h.db.MarkChatRead(ctx, chatID, userID, body.LastMessageID); err != nil {
+	moved, err := h.db.MarkChatRead(ctx, chatID, userID, body.LastMessageID)
+	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "database_error", "Failed to mark read")
 		return
 	}
 
+	// Остальные участники видят ✓✓ у своих сообщений, другие устройства
+	// читателя — что чат прочитан
+	if moved {
+		h.hub.SendToChat(ctx, chatID, models.WSMessage{
+			Event: "chat:read",
+			Data:  map[string]interface{}{"chatId": chatID, "userId": userID, "messageId": body.LastMessageID},
+		})
+	}
+	// Отметка «непрочитано» снимается любым прочтением, даже без сдвига курсора
+	h.clearMarkedUnread(ctx, chatID, userID)
+
 	respondWithJSON(w, http.StatusOK, models.SuccessResponse{Status: "ok"})
 }
 
+// GetSeenBy — кто из участников прочитал сообщение (?limit=&offset=).
+func (h *ChatHandler) GetSeenBy(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	limit, offset := h.getPaginationParams(r)
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	userIDs, err := h.db.GetSeenBy(ctx, vars["chatId"], vars["messageId"], limit, offset)
+	if err != nil {
+		logger.From(ctx).Error("get seen by", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "database_error", "Failed to get seen by")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{"userIds": userIDs})
+}
+
 func (h *ChatHandler) DeleteMembersByUserID(w http.ResponseWriter, r *http.Request) {
 	userIDStr := mux.Vars(r)["userId"]
 	userID, err := strconv.Atoi(userIDStr)
@@ -213,7 +356,7 @@ func (h *ChatHandler) DeleteMembersByUserID(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	log.Printf("Deleted %d chat_members for userID=%d", rows, userID)
+	logger.From(ctx).Info("chat members deleted", "target_user_id", userID, "rows", rows)
 	respondWithJSON(w, http.StatusOK, map[string]interface{}{
 		"userId":       userID,
 		"rowsAffected": rows,
@@ -0,0 +1,86 @@
+// Chat_Service/handlers/drafts.go
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"Chat_Service/db"
+	"Chat_Service/logger"
+	"Chat_Service/models"
+
+	"github.com/gorilla/mux"
+)
+
+// draft:updated получают все устройства пользователя; draft = null — черновик удалён.
+const eventDraftUpdated = "draft:updated"
+
+// SaveDraft — PUT /draft {text, replyToId?}; пустой черновик удаляется.
+// Тот же черновик можно сохранять по WS событием draft:save.
+func (h *ChatHandler) SaveDraft(w http.ResponseWriter, r *http.Request) {
+	chatID := mux.Vars(r)["chatId"]
+	userID := callerID(r)
+
+	var req models.SaveDraftRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "invalid_request", "Invalid JSON")
+		return
+	}
+	if err := req.Validate(); err != nil {
+		respondWithError(w, http.StatusBadRequest, "validation_error", err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	if req.Empty() {
+		h.clearDraft(ctx, chatID, userID)
+		respondWithJSON(w, http.StatusOK, map[string]interface{}{"draft": nil})
+		return
+	}
+
+	draft, err := h.db.SaveDraft(ctx, chatID, userID, req.Text, req.ReplyToID)
+	switch {
+	case errors.Is(err, db.ErrMessageNotFound):
+		respondWithError(w, http.StatusNotFound, "message_not_found", "Reply target not found")
+		return
+	case err != nil:
+		logger.From(ctx).Error("save draft", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "database_error", "Failed to save draft")
+		return
+	}
+
+	h.hub.SendToUser(ctx, userID, models.WSMessage{
+		Event: eventDraftUpdated,
+		Data:  map[string]interface{}{"chatId": chatID, "draft": draft},
+	})
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{"draft": draft})
+}
+
+func (h *ChatHandler) DeleteDraft(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	h.clearDraft(ctx, mux.Vars(r)["chatId"], callerID(r))
+	respondWithJSON(w, http.StatusOK, models.SuccessResponse{Status: "ok"})
+}
+
+// clearDraft удаляет черновик и сообщает об этом устройствам пользователя.
+// Вызывается и после отправки сообщения в чат: отправленный текст больше не черновик.
+func (h *ChatHandler) clearDraft(ctx context.Context, chatID string, userID int) {
+	deleted, err := h.db.DeleteDraft(ctx, chatID, userID)
+	if err != nil {
+		logger.From(ctx).Error("delete draft", "error", err)
+		return
+	}
+	if deleted {
+		h.hub.SendToUser(ctx, userID, models.WSMessage{
+			Event: eventDraftUpdated,
+			Data:  map[string]interface{}{"chatId": chatID, "draft": nil},
+		})
+	}
+}
@@ -0,0 +1,326 @@
+// Chat_Service/handlers/groups.go
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"Chat_Service/db"
+	"Chat_Service/logger"
+	"Chat_Service/models"
+
+	"github.com/gorilla/mux"
+)
+
+// WS события администрирования групп
+const (
+	eventMemberAdded   = "chat:member_added"
+	eventMemberRemoved = "chat:member_removed"
+	eventMemberLeft    = "chat:member_left"
+	eventChatRenamed   = "chat:renamed"
+	eventAvatarChanged = "chat:avatar_changed"
+	eventRoleChanged   = "chat:role_changed"
+	eventOwnerChanged  = "chat:owner_changed"
+)
+
+func (h *ChatHandler) AddMembers(w http.ResponseWriter, r *http.Request) {
+	chatID := mux.Vars(r)["chatId"]
+	userID := callerID(r)
+
+	var req models.AddMembersRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "invalid_request", "Invalid JSON")
+		return
+	}
+	if err := req.Validate(); err != nil {
+		respondWithError(w, http.StatusBadRequest, "validation_error", err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	added, msg, err := h.db.AddMembers(ctx, chatID, userID, req.UserIDs, h.config.Chats.MaxGroupMembers)
+	if err != nil {
+		h.respondWithGroupError(ctx, w, err)
+		return
+	}
+
+	if len(added) > 0 {
+		h.broadcastGroupChange(ctx, chatID, userID, msg, eventMemberAdded, map[string]interface{}{
+			"userIds": added,
+		})
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"added":   added,
+		"message": msg,
+	})
+}
+
+func (h *ChatHandler) RemoveMember(w http.ResponseWriter, r *http.Request) {
+	chatID := mux.Vars(r)["chatId"]
+	userID := callerID(r)
+
+	targetID, err := strconv.Atoi(mux.Vars(r)["userId"])
+	if err != nil || targetID == 0 {
+		respondWithError(w, http.StatusBadRequest, "invalid_request", "Valid user ID required")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	msg, err := h.db.RemoveMember(ctx, chatID, userID, targetID)
+	if err != nil {
+		h.respondWithGroupError(ctx, w, err)
+		return
+	}
+
+	// Исключённый уже не участник — уведомляем его отдельно
+	h.broadcastGroupChange(ctx, chatID, userID, msg, eventMemberRemoved, map[string]interface{}{
+		"userId": targetID,
+	}, targetID)
+
+	respondWithJSON(w, http.StatusOK, msg)
+}
+
+func (h *ChatHandler) LeaveChat(w http.ResponseWriter, r *http.Request) {
+	chatID := mux.Vars(r)["chatId"]
+	userID := callerID(r)
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	msg, err := h.db.LeaveChat(ctx, chatID, userID)
+	if err != nil {
+		h.respondWithGroupError(ctx, w, err)
+		return
+	}
+
+	h.broadcastGroupChange(ctx, chatID, userID, msg, eventMemberLeft, map[string]interface{}{
+		"userId": userID,
+	}, userID)
+
+	respondWithJSON(w, http.StatusOK, models.SuccessResponse{Status: "ok"})
+}
+
+func (h *ChatHandler) RenameChat(w http.ResponseWriter, r *http.Request) {
+	chatID := mux.Vars(r)["chatId"]
+	userID := callerID(r)
+
+	var req models.RenameChatRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "invalid_request", "Invalid JSON")
+		return
+	}
+	if err := req.Validate(); err != nil {
+		respondWithError(w, http.StatusBadRequest, "validation_error", err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	msg, err := h.db.RenameChat(ctx, chatID, userID, req.Name)
+	if err != nil {
+		h.respondWithGroupError(ctx, w, err)
+		return
+	}
+
+	h.broadcastGroupChange(ctx, chatID, userID, msg, eventChatRenamed, map[string]interface{}{
+		"name": req.Name,
+	})
+
+	respondWithJSON(w, http.StatusOK, msg)
+}
+
+// SetChatAvatar принимает изображение в поле формы "file".
+func (h *ChatHandler) SetChatAvatar(w http.ResponseWriter, r *http.Request) {
+	chatID := mux.Vars(r)["chatId"]
+	userID := callerID(r)
+
+	r.Body = http.MaxBytesReader(w, r.Body, h.config.Media.MaxFileSize)
+	if err := r.ParseMultipartForm(h.config.Media.MaxFileSize); err != nil {
+		respondWithError(w, http.StatusBadRequest, "file_too_large", "Request too large")
+		return
+	}
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "invalid_request", "file required")
+		return
+	}
+	saved, err := h.storage.Save(file, header)
+	file.Close()
+	if err != nil {
+		logger.From(r.Context()).Error("save avatar failed", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "storage_error", "Failed to save file")
+		return
+	}
+	storeName := saved.ID + getExt(saved.FileName)
+	if !strings.HasPrefix(saved.MimeType, "image/") {
+		h.storage.Delete(storeName)
+		respondWithError(w, http.StatusBadRequest, "invalid_file", "Avatar must be an image")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	h.updateChatAvatar(ctx, w, chatID, userID, storeName)
+}
+
+func (h *ChatHandler) DeleteChatAvatar(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	h.updateChatAvatar(ctx, w, mux.Vars(r)["chatId"], callerID(r), "")
+}
+
+// updateChatAvatar сохраняет новый аватар (пустой — снять) и удаляет файл прежнего.
+func (h *ChatHandler) updateChatAvatar(ctx context.Context, w http.ResponseWriter, chatID string, userID int, storeName string) {
+	old, msg, err := h.db.SetChatAvatar(ctx, chatID, userID, storeName)
+	if err != nil {
+		if storeName != "" {
+			h.storage.Delete(storeName)
+		}
+		h.respondWithGroupError(ctx, w, err)
+		return
+	}
+	if old != "" {
+		h.storage.Delete(old)
+	}
+
+	var avatarURL string
+	if storeName != "" {
+		avatarURL = h.mediaURL(chatID, storeName)
+	}
+	h.broadcastGroupChange(ctx, chatID, userID, msg, eventAvatarChanged, map[string]interface{}{
+		"avatarUrl": avatarURL,
+	})
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"avatarUrl": avatarURL,
+		"message":   msg,
+	})
+}
+
+func (h *ChatHandler) SetMemberRole(w http.ResponseWriter, r *http.Request) {
+	chatID := mux.Vars(r)["chatId"]
+	userID := callerID(r)
+
+	targetID, err := strconv.Atoi(mux.Vars(r)["userId"])
+	if err != nil || targetID == 0 {
+		respondWithError(w, http.StatusBadRequest, "invalid_request", "Valid user ID required")
+		return
+	}
+
+	var req models.SetRoleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "invalid_request", "Invalid JSON")
+		return
+	}
+	if err := req.Validate(); err != nil {
+		respondWithError(w, http.StatusBadRequest, "validation_error", err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	msg, err := h.db.SetMemberRole(ctx, chatID, userID, targetID, req.Role)
+	if err != nil {
+		h.respondWithGroupError(ctx, w, err)
+		return
+	}
+
+	// nil — роль и так была такой
+	if msg != nil {
+		h.broadcastGroupChange(ctx, chatID, userID, msg, eventRoleChanged, map[string]interface{}{
+			"userId": targetID,
+			"role":   req.Role,
+		})
+	}
+
+	respondWithJSON(w, http.StatusOK, models.SuccessResponse{Status: "ok", Data: msg})
+}
+
+func (h *ChatHandler) TransferOwnership(w http.ResponseWriter, r *http.Request) {
+	chatID := mux.Vars(r)["chatId"]
+	userID := callerID(r)
+
+	var req models.TransferOwnershipRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.UserID == 0 {
+		respondWithError(w, http.StatusBadRequest, "invalid_request", "userId required")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	msg, err := h.db.TransferOwnership(ctx, chatID, userID, req.UserID)
+	if err != nil {
+		h.respondWithGroupError(ctx, w, err)
+		return
+	}
+
+	h.broadcastGroupChange(ctx, chatID, userID, msg, eventOwnerChanged, map[string]interface{}{
+		"userId":        req.UserID,
+		"previousOwner": userID,
+	})
+
+	respondWithJSON(w, http.StatusOK, msg)
+}
+
+// broadcastGroupChange рассылает событие об изменении группы текущим участникам
+// и extra (тем, кто только что из неё вышел), а системное сообщение — как message:new
+// всем участникам, включая другие устройства автора действия.
+func (h *ChatHandler) broadcastGroupChange(ctx context.Context, chatID string, actorID int, msg *models.Message, event string, data map[string]interface{}, extra ...int) {
+	data["chatId"] = chatID
+	data["actorId"] = actorID
+	change := models.WSMessage{Event: event, Data: data}
+	h.hub.SendToChat(ctx, chatID, change)
+	if len(extra) > 0 {
+		h.hub.SendToUsers(ctx, extra, change)
+	}
+
+	if msg != nil {
+		h.hub.SendToChat(ctx, chatID, models.WSMessage{Event: "message:new", Data: msg})
+	}
+}
+
+// respondWithGroupError переводит ошибки db администрирования групп
+// (и действий, зависящих от роли) в HTTP ответ.
+func (h *ChatHandler) respondWithGroupError(ctx context.Context, w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, db.ErrNoPermission):
+		respondWithError(w, http.StatusForbidden, "forbidden", err.Error())
+	case errors.Is(err, db.ErrNotGroup):
+		respondWithError(w, http.StatusBadRequest, "not_group", err.Error())
+	case errors.Is(err, db.ErrNotMember):
+		respondWithError(w, http.StatusNotFound, "member_not_found", err.Error())
+	case errors.Is(err, db.ErrGroupFull):
+		respondWithError(w, http.StatusConflict, "group_full", err.Error())
+	case errors.Is(err, db.ErrOwnerMustTransfer):
+		respondWithError(w, http.StatusConflict, "owner_must_transfer", err.Error())
+	case errors.Is(err, db.ErrInviteNotFound):
+		respondWithError(w, http.StatusNotFound, "invite_not_found", err.Error())
+	case errors.Is(err, db.ErrInviteInvalid):
+		respondWithError(w, http.StatusGone, "invite_expired", err.Error())
+	case errors.Is(err, db.ErrJoinRequestNotFound):
+		respondWithError(w, http.StatusNotFound, "join_request_not_found", err.Error())
+	case errors.Is(err, db.ErrMessageNotFound):
+		respondWithError(w, http.StatusNotFound, "message_not_found", err.Error())
+	case errors.Is(err, db.ErrTooManyPins):
+		respondWithError(w, http.StatusConflict, "too_many_pins", err.Error())
+	default:
+		logger.From(ctx).Error("group update failed", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "database_error", "Failed to update group")
+	}
+}
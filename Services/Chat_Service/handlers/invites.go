@@ -0,0 +1,198 @@
+// Chat_Service/handlers/invites.go
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"Chat_Service/models"
+
+	"github.com/gorilla/mux"
+)
+
+// WS события вступления по ссылке
+const (
+	eventMemberJoined = "chat:member_joined"
+	eventJoinRequest  = "chat:join_request"
+	eventJoinDeclined = "chat:join_declined"
+)
+
+func (h *ChatHandler) CreateInvite(w http.ResponseWriter, r *http.Request) {
+	chatID := mux.Vars(r)["chatId"]
+	userID := callerID(r)
+
+	var req models.CreateInviteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "invalid_request", "Invalid JSON")
+		return
+	}
+	if err := req.Validate(); err != nil {
+		respondWithError(w, http.StatusBadRequest, "validation_error", err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	invite, err := h.db.CreateInvite(ctx, chatID, userID, req)
+	if err != nil {
+		h.respondWithGroupError(ctx, w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, invite)
+}
+
+func (h *ChatHandler) ListInvites(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	invites, err := h.db.ListInvites(ctx, mux.Vars(r)["chatId"], callerID(r))
+	if err != nil {
+		h.respondWithGroupError(ctx, w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, invites)
+}
+
+func (h *ChatHandler) RevokeInvite(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	if err := h.db.RevokeInvite(ctx, vars["chatId"], callerID(r), vars["code"]); err != nil {
+		h.respondWithGroupError(ctx, w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, models.SuccessResponse{Status: "ok"})
+}
+
+// PreviewInvite показывает группу по ссылке до вступления.
+func (h *ChatHandler) PreviewInvite(w http.ResponseWriter, r *http.Request) {
+	if _, err := h.extractUserIDFromAuth(r); err != nil {
+		respondWithError(w, http.StatusUnauthorized, "unauthorized", err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	preview, err := h.db.GetInvitePreview(ctx, mux.Vars(r)["code"])
+	if err != nil {
+		h.respondWithGroupError(ctx, w, err)
+		return
+	}
+	if preview.Avatar != "" {
+		preview.AvatarURL = h.mediaURL(preview.ChatID, preview.Avatar)
+	}
+
+	respondWithJSON(w, http.StatusOK, preview)
+}
+
+// JoinChat вступает в чат по ссылке или подаёт заявку, если нужно одобрение.
+func (h *ChatHandler) JoinChat(w http.ResponseWriter, r *http.Request) {
+	userID, err := h.extractUserIDFromAuth(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "unauthorized", err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	result, err := h.db.JoinByInvite(ctx, mux.Vars(r)["code"], userID, h.config.Chats.MaxGroupMembers)
+	if err != nil {
+		h.respondWithGroupError(ctx, w, err)
+		return
+	}
+
+	switch result.Status {
+	case models.JoinStatusJoined:
+		h.broadcastGroupChange(ctx, result.ChatID, userID, result.Message, eventMemberJoined, map[string]interface{}{
+			"userId": userID,
+		})
+		respondWithJSON(w, http.StatusOK, result)
+
+	case models.JoinStatusPending:
+		if managers, err := h.db.GetChatManagers(ctx, result.ChatID); err == nil {
+			h.hub.SendToUsers(ctx, managers, models.WSMessage{
+				Event: eventJoinRequest,
+				Data:  map[string]interface{}{"chatId": result.ChatID, "userId": userID},
+			})
+		}
+		respondWithJSON(w, http.StatusAccepted, result)
+
+	default:
+		respondWithJSON(w, http.StatusOK, result)
+	}
+}
+
+func (h *ChatHandler) ListJoinRequests(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	requests, err := h.db.ListJoinRequests(ctx, mux.Vars(r)["chatId"], callerID(r))
+	if err != nil {
+		h.respondWithGroupError(ctx, w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, requests)
+}
+
+func (h *ChatHandler) ApproveJoinRequest(w http.ResponseWriter, r *http.Request) {
+	chatID := mux.Vars(r)["chatId"]
+	actorID := callerID(r)
+
+	userID, err := strconv.Atoi(mux.Vars(r)["userId"])
+	if err != nil || userID == 0 {
+		respondWithError(w, http.StatusBadRequest, "invalid_request", "Valid user ID required")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	msg, err := h.db.ApproveJoinRequest(ctx, chatID, actorID, userID, h.config.Chats.MaxGroupMembers)
+	if err != nil {
+		h.respondWithGroupError(ctx, w, err)
+		return
+	}
+
+	h.broadcastGroupChange(ctx, chatID, actorID, msg, eventMemberAdded, map[string]interface{}{
+		"userIds": []int{userID},
+	})
+
+	respondWithJSON(w, http.StatusOK, msg)
+}
+
+func (h *ChatHandler) DeclineJoinRequest(w http.ResponseWriter, r *http.Request) {
+	chatID := mux.Vars(r)["chatId"]
+
+	userID, err := strconv.Atoi(mux.Vars(r)["userId"])
+	if err != nil || userID == 0 {
+		respondWithError(w, http.StatusBadRequest, "invalid_request", "Valid user ID required")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	if err := h.db.DeclineJoinRequest(ctx, chatID, callerID(r), userID); err != nil {
+		h.respondWithGroupError(ctx, w, err)
+		return
+	}
+
+	h.hub.SendToUser(ctx, userID, models.WSMessage{
+		Event: eventJoinDeclined,
+		Data:  map[string]string{"chatId": chatID},
+	})
+
+	respondWithJSON(w, http.StatusOK, models.SuccessResponse{Status: "ok"})
+}
@@ -0,0 +1,33 @@
+// Chat_Service/handlers/mentions.go
+package handlers
+
+import (
+	"context"
+
+	"Chat_Service/models"
+)
+
+const eventMentionNew = "mention:new"
+
+// notifyMentions отдельно сообщает упомянутым в msg (кроме автора) об упоминании.
+func (h *ChatHandler) notifyMentions(ctx context.Context, msg *models.Message, userIDs []int) {
+	var targets []int
+	for _, id := range userIDs {
+		if id != msg.SenderID {
+			targets = append(targets, id)
+		}
+	}
+	if len(targets) == 0 {
+		return
+	}
+
+	data := map[string]interface{}{
+		"chatId":    msg.ChatID,
+		"messageId": msg.ID,
+		"senderId":  msg.SenderID,
+	}
+	if msg.ThreadRootID != nil {
+		data["threadRootId"] = *msg.ThreadRootID
+	}
+	h.hub.SendToUsers(ctx, targets, models.WSMessage{Event: eventMentionNew, Data: data})
+}
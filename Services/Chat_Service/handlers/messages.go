@@ -4,8 +4,9 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"mime/multipart"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -13,7 +14,10 @@ import (
 	"time"
 
 	"Chat_Service/db"
+	"Chat_Service/logger"
+	"Chat_Service/markup"
 	"Chat_Service/models"
+	"Chat_Service/storage"
 
 	"github.com/gorilla/mux"
 )
@@ -21,11 +25,7 @@ import (
 func (h *ChatHandler) SendMessage(w http.ResponseWriter, r *http.Request) {
 	chatID := mux.Vars(r)["chatId"]
 
-	userID, err := h.extractUserIDFromAuth(r)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "unauthorized", err.Error())
-		return
-	}
+	userID := callerID(r)
 
 	var req models.SendMessageRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -36,49 +36,79 @@ func (h *ChatHandler) SendMessage(w http.ResponseWriter, r *http.Request) {
 		respondWithError(w, http.StatusBadRequest, "validation_error", err.Error())
 		return
 	}
+	// Пустой clientMessageId — не ключ идемпотентности, как и в UploadFiles
+	if req.ClientMessageID != nil && *req.ClientMessageID == "" {
+		req.ClientMessageID = nil
+	}
 
 	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
 
-	isMember, err := h.db.IsMember(ctx, chatID, userID)
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "database_error", "Failed to check membership")
+	if !h.canPost(ctx, w, chatID, userID) {
 		return
 	}
-	if !isMember {
-		respondWithError(w, http.StatusForbidden, "forbidden", "You are not a member of this chat")
+
+	if req.SendAt != nil {
+		h.scheduleMessage(ctx, w, models.ScheduledMessage{
+			ChatID:          chatID,
+			SenderID:        userID,
+			Text:            req.Text,
+			ReplyToID:       req.ReplyToID,
+			ThreadRootID:    req.ThreadRootID,
+			ClientMessageID: req.ClientMessageID,
+		}, *req.SendAt)
 		return
 	}
 
-	msg, err := h.db.SaveMessage(ctx, chatID, userID, req.Text, req.ReplyToID)
+	text, entities := markup.Parse(req.Text)
+	msg, duplicate, err := h.db.SaveMessage(ctx, chatID, userID, text, entities, req.ReplyToID, req.ThreadRootID, req.ClientMessageID, nil)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "database_error", "Failed to save message")
+		h.respondWithSaveError(ctx, w, err)
+		return
+	}
+
+	// Повторная отправка того же clientMessageId — отдаём уже сохранённое
+	if duplicate {
+		h.respondWithStoredMessage(ctx, w, msg)
 		return
 	}
 
-	if activated, _ := h.db.ActivateChat(ctx, chatID); activated {
-		members, _ := h.db.GetChatMembers(ctx, chatID)
-		h.hub.SendToUsers(members, models.WSMessage{
+	h.publishMessage(ctx, msg)
+	// Черновик — общий для чата; ответ в ветке набирается отдельно
+	if msg.ThreadRootID == nil {
+		h.clearDraft(ctx, chatID, userID)
+	}
+
+	respondWithJSON(w, http.StatusCreated, msg)
+}
+
+// publishMessage рассылает только что сохранённое сообщение:
+// привязывает превью ссылки, активирует чат, шлёт message:new,
+// mention:new упомянутым и обновляет счётчик ветки. message:new получают
+// и устройства отправителя; отправившее узнаёт своё сообщение по id.
+func (h *ChatHandler) publishMessage(ctx context.Context, msg *models.Message) {
+	h.attachLinkPreview(ctx, msg)
+
+	if activated, _ := h.db.ActivateChat(ctx, msg.ChatID); activated {
+		h.hub.SendToChat(ctx, msg.ChatID, models.WSMessage{
 			Event: "chat:activated",
-			Data:  map[string]string{"chatId": chatID},
+			Data:  map[string]string{"chatId": msg.ChatID},
 		})
 	}
 
-	members, err := h.db.GetChatMembers(ctx, chatID)
-	if err == nil {
-		recipients := make([]int, 0, len(members)-1)
-		for _, uid := range members {
-			if uid != userID {
-				recipients = append(recipients, uid)
-			}
+	h.hub.SendToChat(ctx, msg.ChatID, models.WSMessage{
+		Event: "message:new",
+		Data:  msg,
+	})
+	h.notifyMentions(ctx, msg, markup.Mentions(msg.Entities))
+	h.broadcastThreadUpdate(ctx, msg.ChatID, msg.ThreadRootID)
+
+	// Без clientMessageId повторов не бывает, сообщение сохранено разосланным
+	if msg.ClientMessageID != nil {
+		if _, err := h.db.MarkMessagePublished(ctx, msg.ID); err != nil {
+			logger.From(ctx).Error("mark message published", "message_id", msg.ID, "error", err)
 		}
-		h.hub.SendToUsers(recipients, models.WSMessage{
-			Event: "message:new",
-			Data:  msg,
-		})
 	}
-
-	respondWithJSON(w, http.StatusCreated, msg)
 }
 
 func (h *ChatHandler) ForwardMessages(w http.ResponseWriter, r *http.Request) {
@@ -101,20 +131,26 @@ func (h *ChatHandler) ForwardMessages(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
 	defer cancel()
 
-	isMember, err := h.db.IsMember(ctx, req.ToChatID, userID)
-	if err != nil || !isMember {
-		respondWithError(w, http.StatusForbidden, "forbidden", "Not a member of target chat")
+	canPost, err := h.db.CanPost(ctx, req.ToChatID, userID)
+	if err != nil || !canPost {
+		respondWithError(w, http.StatusForbidden, "forbidden", "Not allowed to post in target chat")
 		return
 	}
 
 	var sentMessages []*models.Message
 
 	if req.CommentText != "" {
-		commentMsg, err := h.db.SaveMessage(ctx, req.ToChatID, userID, req.CommentText, nil)
+		text, entities := markup.Parse(req.CommentText)
+		commentMsg, _, err := h.db.SaveMessage(ctx, req.ToChatID, userID, text, entities, nil, nil, nil, nil)
+		if errors.Is(err, db.ErrInvalidMention) {
+			respondWithError(w, http.StatusBadRequest, "invalid_mention", err.Error())
+			return
+		}
 		if err != nil {
 			respondWithError(w, http.StatusInternalServerError, "database_error", "Failed to save comment")
 			return
 		}
+		h.attachLinkPreview(ctx, commentMsg)
 		sentMessages = append(sentMessages, commentMsg)
 	}
 
@@ -136,21 +172,17 @@ func (h *ChatHandler) ForwardMessages(w http.ResponseWriter, r *http.Request) {
 		}
 		if atts, ok := fwdAttsMap[msg.ID]; ok {
 			for j := range atts {
-				atts[j].URL = h.config.Media.BaseURL + "/media/" + atts[j].StoreName
+				atts[j].URL = h.mediaURL(req.ToChatID, atts[j].StoreName)
 			}
 			forwarded[i].ForwardedFrom.Attachments = atts
 		}
 	}
 
-	members, _ := h.db.GetChatMembers(ctx, req.ToChatID)
-	recipients := make([]int, 0)
-	for _, uid := range members {
-		if uid != userID {
-			recipients = append(recipients, uid)
-		}
-	}
 	for _, msg := range sentMessages {
-		h.hub.SendToUsers(recipients, models.WSMessage{Event: "message:new", Data: msg})
+		h.hub.SendToChat(ctx, req.ToChatID, models.WSMessage{Event: "message:new", Data: msg})
+	}
+	if req.CommentText != "" {
+		h.notifyMentions(ctx, sentMessages[0], markup.Mentions(sentMessages[0].Entities))
 	}
 
 	respondWithJSON(w, http.StatusCreated, sentMessages)
@@ -160,51 +192,124 @@ func (h *ChatHandler) EditMessage(w http.ResponseWriter, r *http.Request) {
 	chatID := mux.Vars(r)["chatId"]
 	messageID := mux.Vars(r)["messageId"]
 
-	userID, err := h.extractUserIDFromAuth(r)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "unauthorized", err.Error())
-		return
-	}
+	userID := callerID(r)
 
 	var req models.EditMessageRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Text == "" {
-		respondWithError(w, http.StatusBadRequest, "invalid_request", "text required")
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "invalid_request", "Invalid JSON")
+		return
+	}
+	if err := req.Validate(); err != nil {
+		respondWithError(w, http.StatusBadRequest, "validation_error", err.Error())
 		return
 	}
 
 	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
 
-	if err := h.db.EditMessage(ctx, messageID, userID, req.Text); err != nil {
-		respondWithError(w, http.StatusForbidden, "forbidden", err.Error())
+	text, entities := markup.Parse(req.Text)
+	editedAt, newMentions, changed, err := h.db.EditMessage(ctx, chatID, messageID, userID, text, entities,
+		h.config.Chats.EditWindow, h.config.Chats.MaxEdits)
+	switch {
+	case errors.Is(err, db.ErrMessageNotFound):
+		respondWithError(w, http.StatusNotFound, "message_not_found", err.Error())
+		return
+	case errors.Is(err, db.ErrNoPermission):
+		respondWithError(w, http.StatusForbidden, "forbidden", "Only the author can edit a message")
+		return
+	case errors.Is(err, db.ErrEditWindowExpired):
+		respondWithError(w, http.StatusForbidden, "edit_window_expired", err.Error())
+		return
+	case errors.Is(err, db.ErrTooManyEdits):
+		respondWithError(w, http.StatusConflict, "too_many_edits", err.Error())
+		return
+	case errors.Is(err, db.ErrInvalidMention):
+		respondWithError(w, http.StatusBadRequest, "invalid_mention", err.Error())
+		return
+	case err != nil:
+		logger.From(ctx).Error("edit message", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "database_error", "Failed to edit message")
 		return
 	}
 
-	members, _ := h.db.GetChatMembers(ctx, chatID)
-	h.hub.SendToUsers(members, models.WSMessage{
-		Event: "message:edited",
-		Data:  map[string]string{"chatId": chatID, "messageId": messageID, "text": req.Text},
-	})
+	if changed {
+		h.hub.SendToChat(ctx, chatID, models.WSMessage{
+			Event: "message:edited",
+			Data: map[string]interface{}{
+				"chatId":    chatID,
+				"messageId": messageID,
+				"text":      text,
+				"entities":  entities,
+				"editedAt":  models.UTCTime{Time: editedAt},
+			},
+		})
+		// Упомянутым впервые — как при новом сообщении
+		edited := &models.Message{ID: messageID, ChatID: chatID, SenderID: userID, Text: text, Entities: entities}
+		h.notifyMentions(ctx, edited, newMentions)
+		if h.attachLinkPreview(ctx, edited) {
+			h.broadcastLinkPreview(ctx, chatID, messageID, edited.LinkPreview)
+		}
+	}
 
 	respondWithJSON(w, http.StatusOK, models.SuccessResponse{Status: "ok"})
 }
 
-func (h *ChatHandler) DeleteMessage(w http.ResponseWriter, r *http.Request) {
-	chatID := mux.Vars(r)["chatId"]
-	messageID := mux.Vars(r)["messageId"]
+// GetMessageRevisions — GET /messages/{messageId}/revisions: прежние версии текста.
+func (h *ChatHandler) GetMessageRevisions(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
 
-	userID, err := h.extractUserIDFromAuth(r)
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	revisions, err := h.db.GetMessageRevisions(ctx, vars["chatId"], vars["messageId"])
+	if errors.Is(err, db.ErrMessageNotFound) {
+		respondWithError(w, http.StatusNotFound, "message_not_found", err.Error())
+		return
+	}
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "unauthorized", err.Error())
+		logger.From(ctx).Error("get revisions", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "database_error", "Failed to get revisions")
 		return
 	}
 
+	respondWithJSON(w, http.StatusOK, revisions)
+}
+
+// DeleteMessage — DELETE /messages/{messageId}?for=everyone|me.
+// everyone (по умолчанию) — удалить у всех, me — только скрыть у себя.
+func (h *ChatHandler) DeleteMessage(w http.ResponseWriter, r *http.Request) {
+	chatID := mux.Vars(r)["chatId"]
+	messageID := mux.Vars(r)["messageId"]
+
+	userID := callerID(r)
+
 	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
 
-	storeNames, err := h.db.DeleteMessage(ctx, messageID, userID)
-	if err != nil {
-		respondWithError(w, http.StatusForbidden, "forbidden", err.Error())
+	switch r.URL.Query().Get("for") {
+	case "", "everyone":
+	case "me":
+		h.hideMessage(ctx, w, chatID, messageID, userID)
+		return
+	default:
+		respondWithError(w, http.StatusBadRequest, "invalid_request", "for must be everyone or me")
+		return
+	}
+
+	storeNames, unpinned, threadRootID, err := h.db.DeleteMessageForEveryone(ctx, chatID, messageID, userID, h.config.Chats.DeleteWindow)
+	switch {
+	case errors.Is(err, db.ErrMessageNotFound):
+		respondWithError(w, http.StatusNotFound, "message_not_found", err.Error())
+		return
+	case errors.Is(err, db.ErrNoPermission):
+		respondWithError(w, http.StatusForbidden, "forbidden", "Not allowed to delete this message")
+		return
+	case errors.Is(err, db.ErrDeleteWindowExpired):
+		respondWithError(w, http.StatusForbidden, "delete_window_expired", err.Error())
+		return
+	case err != nil:
+		logger.From(ctx).Error("delete message", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "database_error", "Failed to delete message")
 		return
 	}
 
@@ -212,40 +317,75 @@ func (h *ChatHandler) DeleteMessage(w http.ResponseWriter, r *http.Request) {
 		h.storage.Delete(name)
 	}
 
-	members, _ := h.db.GetChatMembers(ctx, chatID)
-	h.hub.SendToUsers(members, models.WSMessage{
+	h.hub.SendToChat(ctx, chatID, models.WSMessage{
 		Event: "message:deleted",
 		Data:  map[string]string{"chatId": chatID, "messageId": messageID},
 	})
+	if unpinned {
+		h.hub.SendToChat(ctx, chatID, models.WSMessage{
+			Event: eventChatUnpinned,
+			Data:  map[string]interface{}{"chatId": chatID, "messageId": messageID, "userId": userID},
+		})
+	}
+	h.broadcastThreadUpdate(ctx, chatID, threadRootID)
 
 	respondWithJSON(w, http.StatusOK, models.SuccessResponse{Status: "ok"})
 }
 
-func (h *ChatHandler) GetMessages(w http.ResponseWriter, r *http.Request) {
-	chatID := mux.Vars(r)["chatId"]
-	if chatID == "" {
-		respondWithError(w, http.StatusBadRequest, "invalid_request", "Chat ID required")
+// hideMessage скрывает сообщение у пользователя; другие его сессии узнают об этом по WS.
+func (h *ChatHandler) hideMessage(ctx context.Context, w http.ResponseWriter, chatID, messageID string, userID int) {
+	err := h.db.HideMessage(ctx, chatID, messageID, userID)
+	if errors.Is(err, db.ErrMessageNotFound) {
+		respondWithError(w, http.StatusNotFound, "message_not_found", err.Error())
+		return
+	}
+	if err != nil {
+		logger.From(ctx).Error("hide message", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "database_error", "Failed to delete message")
 		return
 	}
 
+	h.hub.SendToUser(ctx, userID, models.WSMessage{
+		Event: "message:hidden",
+		Data:  map[string]string{"chatId": chatID, "messageId": messageID},
+	})
+
+	respondWithJSON(w, http.StatusOK, models.SuccessResponse{Status: "ok"})
+}
+
+// GetMessages — история чата. С ?cursor= (пустой — последние сообщения) отвечает
+// {messages, nextCursor, prevCursor}; без него — массивом по limit/offset, как раньше.
+func (h *ChatHandler) GetMessages(w http.ResponseWriter, r *http.Request) {
+	chatID := mux.Vars(r)["chatId"]
 	limit, offset := h.getPaginationParams(r)
 
 	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
 
-	exists, err := h.db.ChatExists(ctx, chatID)
-	if err != nil || !exists {
-		respondWithError(w, http.StatusNotFound, "chat_not_found", "Chat not found")
+	if r.URL.Query().Has("cursor") {
+		cur, err := getCursorParam(r)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "invalid_cursor", err.Error())
+			return
+		}
+		page, err := h.db.GetMessagesPage(ctx, chatID, callerID(r), cur, limit)
+		if err != nil {
+			logger.From(ctx).Error("get messages page", "error", err)
+			respondWithError(w, http.StatusInternalServerError, "database_error", "Failed to get messages")
+			return
+		}
+		h.enrichMessages(ctx, page.Messages, callerID(r))
+		respondWithJSON(w, http.StatusOK, page)
 		return
 	}
 
-	messages, err := h.db.GetChatMessages(ctx, chatID, limit, offset)
+	messages, err := h.db.GetChatMessages(ctx, chatID, callerID(r), limit, offset)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "database_error", "Failed to get messages")
 		return
 	}
 
-	h.enrichMessages(ctx, messages)
+	h.enrichMessages(ctx, messages, callerID(r))
 	respondWithJSON(w, http.StatusOK, messages)
 }
 
@@ -257,24 +397,20 @@ func (h *ChatHandler) GetMessagesContext(w http.ResponseWriter, r *http.Request)
 	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
 
-	messages, err := h.db.GetMessagesAroundID(ctx, chatID, messageID, 25)
+	messages, err := h.db.GetMessagesAroundID(ctx, chatID, callerID(r), messageID, 25)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "database_error", "Failed to get context")
 		return
 	}
 
-	h.enrichMessages(ctx, messages)
+	h.enrichMessages(ctx, messages, callerID(r))
 	respondWithJSON(w, http.StatusOK, messages)
 }
 
 func (h *ChatHandler) GetUnreadMessages(w http.ResponseWriter, r *http.Request) {
 	chatID := mux.Vars(r)["chatId"]
 
-	userID, err := h.extractUserIDFromAuth(r)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "unauthorized", err.Error())
-		return
-	}
+	userID := callerID(r)
 
 	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
@@ -295,14 +431,22 @@ func (h *ChatHandler) GetUnreadMessages(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	h.enrichMessages(ctx, result.Messages)
-	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+	h.enrichMessages(ctx, result.Messages, userID)
+	resp := map[string]interface{}{
 		"messages":      result.Messages,
 		"firstUnreadId": result.FirstUnreadID,
 		"totalUnread":   result.TotalUnread,
 		"hasMoreTop":    result.HasMoreTop,
 		"hasMoreBottom": result.HasMoreBottom,
-	})
+	}
+	// Курсоры те же, что у GET /messages?cursor=
+	if result.NextCursor != "" {
+		resp["nextCursor"] = result.NextCursor
+	}
+	if result.PrevCursor != "" {
+		resp["prevCursor"] = result.PrevCursor
+	}
+	respondWithJSON(w, http.StatusOK, resp)
 }
 
 func (h *ChatHandler) GetMessagesAfter(w http.ResponseWriter, r *http.Request) {
@@ -318,13 +462,13 @@ func (h *ChatHandler) GetMessagesAfter(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
 
-	messages, err := h.db.GetMessagesAfterID(ctx, chatID, messageID, limit)
+	messages, err := h.db.GetMessagesAfterID(ctx, chatID, callerID(r), messageID, limit)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "database_error", err.Error())
 		return
 	}
 
-	h.enrichMessages(ctx, messages)
+	h.enrichMessages(ctx, messages, callerID(r))
 	respondWithJSON(w, http.StatusOK, messages)
 }
 
@@ -341,18 +485,56 @@ func (h *ChatHandler) GetMessagesBefore(w http.ResponseWriter, r *http.Request)
 	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
 
-	messages, err := h.db.GetMessagesBeforeID(ctx, chatID, messageID, limit)
+	messages, err := h.db.GetMessagesBeforeID(ctx, chatID, callerID(r), messageID, limit)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "database_error", err.Error())
 		return
 	}
 
-	h.enrichMessages(ctx, messages)
+	h.enrichMessages(ctx, messages, callerID(r))
 	respondWithJSON(w, http.StatusOK, messages)
 }
 
-// enrichMessages подгружает вложения для списка сообщений
-func (h *ChatHandler) enrichMessages(ctx context.Context, messages []models.Message) {
+// respondWithStoredMessage отвечает ранее сохранённым сообщением (повтор по clientMessageId)
+// и рассылает его, если первая попытка до рассылки не дошла.
+func (h *ChatHandler) respondWithStoredMessage(ctx context.Context, w http.ResponseWriter, msg *models.Message) {
+	messages := []models.Message{*msg}
+	h.enrichMessages(ctx, messages, msg.SenderID)
+	h.publishStored(ctx, &messages[0])
+	respondWithJSON(w, http.StatusOK, messages[0])
+}
+
+// publishStored рассылает сообщение, сохранённое прошлой попыткой с тем же
+// clientMessageId, если та его не разослала (упала между сохранением и рассылкой).
+func (h *ChatHandler) publishStored(ctx context.Context, msg *models.Message) {
+	claimed, err := h.db.MarkMessagePublished(ctx, msg.ID)
+	if err != nil {
+		logger.From(ctx).Error("mark message published", "message_id", msg.ID, "error", err)
+		return
+	}
+	if claimed {
+		h.publishMessage(ctx, msg)
+	}
+}
+
+// canPost отвечает 403, если пользователь не может писать в чат (подписчик канала).
+func (h *ChatHandler) canPost(ctx context.Context, w http.ResponseWriter, chatID string, userID int) bool {
+	ok, err := h.db.CanPost(ctx, chatID, userID)
+	if err != nil {
+		logger.From(ctx).Error("check post rights", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "database_error", "Failed to check rights")
+		return false
+	}
+	if !ok {
+		respondWithError(w, http.StatusForbidden, "read_only", "Only admins can post in this channel")
+		return false
+	}
+	return true
+}
+
+// enrichMessages подгружает вложения, реакции и статусы для списка сообщений
+// одного чата; reactedByMe и status считаются для viewerID
+func (h *ChatHandler) enrichMessages(ctx context.Context, messages []models.Message, viewerID int) {
 	if len(messages) == 0 {
 		return
 	}
@@ -363,12 +545,15 @@ func (h *ChatHandler) enrichMessages(ctx context.Context, messages []models.Mess
 	}
 
 	if attachmentsMap, err := h.db.GetAttachmentsByMessageIDs(ctx, ids); err != nil {
-		log.Printf("Failed to load attachments: %v", err)
+		logger.From(ctx).Error("load attachments failed", "error", err)
 	} else {
 		for i, m := range messages {
+			if m.DeletedAt != nil {
+				continue
+			}
 			if atts, ok := attachmentsMap[m.ID]; ok {
 				for j := range atts {
-					atts[j].URL = h.config.Media.BaseURL + "/media/" + atts[j].StoreName
+					atts[j].URL = h.mediaURL(m.ChatID, atts[j].StoreName)
 				}
 				messages[i].Attachments = atts
 			}
@@ -376,30 +561,38 @@ func (h *ChatHandler) enrichMessages(ctx context.Context, messages []models.Mess
 	}
 
 	if fwdAttsMap, err := h.db.GetForwardedAttachmentsByMessageIDs(ctx, ids); err != nil {
-		log.Printf("Failed to load forwarded attachments: %v", err)
+		logger.From(ctx).Error("load forwarded attachments failed", "error", err)
 	} else {
 		for i, m := range messages {
-			if m.ForwardedFrom == nil {
+			if m.ForwardedFrom == nil || m.DeletedAt != nil {
 				continue
 			}
 			if atts, ok := fwdAttsMap[m.ID]; ok {
 				for j := range atts {
-					atts[j].URL = h.config.Media.BaseURL + "/media/" + atts[j].StoreName
+					atts[j].URL = h.mediaURL(m.ChatID, atts[j].StoreName)
 				}
 				messages[i].ForwardedFrom.Attachments = atts
 			}
 		}
 	}
+
+	h.setMessageStatuses(ctx, messages, viewerID)
+
+	if reactionsMap, err := h.db.GetReactionsByMessageIDs(ctx, ids, viewerID); err != nil {
+		logger.From(ctx).Error("load reactions failed", "error", err)
+	} else {
+		for i, m := range messages {
+			if m.DeletedAt == nil {
+				messages[i].Reactions = reactionsMap[m.ID]
+			}
+		}
+	}
 }
 
 func (h *ChatHandler) UploadFiles(w http.ResponseWriter, r *http.Request) {
 	chatID := mux.Vars(r)["chatId"]
 
-	userID, err := h.extractUserIDFromAuth(r)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "unauthorized", err.Error())
-		return
-	}
+	userID := callerID(r)
 
 	r.Body = http.MaxBytesReader(w, r.Body, h.config.Media.MaxFileSize*10)
 	if err := r.ParseMultipartForm(h.config.Media.MaxFileSize); err != nil {
@@ -410,9 +603,7 @@ func (h *ChatHandler) UploadFiles(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
 	defer cancel()
 
-	isMember, err := h.db.IsMember(ctx, chatID, userID)
-	if err != nil || !isMember {
-		respondWithError(w, http.StatusForbidden, "forbidden", "You are not a member of this chat")
+	if !h.canPost(ctx, w, chatID, userID) {
 		return
 	}
 
@@ -422,13 +613,36 @@ func (h *ChatHandler) UploadFiles(w http.ResponseWriter, r *http.Request) {
 	if replyToIDStr != "" {
 		replyToID = &replyToIDStr
 	}
+	var threadRootID *string
+	if v := r.FormValue("threadRootId"); v != "" {
+		threadRootID = &v
+	}
+	var sendAt *time.Time
+	if v := r.FormValue("sendAt"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err == nil {
+			err = models.ValidateSendAt(t)
+		}
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "validation_error", models.ErrInvalidSendAt.Error())
+			return
+		}
+		sendAt = &t
+	}
+
+	clientMessageIDStr := r.FormValue("clientMessageId")
+	var clientMessageID *string
+	if clientMessageIDStr != "" {
+		if len(clientMessageIDStr) > models.MaxClientMessageIDLength {
+			respondWithError(w, http.StatusBadRequest, "validation_error", models.ErrInvalidClientID.Error())
+			return
+		}
+		clientMessageID = &clientMessageIDStr
+	}
 
 	metaJSON := r.FormValue("meta")
 
-	var meta []struct {
-		Width  *int `json:"width"`
-		Height *int `json:"height"`
-	}
+	var meta []uploadMeta
 
 	if metaJSON != "" {
 		_ = json.Unmarshal([]byte(metaJSON), &meta)
@@ -448,79 +662,119 @@ func (h *ChatHandler) UploadFiles(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	msg, err := h.db.SaveMessage(ctx, chatID, userID, text, replyToID)
+	if sendAt != nil {
+		// Ретрай загрузки: не кладём файлы в хранилище второй раз
+		if clientMessageID != nil {
+			existing, err := h.db.GetScheduledByClientID(ctx, chatID, userID, *clientMessageID)
+			if err == nil {
+				respondWithJSON(w, http.StatusAccepted, existing)
+				return
+			}
+			if !errors.Is(err, db.ErrScheduledNotFound) {
+				logger.From(ctx).Error("get scheduled message", "error", err)
+				respondWithError(w, http.StatusInternalServerError, "database_error", "Failed to schedule message")
+				return
+			}
+		}
+		h.scheduleMessage(ctx, w, models.ScheduledMessage{
+			ChatID:          chatID,
+			SenderID:        userID,
+			Text:            text,
+			ReplyToID:       replyToID,
+			ThreadRootID:    threadRootID,
+			ClientMessageID: clientMessageID,
+			Attachments:     h.storeUploads(ctx, files, meta),
+		}, *sendAt)
+		return
+	}
+
+	// Ретрай загрузки: не кладём файлы в хранилище второй раз
+	if clientMessageID != nil {
+		existing, err := h.db.GetMessageByClientID(ctx, chatID, userID, *clientMessageID)
+		if err == nil {
+			h.respondWithStoredMessage(ctx, w, existing)
+			return
+		}
+		if !errors.Is(err, db.ErrMessageNotFound) {
+			logger.From(ctx).Error("get message by client id", "error", err)
+			respondWithError(w, http.StatusInternalServerError, "database_error", "Failed to save message")
+			return
+		}
+	}
+
+	// Сначала файлы, затем сообщение с вложениями одной транзакцией:
+	// сохранённое сообщение всегда приходит со своими файлами
+	attachments := h.storeUploads(ctx, files, meta)
+	plain, entities := markup.Parse(text)
+	msg, duplicate, err := h.db.SaveMessage(ctx, chatID, userID, plain, entities, replyToID, threadRootID, clientMessageID, attachments)
+	if err != nil || duplicate {
+		for _, a := range attachments {
+			h.storage.Delete(a.StoreName)
+		}
+	}
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "database_error", "Failed to save message")
+		h.respondWithSaveError(ctx, w, err)
 		return
 	}
+	if duplicate {
+		h.respondWithStoredMessage(ctx, w, msg)
+		return
+	}
+
+	for i := range msg.Attachments {
+		msg.Attachments[i].URL = h.mediaURL(chatID, msg.Attachments[i].StoreName)
+	}
+
+	h.publishMessage(ctx, msg)
+	// Черновик — общий для чата; ответ в ветке набирается отдельно
+	if msg.ThreadRootID == nil {
+		h.clearDraft(ctx, chatID, userID)
+	}
 
+	respondWithJSON(w, http.StatusCreated, msg)
+}
+
+// uploadMeta — размеры изображений из поля meta, по порядку файлов.
+type uploadMeta struct {
+	Width  *int `json:"width"`
+	Height *int `json:"height"`
+}
+
+// storeUploads кладёт загруженные файлы в хранилище и возвращает их описания
+// без привязки к сообщению. Файлы, которые не удалось сохранить, пропускаются.
+func (h *ChatHandler) storeUploads(ctx context.Context, files []*multipart.FileHeader, meta []uploadMeta) []models.Attachment {
 	var attachments []models.Attachment
 	for i, fh := range files {
 		file, err := fh.Open()
 		if err != nil {
-			log.Printf("Failed to open uploaded file: %v", err)
+			logger.From(ctx).Warn("open uploaded file failed", "file", fh.Filename, "error", err)
 			continue
 		}
-		var width *int
-		var height *int
-
-		if i < len(meta) {
-			width = meta[i].Width
-			height = meta[i].Height
-		}
 
 		saved, err := h.storage.Save(file, fh)
 		file.Close()
 		if err != nil {
-			log.Printf("Failed to save file %s: %v", fh.Filename, err)
+			logger.From(ctx).Error("save file failed", "file", fh.Filename, "error", err)
 			continue
 		}
 
 		a := models.Attachment{
-			ID:        db.NewAttachmentID(),
-			MessageID: msg.ID,
 			FileName:  saved.FileName,
 			StoreName: saved.ID + getExt(saved.FileName),
 			MimeType:  saved.MimeType,
 			Size:      saved.Size,
-			URL:       saved.URL,
-			Width:     width,
-			Height:    height,
 		}
-		if err := h.db.SaveAttachment(ctx, a); err != nil {
-			log.Printf("Failed to save attachment record: %v", err)
-			h.storage.Delete(a.StoreName)
-			continue
+		if i < len(meta) {
+			a.Width = meta[i].Width
+			a.Height = meta[i].Height
 		}
 		attachments = append(attachments, a)
 	}
-	msg.Attachments = attachments
-
-	if activated, _ := h.db.ActivateChat(ctx, chatID); activated {
-		members, _ := h.db.GetChatMembers(ctx, chatID)
-		h.hub.SendToUsers(members, models.WSMessage{
-			Event: "chat:activated",
-			Data:  map[string]string{"chatId": chatID},
-		})
-	}
-
-	members, err := h.db.GetChatMembers(ctx, chatID)
-	if err == nil {
-		recipients := make([]int, 0, len(members))
-		for _, uid := range members {
-			if uid != userID {
-				recipients = append(recipients, uid)
-			}
-		}
-		h.hub.SendToUsers(recipients, models.WSMessage{
-			Event: "message:new",
-			Data:  msg,
-		})
-	}
-
-	respondWithJSON(w, http.StatusCreated, msg)
+	return attachments
 }
 
+// ServeMedia отдаёт файл по подписанной ссылке (см. mediaURL).
+// Подпись привязывает ссылку к чату, и файл должен быть виден в этом чате.
 func (h *ChatHandler) ServeMedia(w http.ResponseWriter, r *http.Request) {
 	filename := mux.Vars(r)["filename"]
 	if strings.Contains(filename, "..") || strings.Contains(filename, "/") {
@@ -528,12 +782,37 @@ func (h *ChatHandler) ServeMedia(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	chatID, err := h.mediaURLs.Verify(filename, r.URL.Query())
+	if err == storage.ErrURLExpired {
+		respondWithError(w, http.StatusForbidden, "url_expired", "Media link expired")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusForbidden, "forbidden", "Invalid media link")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 3*time.Second)
+	defer cancel()
+
+	inChat, err := h.db.MediaInChat(ctx, filename, chatID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "database_error", "Failed to check attachment")
+		return
+	}
+	if !inChat {
+		respondWithError(w, http.StatusNotFound, "not_found", "File not found")
+		return
+	}
+
 	filePath := h.storage.FilePath(filename)
 	if _, err := os.Stat(filePath); os.IsNotExist(err) {
 		respondWithError(w, http.StatusNotFound, "not_found", "File not found")
 		return
 	}
 
+	// Ссылка временная — кэш только у клиента
+	w.Header().Set("Cache-Control", fmt.Sprintf("private, max-age=%d", int(h.config.Media.URLTTL.Seconds())))
 	http.ServeFile(w, r, filePath)
 }
 
@@ -544,3 +823,39 @@ func getExt(filename string) string {
 	}
 	return ext
 }
+
+// setMessageStatuses проставляет sent/delivered/read собственным сообщениям viewerID
+// по самым дальним курсорам остальных участников.
+func (h *ChatHandler) setMessageStatuses(ctx context.Context, messages []models.Message, viewerID int) {
+	own := false
+	for _, m := range messages {
+		if m.SenderID == viewerID && m.Kind == models.MessageKindUser {
+			own = true
+			break
+		}
+	}
+	if !own {
+		return
+	}
+
+	chatID := messages[0].ChatID
+	readAt, deliveredAt, err := h.db.GetPeerCursorTimes(ctx, chatID, viewerID)
+	if err != nil {
+		logger.From(ctx).Error("load read cursors failed", "error", err)
+		return
+	}
+
+	for i, m := range messages {
+		if m.SenderID != viewerID || m.Kind != models.MessageKindUser || m.ChatID != chatID {
+			continue
+		}
+		switch {
+		case !readAt.Before(m.CreatedAt.Time):
+			messages[i].Status = models.MessageStatusRead
+		case !deliveredAt.Before(m.CreatedAt.Time):
+			messages[i].Status = models.MessageStatusDelivered
+		default:
+			messages[i].Status = models.MessageStatusSent
+		}
+	}
+}
@@ -0,0 +1,142 @@
+// Chat_Service/handlers/pins.go
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"Chat_Service/logger"
+	"Chat_Service/models"
+
+	"github.com/gorilla/mux"
+)
+
+// WS события закрепов
+const (
+	eventChatPinned     = "chat:pinned"
+	eventChatUnpinned   = "chat:unpinned"
+	eventPermissionsSet = "chat:permissions_changed"
+)
+
+func (h *ChatHandler) GetPins(w http.ResponseWriter, r *http.Request) {
+	chatID := mux.Vars(r)["chatId"]
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	pins, err := h.loadPins(ctx, chatID, callerID(r))
+	if err != nil {
+		logger.From(ctx).Error("get pins", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "database_error", "Failed to get pins")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, pins)
+}
+
+// loadPins возвращает закрепы с сообщениями, обогащёнными как в истории.
+func (h *ChatHandler) loadPins(ctx context.Context, chatID string, viewerID int) ([]models.PinnedMessage, error) {
+	pins, err := h.db.GetPins(ctx, chatID)
+	if err != nil {
+		return nil, err
+	}
+
+	messages := make([]models.Message, 0, len(pins))
+	for _, p := range pins {
+		if p.Message != nil {
+			messages = append(messages, *p.Message)
+		}
+	}
+	h.enrichMessages(ctx, messages, viewerID)
+
+	byID := make(map[string]*models.Message, len(messages))
+	for i := range messages {
+		byID[messages[i].ID] = &messages[i]
+	}
+	for i := range pins {
+		pins[i].Message = byID[pins[i].MessageID]
+	}
+	return pins, nil
+}
+
+func (h *ChatHandler) PinMessage(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	chatID, messageID := vars["chatId"], vars["messageId"]
+	userID := callerID(r)
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	pin, changed, err := h.db.PinMessage(ctx, chatID, messageID, userID)
+	if err != nil {
+		h.respondWithGroupError(ctx, w, err)
+		return
+	}
+
+	if changed {
+		h.hub.SendToChat(ctx, chatID, models.WSMessage{
+			Event: eventChatPinned,
+			Data: map[string]interface{}{
+				"chatId":    chatID,
+				"messageId": messageID,
+				"userId":    userID,
+				"position":  pin.Position,
+			},
+		})
+	}
+
+	respondWithJSON(w, http.StatusOK, models.SuccessResponse{Status: "ok"})
+}
+
+func (h *ChatHandler) UnpinMessage(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	chatID, messageID := vars["chatId"], vars["messageId"]
+	userID := callerID(r)
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	changed, err := h.db.UnpinMessage(ctx, chatID, messageID, userID)
+	if err != nil {
+		h.respondWithGroupError(ctx, w, err)
+		return
+	}
+
+	if changed {
+		h.hub.SendToChat(ctx, chatID, models.WSMessage{
+			Event: eventChatUnpinned,
+			Data:  map[string]interface{}{"chatId": chatID, "messageId": messageID, "userId": userID},
+		})
+	}
+
+	respondWithJSON(w, http.StatusOK, models.SuccessResponse{Status: "ok"})
+}
+
+// SetPermissions меняет права рядовых участников группы (owner/admin).
+func (h *ChatHandler) SetPermissions(w http.ResponseWriter, r *http.Request) {
+	chatID := mux.Vars(r)["chatId"]
+	userID := callerID(r)
+
+	var perms models.ChatPermissions
+	if err := json.NewDecoder(r.Body).Decode(&perms); err != nil {
+		respondWithError(w, http.StatusBadRequest, "invalid_request", "Invalid JSON")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	if err := h.db.SetChatPermissions(ctx, chatID, userID, perms); err != nil {
+		h.respondWithGroupError(ctx, w, err)
+		return
+	}
+
+	h.hub.SendToChat(ctx, chatID, models.WSMessage{
+		Event: eventPermissionsSet,
+		Data:  map[string]interface{}{"chatId": chatID, "actorId": userID, "permissions": perms},
+	})
+
+	respondWithJSON(w, http.StatusOK, perms)
+}
@@ -0,0 +1,138 @@
+// Chat_Service/handlers/previews.go
+package handlers
+
+import (
+	"context"
+	"sync"
+
+	"Chat_Service/linkpreview"
+	"Chat_Service/logger"
+	"Chat_Service/models"
+)
+
+const eventMessageUpdated = "message:updated"
+
+// previewQueueSize — сколько ссылок может ждать загрузки; лишние остаются без превью.
+const previewQueueSize = 256
+
+type previewJob struct {
+	chatID    string
+	messageID string
+	url       string
+}
+
+// attachLinkPreview привязывает к сообщению превью первой ссылки в тексте. Превью
+// из кэша сразу попадает в msg, иначе загрузка ставится в очередь и клиенты
+// получат его в message:updated. true — превью сообщения сменилось (в том числе пропало).
+func (h *ChatHandler) attachLinkPreview(ctx context.Context, msg *models.Message) bool {
+	if h.previewJobs == nil {
+		return false
+	}
+
+	url := linkpreview.FirstURL(msg.Text, msg.Entities)
+	changed, err := h.db.SetMessageLinkPreview(ctx, msg.ChatID, msg.ID, url)
+	if err != nil {
+		logger.From(ctx).Error("set link preview", "message_id", msg.ID, "error", err)
+		return false
+	}
+	if !changed {
+		return false
+	}
+	msg.LinkPreview = nil
+	if url == "" {
+		return true
+	}
+
+	preview, found, err := h.db.GetLinkPreview(ctx, url, h.config.Previews.CacheTTL)
+	if err != nil {
+		logger.From(ctx).Error("get link preview", "error", err)
+		return true
+	}
+	if found {
+		msg.LinkPreview = preview
+		return true
+	}
+
+	select {
+	case h.previewJobs <- previewJob{chatID: msg.ChatID, messageID: msg.ID, url: url}:
+	default:
+		logger.From(ctx).Warn("link preview queue is full", "message_id", msg.ID)
+	}
+	return true
+}
+
+// RunLinkPreviews загружает превью из очереди в Previews.Workers потоков, пока ctx не отменён.
+func (h *ChatHandler) RunLinkPreviews(ctx context.Context) {
+	if h.previewJobs == nil {
+		return
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < h.config.Previews.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case job := <-h.previewJobs:
+					h.loadLinkPreview(ctx, job)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// loadLinkPreview загружает превью (если его ещё нет в кэше), кэширует результат,
+// в том числе неудачный, и рассылает message:updated, если сообщение всё ещё ждёт эту ссылку.
+func (h *ChatHandler) loadLinkPreview(ctx context.Context, job previewJob) {
+	log := logger.From(ctx).With("message_id", job.messageID)
+
+	// Пока задача стояла в очереди, ту же ссылку мог загрузить другой поток
+	preview, found, err := h.db.GetLinkPreview(ctx, job.url, h.config.Previews.CacheTTL)
+	if err != nil {
+		log.Error("get link preview", "error", err)
+		return
+	}
+	if !found {
+		fetchCtx, cancel := context.WithTimeout(ctx, h.config.Previews.Timeout)
+		preview, err = h.fetcher.Fetch(fetchCtx, job.url)
+		cancel()
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			log.Debug("link preview unavailable", "url", job.url, "error", err)
+		}
+		if err := h.db.SaveLinkPreview(ctx, job.url, preview); err != nil {
+			log.Error("save link preview", "error", err)
+			return
+		}
+	}
+	if preview == nil {
+		return
+	}
+
+	wants, err := h.db.MessageWantsLinkPreview(ctx, job.messageID, job.url)
+	if err != nil {
+		log.Error("check link preview", "error", err)
+		return
+	}
+	if wants {
+		h.broadcastLinkPreview(ctx, job.chatID, job.messageID, preview)
+	}
+}
+
+// broadcastLinkPreview сообщает чату новое превью сообщения (nil — превью больше нет).
+func (h *ChatHandler) broadcastLinkPreview(ctx context.Context, chatID, messageID string, preview *models.LinkPreview) {
+	h.hub.SendToChat(ctx, chatID, models.WSMessage{
+		Event: eventMessageUpdated,
+		Data: map[string]interface{}{
+			"chatId":      chatID,
+			"messageId":   messageID,
+			"linkPreview": preview,
+		},
+	})
+}
@@ -0,0 +1,84 @@
+// Chat_Service/handlers/reactions.go
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"Chat_Service/db"
+	"Chat_Service/logger"
+	"Chat_Service/models"
+
+	"github.com/gorilla/mux"
+)
+
+// AddReaction — PUT /messages/{messageId}/reactions/{emoji}; повтор ничего не меняет.
+func (h *ChatHandler) AddReaction(w http.ResponseWriter, r *http.Request) {
+	h.setReaction(w, r, true)
+}
+
+// RemoveReaction — DELETE /messages/{messageId}/reactions/{emoji}.
+func (h *ChatHandler) RemoveReaction(w http.ResponseWriter, r *http.Request) {
+	h.setReaction(w, r, false)
+}
+
+func (h *ChatHandler) setReaction(w http.ResponseWriter, r *http.Request, add bool) {
+	vars := mux.Vars(r)
+	chatID, messageID, emoji := vars["chatId"], vars["messageId"], vars["emoji"]
+	userID := callerID(r)
+
+	if err := models.ValidateReaction(emoji); err != nil {
+		respondWithError(w, http.StatusBadRequest, "validation_error", err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	changed, count, err := h.db.SetReaction(ctx, chatID, messageID, userID, emoji, add)
+	if errors.Is(err, db.ErrMessageNotFound) {
+		respondWithError(w, http.StatusNotFound, "message_not_found", "Message not found")
+		return
+	}
+	if err != nil {
+		logger.From(ctx).Error("set reaction", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "database_error", "Failed to update reaction")
+		return
+	}
+
+	if changed {
+		h.hub.SendToChat(ctx, chatID, models.WSMessage{
+			Event: "message:reaction",
+			Data: map[string]interface{}{
+				"chatId":    chatID,
+				"messageId": messageID,
+				"userId":    userID,
+				"emoji":     emoji,
+				"added":     add,
+				"count":     count,
+			},
+		})
+	}
+
+	respondWithJSON(w, http.StatusOK, models.Reaction{Emoji: emoji, Count: count, ReactedByMe: add})
+}
+
+// GetReactions — кто отреагировал на сообщение (?emoji=&limit=&offset=).
+func (h *ChatHandler) GetReactions(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	limit, offset := h.getPaginationParams(r)
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	users, err := h.db.GetReactionUsers(ctx, vars["chatId"], vars["messageId"], r.URL.Query().Get("emoji"), limit, offset)
+	if err != nil {
+		logger.From(ctx).Error("get reactions", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "database_error", "Failed to get reactions")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, users)
+}
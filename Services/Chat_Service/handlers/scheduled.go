@@ -0,0 +1,226 @@
+// Chat_Service/handlers/scheduled.go
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"Chat_Service/db"
+	"Chat_Service/logger"
+	"Chat_Service/markup"
+	"Chat_Service/models"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// WS события отложенных сообщений (только автору)
+const (
+	eventScheduledSent   = "scheduled:sent"
+	eventScheduledFailed = "scheduled:failed"
+)
+
+const (
+	scheduledBatch       = 50               // сколько сообщений воркер берёт за проход
+	scheduledSendTimeout = 10 * time.Second // на одно сообщение
+	// Аренда покрывает весь проход: пока воркер отправляет хвост пачки,
+	// другой экземпляр не должен забрать те же сообщения
+	scheduledLease = scheduledBatch*scheduledSendTimeout + time.Minute
+)
+
+// scheduleMessage сохраняет отложенное сообщение и отвечает 202 с его описанием.
+// Повтор с тем же clientMessageId отдаёт уже запланированное.
+func (h *ChatHandler) scheduleMessage(ctx context.Context, w http.ResponseWriter, s models.ScheduledMessage, sendAt time.Time) {
+	scheduled, duplicate, err := h.db.CreateScheduledMessage(ctx, s, sendAt)
+	if err != nil || duplicate {
+		for _, a := range s.Attachments {
+			h.storage.Delete(a.StoreName)
+		}
+	}
+	if err != nil {
+		logger.From(ctx).Error("schedule message", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "database_error", "Failed to schedule message")
+		return
+	}
+	if !duplicate && s.ThreadRootID == nil {
+		h.clearDraft(ctx, s.ChatID, s.SenderID)
+	}
+
+	respondWithJSON(w, http.StatusAccepted, scheduled)
+}
+
+// GetScheduledMessages — GET /scheduled: свои отложенные сообщения в чате.
+func (h *ChatHandler) GetScheduledMessages(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	list, err := h.db.GetScheduledMessages(ctx, mux.Vars(r)["chatId"], callerID(r))
+	if err != nil {
+		logger.From(ctx).Error("get scheduled messages", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "database_error", "Failed to get scheduled messages")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, list)
+}
+
+// UpdateScheduledMessage — PUT /scheduled/{id} {text?, sendAt?}.
+func (h *ChatHandler) UpdateScheduledMessage(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	var req models.UpdateScheduledRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "invalid_request", "Invalid JSON")
+		return
+	}
+	if err := req.Validate(); err != nil {
+		respondWithError(w, http.StatusBadRequest, "validation_error", err.Error())
+		return
+	}
+	if _, err := uuid.Parse(vars["id"]); err != nil {
+		respondWithError(w, http.StatusNotFound, "scheduled_not_found", db.ErrScheduledNotFound.Error())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	scheduled, err := h.db.UpdateScheduledMessage(ctx, vars["chatId"], vars["id"], callerID(r), req.Text, req.SendAt)
+	if err != nil {
+		h.respondWithScheduledError(ctx, w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, scheduled)
+}
+
+// CancelScheduledMessage — DELETE /scheduled/{id}: отмена вместе с загруженными файлами.
+func (h *ChatHandler) CancelScheduledMessage(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if _, err := uuid.Parse(vars["id"]); err != nil {
+		respondWithError(w, http.StatusNotFound, "scheduled_not_found", db.ErrScheduledNotFound.Error())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	storeNames, err := h.db.CancelScheduledMessage(ctx, vars["chatId"], vars["id"], callerID(r))
+	if err != nil {
+		h.respondWithScheduledError(ctx, w, err)
+		return
+	}
+	for _, name := range storeNames {
+		h.storage.Delete(name)
+	}
+
+	respondWithJSON(w, http.StatusOK, models.SuccessResponse{Status: "ok"})
+}
+
+func (h *ChatHandler) respondWithScheduledError(ctx context.Context, w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, db.ErrScheduledNotFound):
+		respondWithError(w, http.StatusNotFound, "scheduled_not_found", err.Error())
+	case errors.Is(err, db.ErrScheduledBusy):
+		respondWithError(w, http.StatusConflict, "scheduled_busy", err.Error())
+	default:
+		logger.From(ctx).Error("scheduled message update failed", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "database_error", "Failed to update scheduled message")
+	}
+}
+
+// RunScheduler отправляет созревшие отложенные сообщения, пока ctx не отменён.
+// Можно запускать на нескольких экземплярах: сообщения разбираются через аренду в БД.
+func (h *ChatHandler) RunScheduler(ctx context.Context) {
+	runEvery(ctx, h.config.Chats.ScheduleTick, h.publishDueMessages)
+}
+
+func (h *ChatHandler) publishDueMessages(ctx context.Context) {
+	claimCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	due, err := h.db.ClaimDueScheduledMessages(claimCtx, scheduledBatch, scheduledLease)
+	cancel()
+	if err != nil {
+		logger.From(ctx).Error("claim scheduled messages", "error", err)
+		return
+	}
+
+	// Не дольше аренды: недоотправленное возьмут после её истечения
+	batchCtx, cancelBatch := context.WithTimeout(ctx, scheduledBatch*scheduledSendTimeout)
+	defer cancelBatch()
+	for _, s := range due {
+		if batchCtx.Err() != nil {
+			return
+		}
+		sendCtx, cancel := context.WithTimeout(batchCtx, scheduledSendTimeout)
+		h.publishScheduled(sendCtx, s)
+		cancel()
+	}
+}
+
+// publishScheduled отправляет одно отложенное сообщение обычным путём.
+// clientMessageId — клиентский или, если его не было, id записи, поэтому
+// повтор после сбоя не создаст дубль. Временные ошибки оставляют запись:
+// её возьмут снова, когда истечёт аренда.
+func (h *ChatHandler) publishScheduled(ctx context.Context, s models.ScheduledMessage) {
+	canPost, err := h.db.CanPost(ctx, s.ChatID, s.SenderID)
+	if err != nil {
+		logger.From(ctx).Error("check post rights", "scheduled_id", s.ID, "error", err)
+		return
+	}
+	if !canPost {
+		h.failScheduled(ctx, s, "not allowed to post in this chat")
+		return
+	}
+
+	clientMessageID := s.ID
+	if s.ClientMessageID != nil {
+		clientMessageID = *s.ClientMessageID
+	}
+
+	text, entities := markup.Parse(s.Text)
+	msg, duplicate, err := h.db.SaveMessage(ctx, s.ChatID, s.SenderID, text, entities, s.ReplyToID, s.ThreadRootID, &clientMessageID, nil)
+	if errors.Is(err, db.ErrMessageNotFound) || errors.Is(err, db.ErrInvalidThreadRoot) {
+		h.failScheduled(ctx, s, "thread is no longer available")
+		return
+	}
+	if errors.Is(err, db.ErrInvalidMention) {
+		h.failScheduled(ctx, s, "mentioned user is no longer a chat member")
+		return
+	}
+	if err != nil {
+		logger.From(ctx).Error("send scheduled message", "scheduled_id", s.ID, "error", err)
+		return
+	}
+
+	if err := h.db.CompleteScheduledMessage(ctx, s.ID, msg.ID); err != nil {
+		logger.From(ctx).Error("complete scheduled message", "scheduled_id", s.ID, "error", err)
+		return
+	}
+
+	// Сообщение, сохранённое прошлой попыткой, рассылается, только если та не успела
+	messages := []models.Message{*msg}
+	h.enrichMessages(ctx, messages, s.SenderID)
+	if duplicate {
+		h.publishStored(ctx, &messages[0])
+	} else {
+		h.publishMessage(ctx, &messages[0])
+	}
+	h.hub.SendToUser(ctx, s.SenderID, models.WSMessage{
+		Event: eventScheduledSent,
+		Data:  map[string]string{"id": s.ID, "chatId": s.ChatID, "messageId": msg.ID},
+	})
+}
+
+func (h *ChatHandler) failScheduled(ctx context.Context, s models.ScheduledMessage, reason string) {
+	if err := h.db.FailScheduledMessage(ctx, s.ID, reason); err != nil {
+		logger.From(ctx).Error("fail scheduled message", "scheduled_id", s.ID, "error", err)
+		return
+	}
+	h.hub.SendToUser(ctx, s.SenderID, models.WSMessage{
+		Event: eventScheduledFailed,
+		Data:  map[string]string{"id": s.ID, "chatId": s.ChatID, "error": reason},
+	})
+}
@@ -0,0 +1,104 @@
+// Chat_Service/handlers/search.go
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"Chat_Service/logger"
+	"Chat_Service/models"
+
+	"github.com/gorilla/mux"
+)
+
+// SearchAllChats — GET /api/chats/search?q= по всем чатам пользователя.
+func (h *ChatHandler) SearchAllChats(w http.ResponseWriter, r *http.Request) {
+	userID, err := h.extractUserIDFromAuth(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "unauthorized", err.Error())
+		return
+	}
+	h.search(w, r, userID, "")
+}
+
+// SearchChat — GET /api/chats/{chatId}/search?q= внутри одного чата.
+func (h *ChatHandler) SearchChat(w http.ResponseWriter, r *http.Request) {
+	h.search(w, r, callerID(r), mux.Vars(r)["chatId"])
+}
+
+func (h *ChatHandler) search(w http.ResponseWriter, r *http.Request, userID int, chatID string) {
+	params, err := h.parseSearchParams(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "validation_error", err.Error())
+		return
+	}
+	params.ChatID = chatID
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	hits, err := h.db.SearchMessages(ctx, userID, params)
+	if err != nil {
+		logger.From(ctx).Error("search messages", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "database_error", "Failed to search messages")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, hits)
+}
+
+// parseSearchParams читает q, senderId, from, to (RFC3339 или YYYY-MM-DD),
+// hasAttachment, limit и offset.
+func (h *ChatHandler) parseSearchParams(r *http.Request) (models.SearchParams, error) {
+	q := r.URL.Query()
+	p := models.SearchParams{Query: strings.TrimSpace(q.Get("q"))}
+	p.Limit, p.Offset = h.getPaginationParams(r)
+
+	if p.Query == "" || len(p.Query) > models.MaxSearchQueryLength {
+		return p, errors.New("q must be between 1 and 200 characters")
+	}
+
+	if v := q.Get("senderId"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil {
+			return p, errors.New("invalid senderId")
+		}
+		p.SenderID = &id
+	}
+
+	for _, f := range []struct {
+		name string
+		dst  **time.Time
+	}{{"from", &p.From}, {"to", &p.To}} {
+		v := q.Get(f.name)
+		if v == "" {
+			continue
+		}
+		t, err := parseSearchTime(v)
+		if err != nil {
+			return p, errors.New("invalid " + f.name + ": use RFC3339 or YYYY-MM-DD")
+		}
+		*f.dst = &t
+	}
+
+	if v := q.Get("hasAttachment"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return p, errors.New("invalid hasAttachment")
+		}
+		p.HasAttachment = &b
+	}
+
+	return p, nil
+}
+
+func parseSearchTime(v string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", v)
+}
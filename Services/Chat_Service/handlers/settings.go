@@ -0,0 +1,114 @@
+// Chat_Service/handlers/settings.go
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"Chat_Service/db"
+	"Chat_Service/logger"
+	"Chat_Service/models"
+
+	"github.com/gorilla/mux"
+)
+
+// WS события личных настроек чата (только устройствам пользователя)
+const (
+	eventChatSettingsUpdated = "chat:settings_updated"
+	eventPinnedReordered     = "chats:pinned_reordered"
+)
+
+// UpdateChatSettings — PUT /settings {mute?, archive?, pinned?, markedUnread?}.
+func (h *ChatHandler) UpdateChatSettings(w http.ResponseWriter, r *http.Request) {
+	chatID := mux.Vars(r)["chatId"]
+	userID := callerID(r)
+
+	var req models.UpdateChatSettingsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "invalid_request", "Invalid JSON")
+		return
+	}
+	if err := req.Validate(); err != nil {
+		respondWithError(w, http.StatusBadRequest, "validation_error", err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	settings, err := h.db.UpdateChatSettings(ctx, chatID, userID, req)
+	switch {
+	case errors.Is(err, db.ErrNotMember):
+		respondWithError(w, http.StatusNotFound, "chat_not_found", "Chat not found")
+		return
+	case errors.Is(err, db.ErrTooManyPinnedChats):
+		respondWithError(w, http.StatusConflict, "too_many_pinned", err.Error())
+		return
+	case err != nil:
+		logger.From(ctx).Error("update chat settings", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "database_error", "Failed to update chat settings")
+		return
+	}
+
+	h.broadcastSettings(ctx, chatID, userID, settings)
+	respondWithJSON(w, http.StatusOK, settings)
+}
+
+// ReorderPinnedChats — PUT /api/chats/pinned {chatIds}: новый порядок всех закреплённых чатов.
+func (h *ChatHandler) ReorderPinnedChats(w http.ResponseWriter, r *http.Request) {
+	userID := callerID(r)
+
+	var req models.ReorderPinnedChatsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "invalid_request", "Invalid JSON")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	err := h.db.ReorderPinnedChats(ctx, userID, req.ChatIDs)
+	switch {
+	case errors.Is(err, db.ErrPinnedMismatch):
+		respondWithError(w, http.StatusBadRequest, "pinned_mismatch", err.Error())
+		return
+	case err != nil:
+		logger.From(ctx).Error("reorder pinned chats", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "database_error", "Failed to reorder pinned chats")
+		return
+	}
+
+	h.hub.SendToUser(ctx, userID, models.WSMessage{
+		Event: eventPinnedReordered,
+		Data:  map[string]interface{}{"chatIds": req.ChatIDs},
+	})
+	respondWithJSON(w, http.StatusOK, models.SuccessResponse{Status: "ok"})
+}
+
+// clearMarkedUnread снимает ручную отметку «непрочитано» после прочтения чата.
+func (h *ChatHandler) clearMarkedUnread(ctx context.Context, chatID string, userID int) {
+	cleared, err := h.db.ClearMarkedUnread(ctx, chatID, userID)
+	if err != nil {
+		logger.From(ctx).Error("clear unread mark", "error", err)
+		return
+	}
+	if !cleared {
+		return
+	}
+	settings, err := h.db.GetChatSettings(ctx, chatID, userID)
+	if err != nil {
+		logger.From(ctx).Error("get chat settings", "error", err)
+		return
+	}
+	h.broadcastSettings(ctx, chatID, userID, settings)
+}
+
+func (h *ChatHandler) broadcastSettings(ctx context.Context, chatID string, userID int, settings *models.ChatSettings) {
+	h.hub.SendToUser(ctx, userID, models.WSMessage{
+		Event: eventChatSettingsUpdated,
+		Data:  map[string]interface{}{"chatId": chatID, "settings": settings},
+	})
+}
@@ -0,0 +1,74 @@
+// Chat_Service/handlers/sync.go
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"Chat_Service/db"
+	"Chat_Service/logger"
+)
+
+const (
+	syncPruneInterval = time.Hour
+	// Запись журнала датируется началом транзакции, а в токен попадает после
+	// её конца: запас покрывает транзакции до часа длиной
+	syncPruneMargin = time.Hour
+)
+
+// Sync — GET /api/sync?since=<token>: всё, что изменилось для пользователя с
+// момента токена. Без since, со старым токеном или при слишком большом числе
+// изменений отвечает fullResync = true и новым токеном.
+func (h *ChatHandler) Sync(w http.ResponseWriter, r *http.Request) {
+	userID, err := h.extractUserIDFromAuth(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "unauthorized", err.Error())
+		return
+	}
+
+	var since *db.SyncToken
+	if s := r.URL.Query().Get("since"); s != "" {
+		token, err := db.ParseSyncToken(s)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "invalid_token", err.Error())
+			return
+		}
+		since = &token
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	resp, err := h.db.GetSync(ctx, userID, since, h.config.Sync.Retention, h.config.Sync.MaxChanges)
+	if err != nil {
+		logger.From(ctx).Error("sync", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "database_error", "Failed to sync")
+		return
+	}
+
+	h.enrichMessages(ctx, resp.Messages, userID)
+	h.fillChatAvatars(resp.Chats)
+	respondWithJSON(w, http.StatusOK, resp)
+}
+
+// RunSyncPruner удаляет устаревшие записи журнала изменений, пока ctx не отменён.
+func (h *ChatHandler) RunSyncPruner(ctx context.Context) {
+	runEvery(ctx, syncPruneInterval, h.pruneSyncChanges)
+}
+
+func (h *ChatHandler) pruneSyncChanges(ctx context.Context) {
+	pruneCtx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+
+	before := time.Now().UTC().Add(-(h.config.Sync.Retention + syncPruneMargin))
+	n, err := h.db.PruneSyncChanges(pruneCtx, before)
+	if err != nil && !errors.Is(err, context.Canceled) {
+		logger.From(ctx).Error("prune sync changes", "error", err)
+		return
+	}
+	if n > 0 {
+		logger.From(ctx).Info("sync changes pruned", "count", n)
+	}
+}
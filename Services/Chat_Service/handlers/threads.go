@@ -0,0 +1,166 @@
+// Chat_Service/handlers/threads.go
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"Chat_Service/db"
+	"Chat_Service/logger"
+	"Chat_Service/models"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+const eventThreadUpdated = "thread:updated"
+
+// GetThreadMessages — GET /threads/{rootId}/messages?before=|after=&limit=.
+// Без курсора — последние ответы ветки. Корень отдаётся вместе с ответами.
+func (h *ChatHandler) GetThreadMessages(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	chatID, rootID := vars["chatId"], vars["rootId"]
+	q := r.URL.Query()
+	before, after := q.Get("before"), q.Get("after")
+	if before != "" && after != "" {
+		respondWithError(w, http.StatusBadRequest, "invalid_request", "Use either before or after")
+		return
+	}
+	if _, err := uuid.Parse(rootID); err != nil {
+		respondWithError(w, http.StatusNotFound, "message_not_found", "Message not found")
+		return
+	}
+
+	limit, _ := h.getPaginationParams(r)
+	userID := callerID(r)
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	root, err := h.db.GetThreadRoot(ctx, chatID, rootID)
+	if errors.Is(err, db.ErrMessageNotFound) {
+		respondWithError(w, http.StatusNotFound, "message_not_found", "Message not found")
+		return
+	}
+	if err != nil {
+		logger.From(ctx).Error("get thread root", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "database_error", "Failed to get thread")
+		return
+	}
+
+	messages, err := h.db.GetThreadMessages(ctx, chatID, userID, rootID, before, after, limit)
+	if err != nil {
+		logger.From(ctx).Error("get thread messages", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "database_error", "Failed to get thread")
+		return
+	}
+
+	roots := []models.Message{*root}
+	h.enrichMessages(ctx, roots, userID)
+	h.enrichMessages(ctx, messages, userID)
+	if messages == nil {
+		messages = []models.Message{}
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"root":     roots[0],
+		"messages": messages,
+	})
+}
+
+// MarkThreadRead — POST /threads/{rootId}/read {lastMessageId}.
+func (h *ChatHandler) MarkThreadRead(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	var body struct {
+		LastMessageID string `json:"lastMessageId"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.LastMessageID == "" {
+		respondWithError(w, http.StatusBadRequest, "invalid_request", "lastMessageId required")
+		return
+	}
+	if _, err := uuid.Parse(body.LastMessageID); err != nil {
+		respondWithError(w, http.StatusNotFound, "message_not_found", "Message not found")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	err := h.db.MarkThreadRead(ctx, vars["chatId"], vars["rootId"], callerID(r), body.LastMessageID)
+	if errors.Is(err, db.ErrMessageNotFound) {
+		respondWithError(w, http.StatusNotFound, "message_not_found", "Message not found")
+		return
+	}
+	if err != nil {
+		logger.From(ctx).Error("mark thread read", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "database_error", "Failed to mark read")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, models.SuccessResponse{Status: "ok"})
+}
+
+// GetUserThreads — GET /api/chats/threads: ветки пользователя во всех чатах
+// с числом непрочитанных ответов (thread.unreadCount).
+func (h *ChatHandler) GetUserThreads(w http.ResponseWriter, r *http.Request) {
+	userID, err := h.extractUserIDFromAuth(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "unauthorized", err.Error())
+		return
+	}
+	limit, offset := h.getPaginationParams(r)
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	roots, err := h.db.GetUserThreads(ctx, userID, limit, offset)
+	if err != nil {
+		logger.From(ctx).Error("get user threads", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "database_error", "Failed to get threads")
+		return
+	}
+
+	h.enrichMessages(ctx, roots, userID)
+	respondWithJSON(w, http.StatusOK, roots)
+}
+
+// broadcastThreadUpdate сообщает чату новый счётчик ветки rootID (nil — не ветка).
+func (h *ChatHandler) broadcastThreadUpdate(ctx context.Context, chatID string, rootID *string) {
+	if rootID == nil {
+		return
+	}
+	root, err := h.db.GetThreadRoot(ctx, chatID, *rootID)
+	if err != nil {
+		return
+	}
+
+	data := map[string]interface{}{
+		"chatId":     chatID,
+		"rootId":     root.ID,
+		"replyCount": 0,
+	}
+	if root.Thread != nil {
+		data["replyCount"] = root.Thread.ReplyCount
+		data["lastReplyAt"] = root.Thread.LastReplyAt
+	}
+	h.hub.SendToChat(ctx, chatID, models.WSMessage{Event: eventThreadUpdated, Data: data})
+}
+
+// respondWithSaveError отвечает на ошибку SaveMessage.
+func (h *ChatHandler) respondWithSaveError(ctx context.Context, w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, db.ErrMessageNotFound):
+		respondWithError(w, http.StatusNotFound, "message_not_found", "Thread root not found")
+	case errors.Is(err, db.ErrInvalidThreadRoot):
+		respondWithError(w, http.StatusBadRequest, "invalid_thread_root", err.Error())
+	case errors.Is(err, db.ErrInvalidMention):
+		respondWithError(w, http.StatusBadRequest, "invalid_mention", err.Error())
+	default:
+		logger.From(ctx).Error("save message", "error", err)
+		respondWithError(w, http.StatusInternalServerError, "database_error", "Failed to save message")
+	}
+}
@@ -0,0 +1,84 @@
+// Chat_Service/handlers/ttl.go
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"Chat_Service/logger"
+	"Chat_Service/models"
+
+	"github.com/gorilla/mux"
+)
+
+const eventTTLChanged = "chat:ttl_changed"
+
+// expiredBatch — сколько истёкших сообщений удаляется за один проход
+const expiredBatch = 200
+
+// SetMessageTTL — PUT /ttl {ttl}: срок жизни новых сообщений в секундах, 0 — выключить.
+func (h *ChatHandler) SetMessageTTL(w http.ResponseWriter, r *http.Request) {
+	chatID := mux.Vars(r)["chatId"]
+	userID := callerID(r)
+
+	var req models.SetTTLRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "invalid_request", "Invalid JSON")
+		return
+	}
+	if err := req.Validate(); err != nil {
+		respondWithError(w, http.StatusBadRequest, "validation_error", err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	msg, err := h.db.SetMessageTTL(ctx, chatID, userID, req.TTL)
+	if err != nil {
+		h.respondWithGroupError(ctx, w, err)
+		return
+	}
+
+	h.broadcastGroupChange(ctx, chatID, userID, msg, eventTTLChanged, map[string]interface{}{
+		"ttl": req.TTL,
+	})
+
+	respondWithJSON(w, http.StatusOK, msg)
+}
+
+// RunExpirySweeper удаляет исчезающие сообщения с истёкшим сроком, пока ctx не отменён.
+func (h *ChatHandler) RunExpirySweeper(ctx context.Context) {
+	runEvery(ctx, h.config.Chats.ExpiryTick, h.sweepExpiredMessages)
+}
+
+// sweepExpiredMessages удаляет истёкшие сообщения партиями, пока они есть,
+// и рассылает message:deleted по каждому.
+func (h *ChatHandler) sweepExpiredMessages(ctx context.Context) {
+	for ctx.Err() == nil {
+		sweepCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		deleted, storeNames, err := h.db.DeleteExpiredMessages(sweepCtx, expiredBatch)
+		if err != nil {
+			cancel()
+			logger.From(ctx).Error("delete expired messages", "error", err)
+			return
+		}
+
+		for _, name := range storeNames {
+			h.storage.Delete(name)
+		}
+		for _, m := range deleted {
+			h.hub.SendToChat(sweepCtx, m.ChatID, models.WSMessage{
+				Event: "message:deleted",
+				Data:  map[string]string{"chatId": m.ChatID, "messageId": m.ID},
+			})
+		}
+		cancel()
+
+		if len(deleted) < expiredBatch {
+			return
+		}
+	}
+}
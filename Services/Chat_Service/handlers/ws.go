@@ -2,9 +2,9 @@
 package handlers
 
 import (
-	"log"
 	"net/http"
 
+	"Chat_Service/logger"
 	"Chat_Service/ws"
 )
 
@@ -27,13 +27,15 @@ func (h *ChatHandler) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	logger.With(r.Context(), "user_id", userID)
+
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
-		log.Printf("WS upgrade error: %v", err)
+		logger.From(r.Context()).Warn("websocket upgrade failed", "error", err)
 		return
 	}
 
-	client := ws.NewClient(h.hub, conn, userID)
+	client := ws.NewClient(h.hub, conn, userID, logger.RequestID(r.Context()))
 	h.hub.Register <- client
 	client.Start()
 }
@@ -0,0 +1,259 @@
+// Chat_Service/linkpreview/fetcher.go
+
+// Package linkpreview загружает метаданные страниц (OpenGraph, oEmbed) для превью ссылок.
+package linkpreview
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
+
+	"Chat_Service/models"
+)
+
+var (
+	ErrBlockedAddress = errors.New("address is not allowed")
+	ErrUnsupported    = errors.New("unsupported content")
+	ErrNoMetadata     = errors.New("page has no preview metadata")
+)
+
+const (
+	maxRedirects   = 3
+	maxURLLength   = 2048
+	userAgent      = "ChatServiceBot/1.0 (link preview)"
+	maxTitle       = 300
+	maxDescription = 1000
+)
+
+// Fetcher загружает превью страницы по ссылке.
+type Fetcher interface {
+	Fetch(ctx context.Context, rawURL string) (*models.LinkPreview, error)
+}
+
+// HTTPFetcher ходит на страницы по HTTP с ограничением времени и размера ответа.
+// Соединяться можно только с публичными адресами на портах 80 и 443: адрес
+// проверяется уже после DNS, поэтому подмена записи на внутренний IP не поможет.
+type HTTPFetcher struct {
+	client   *http.Client
+	maxBytes int64
+}
+
+func NewHTTPFetcher(timeout time.Duration, maxBytes int64) *HTTPFetcher {
+	return newHTTPFetcher(timeout, maxBytes, guardDial)
+}
+
+// newHTTPFetcher — с произвольной проверкой адреса (nil — без проверки, для тестов).
+func newHTTPFetcher(timeout time.Duration, maxBytes int64, control func(network, address string, c syscall.RawConn) error) *HTTPFetcher {
+	dialer := &net.Dialer{Timeout: timeout, Control: control}
+	return &HTTPFetcher{
+		client: &http.Client{
+			Timeout: timeout,
+			Transport: &http.Transport{
+				Proxy:                 nil, // прокси обошёл бы проверку адреса
+				DialContext:           dialer.DialContext,
+				TLSHandshakeTimeout:   timeout,
+				ResponseHeaderTimeout: timeout,
+				MaxIdleConns:          16,
+				IdleConnTimeout:       30 * time.Second,
+			},
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				if len(via) >= maxRedirects {
+					return errors.New("too many redirects")
+				}
+				if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+					return ErrBlockedAddress
+				}
+				return nil
+			},
+		},
+		maxBytes: maxBytes,
+	}
+}
+
+// Fetch читает OpenGraph разметку страницы; если её мало, дополняет данными oEmbed.
+func (f *HTTPFetcher) Fetch(ctx context.Context, rawURL string) (*models.LinkPreview, error) {
+	if !isWebURL(rawURL) {
+		return nil, ErrUnsupported
+	}
+
+	resp, err := f.get(ctx, rawURL, "text/html,application/xhtml+xml")
+	if err != nil {
+		return nil, err
+	}
+	if !isMediaType(resp, "text/html", "application/xhtml+xml") {
+		resp.Body.Close()
+		return nil, ErrUnsupported
+	}
+	page := resp.Request.URL
+	meta, err := parseHTML(io.LimitReader(resp.Body, f.maxBytes), page)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	preview := meta.preview(rawURL, page)
+	if meta.oembedURL != "" && (preview.Title == "" || preview.ImageURL == "") {
+		// Без oEmbed превью всё равно полезно — его ошибки не критичны
+		if embed, err := f.fetchOEmbed(ctx, meta.oembedURL); err == nil {
+			embed.fill(preview)
+		}
+	}
+	if preview.Title == "" && preview.Description == "" {
+		return nil, ErrNoMetadata
+	}
+	return preview, nil
+}
+
+func (f *HTTPFetcher) get(ctx context.Context, rawURL, accept string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("Accept", accept)
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return resp, nil
+}
+
+type oembed struct {
+	Title        string `json:"title"`
+	AuthorName   string `json:"author_name"`
+	ProviderName string `json:"provider_name"`
+	ThumbnailURL string `json:"thumbnail_url"`
+}
+
+func (f *HTTPFetcher) fetchOEmbed(ctx context.Context, rawURL string) (*oembed, error) {
+	resp, err := f.get(ctx, rawURL, "application/json")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var embed oembed
+	if err := json.NewDecoder(io.LimitReader(resp.Body, f.maxBytes)).Decode(&embed); err != nil {
+		return nil, fmt.Errorf("failed to decode oembed: %w", err)
+	}
+	return &embed, nil
+}
+
+// fill дополняет пустые поля превью.
+func (e *oembed) fill(p *models.LinkPreview) {
+	if p.Title == "" {
+		p.Title = truncate(e.Title, maxTitle)
+	}
+	if p.Description == "" {
+		p.Description = truncate(e.AuthorName, maxDescription)
+	}
+	if p.SiteName == "" {
+		p.SiteName = truncate(e.ProviderName, maxTitle)
+	}
+	if p.ImageURL == "" && isWebURL(e.ThumbnailURL) {
+		p.ImageURL = e.ThumbnailURL
+	}
+}
+
+func isMediaType(resp *http.Response, types ...string) bool {
+	mediaType, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+	for _, t := range types {
+		if mediaType == t {
+			return true
+		}
+	}
+	return false
+}
+
+// Сети вне IsPrivate/IsLoopback/IsLinkLocal, куда тоже нельзя ходить.
+var blockedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"), // CGNAT
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"), // NAT64 — внутри может быть любой IPv4
+}
+
+// guardDial пропускает только соединения с публичными адресами на 80 и 443.
+func guardDial(network, address string, _ syscall.RawConn) error {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if port != "80" && port != "443" {
+		return ErrBlockedAddress
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil || !isPublic(ip) {
+		return ErrBlockedAddress
+	}
+	return nil
+}
+
+func isPublic(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	if !ip.IsGlobalUnicast() || ip.IsPrivate() {
+		return false
+	}
+	for _, p := range blockedPrefixes {
+		if p.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+var bareURL = regexp.MustCompile(`https?://[^\s<>"]+`)
+
+// FirstURL возвращает ссылку для превью: первую из сущностей link,
+// а если их нет — первый http(s) адрес в тексте. "" — ссылок нет.
+func FirstURL(text string, entities []models.Entity) string {
+	for _, e := range entities {
+		if e.Type == models.EntityLink && isWebURL(e.URL) {
+			return e.URL
+		}
+	}
+	for _, raw := range bareURL.FindAllString(text, -1) {
+		raw = strings.TrimRight(raw, ".,;:!?)]}'")
+		if isWebURL(raw) {
+			return raw
+		}
+	}
+	return ""
+}
+
+func isWebURL(raw string) bool {
+	if raw == "" || len(raw) > maxURLLength {
+		return false
+	}
+	u, err := url.Parse(raw)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Hostname() != ""
+}
+
+func truncate(s string, n int) string {
+	s = strings.TrimSpace(s)
+	if r := []rune(s); len(r) > n {
+		return strings.TrimSpace(string(r[:n])) + "…"
+	}
+	return s
+}
@@ -0,0 +1,154 @@
+// Chat_Service/linkpreview/fetcher_test.go
+package linkpreview
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"Chat_Service/models"
+)
+
+func TestFetchOpenGraph(t *testing.T) {
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	mux.HandleFunc("/article", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, `<html><head>
+			<title>Fallback</title>
+			<meta property="og:title" content="Статья &amp; заметки">
+			<meta name="description" content="Описание">
+			<meta property="og:image" content="/img/cover.png">
+			<link rel="alternate" type="application/json+oembed" href="/oembed">
+		</head><body><meta property="og:title" content="ignored"></body></html>`)
+	})
+	mux.HandleFunc("/oembed", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"title":"oEmbed title","provider_name":"Example"}`)
+	})
+
+	f := newHTTPFetcher(time.Second, 64*1024, nil)
+	preview, err := f.Fetch(context.Background(), srv.URL+"/article")
+	if err != nil {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+
+	expected := &models.LinkPreview{
+		URL:         srv.URL + "/article",
+		Title:       "Статья & заметки",
+		Description: "Описание",
+		ImageURL:    srv.URL + "/img/cover.png",
+	}
+	if *preview != *expected {
+		t.Errorf("Expected %+v, got %+v", expected, preview)
+	}
+}
+
+func TestFetchOEmbedFillsMissingTitle(t *testing.T) {
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	mux.HandleFunc("/video", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `<head><link rel="alternate" type="application/json+oembed" href="`+srv.URL+`/oembed"></head>`)
+	})
+	mux.HandleFunc("/oembed", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"title":"Video","provider_name":"Tube","thumbnail_url":"https://example.com/t.jpg"}`)
+	})
+
+	preview, err := newHTTPFetcher(time.Second, 64*1024, nil).Fetch(context.Background(), srv.URL+"/video")
+	if err != nil {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+	if preview.Title != "Video" || preview.SiteName != "Tube" || preview.ImageURL != "https://example.com/t.jpg" {
+		t.Errorf("Expected oEmbed data, got %+v", preview)
+	}
+}
+
+func TestFetchLimits(t *testing.T) {
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	mux.HandleFunc("/image", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write([]byte("png"))
+	})
+	mux.HandleFunc("/huge", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, "<head>"+strings.Repeat("<!-- padding -->", 1000)+`<title>Late</title></head>`)
+	})
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(time.Second):
+		case <-r.Context().Done():
+		}
+	})
+
+	f := newHTTPFetcher(200*time.Millisecond, 1024, nil)
+	ctx := context.Background()
+
+	if _, err := f.Fetch(ctx, srv.URL+"/image"); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("Expected ErrUnsupported for image, got %v", err)
+	}
+	if _, err := f.Fetch(ctx, srv.URL+"/huge"); !errors.Is(err, ErrNoMetadata) {
+		t.Errorf("Expected body to be cut at the size limit, got %v", err)
+	}
+	if _, err := f.Fetch(ctx, srv.URL+"/slow"); err == nil {
+		t.Error("Expected timeout error")
+	}
+}
+
+func TestFetchBlocksPrivateAddresses(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("Request to a private address must not reach the server")
+	}))
+	defer srv.Close()
+
+	_, err := NewHTTPFetcher(time.Second, 1024).Fetch(context.Background(), srv.URL)
+	if !errors.Is(err, ErrBlockedAddress) {
+		t.Errorf("Expected ErrBlockedAddress, got %v", err)
+	}
+
+	for addr, public := range map[string]bool{
+		"8.8.8.8":          true,
+		"2001:4860::8888":  true,
+		"127.0.0.1":        false,
+		"10.1.2.3":         false,
+		"172.16.0.1":       false,
+		"192.168.1.1":      false,
+		"169.254.169.254":  false,
+		"100.64.0.1":       false,
+		"0.0.0.0":          false,
+		"::1":              false,
+		"fd00::1":          false,
+		"fe80::1":          false,
+		"::ffff:127.0.0.1": false,
+	} {
+		if got := isPublic(netip.MustParseAddr(addr)); got != public {
+			t.Errorf("isPublic(%s) = %v, expected %v", addr, got, public)
+		}
+	}
+}
+
+func TestFirstURL(t *testing.T) {
+	entities := []models.Entity{{Type: models.EntityLink, URL: "https://docs.example.com/"}}
+	if got := FirstURL("see https://example.com", entities); got != "https://docs.example.com/" {
+		t.Errorf("Expected link entity to win, got %q", got)
+	}
+	if got := FirstURL("look (https://example.com/a?b=1).", nil); got != "https://example.com/a?b=1" {
+		t.Errorf("Expected trailing punctuation to be trimmed, got %q", got)
+	}
+	if got := FirstURL("ftp://example.com", nil); got != "" {
+		t.Errorf("Expected no url, got %q", got)
+	}
+}
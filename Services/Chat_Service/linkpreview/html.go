@@ -0,0 +1,155 @@
+// Chat_Service/linkpreview/html.go
+
+package linkpreview
+
+import (
+	"io"
+	"net/url"
+	"strings"
+
+	"Chat_Service/models"
+
+	"golang.org/x/net/html"
+)
+
+// pageMeta — то, что удалось найти в <head> страницы.
+type pageMeta struct {
+	ogTitle, ogDescription, ogImage, ogSiteName string
+	title, description                          string
+	oembedURL                                   string
+}
+
+// parseHTML читает разметку до конца <head>; относительные ссылки
+// разрешаются от base (адреса после редиректов).
+func parseHTML(r io.Reader, base *url.URL) (*pageMeta, error) {
+	meta := &pageMeta{}
+	z := html.NewTokenizer(r)
+	inTitle := false
+
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			if z.Err() == io.EOF {
+				return meta, nil
+			}
+			return meta, z.Err()
+
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := z.TagName()
+			switch string(name) {
+			case "body":
+				return meta, nil
+			case "title":
+				inTitle = true
+			case "meta":
+				if hasAttr {
+					meta.readMeta(attrs(z))
+				}
+			case "link":
+				if hasAttr {
+					meta.readLink(attrs(z), base)
+				}
+			}
+
+		case html.EndTagToken:
+			name, _ := z.TagName()
+			switch string(name) {
+			case "head":
+				return meta, nil
+			case "title":
+				inTitle = false
+			}
+
+		case html.TextToken:
+			if inTitle && meta.title == "" {
+				meta.title = string(z.Text())
+			}
+		}
+	}
+}
+
+func attrs(z *html.Tokenizer) map[string]string {
+	result := map[string]string{}
+	for {
+		key, val, more := z.TagAttr()
+		result[strings.ToLower(string(key))] = string(val)
+		if !more {
+			return result
+		}
+	}
+}
+
+func (m *pageMeta) readMeta(a map[string]string) {
+	content := strings.TrimSpace(a["content"])
+	if content == "" {
+		return
+	}
+	key := a["property"]
+	if key == "" {
+		key = a["name"]
+	}
+
+	// Первое значение побеждает: у og:image их может быть несколько
+	set := func(dst *string) {
+		if *dst == "" {
+			*dst = content
+		}
+	}
+	switch strings.ToLower(key) {
+	case "og:title":
+		set(&m.ogTitle)
+	case "og:description":
+		set(&m.ogDescription)
+	case "og:image", "og:image:url", "og:image:secure_url":
+		set(&m.ogImage)
+	case "og:site_name":
+		set(&m.ogSiteName)
+	case "description":
+		set(&m.description)
+	}
+}
+
+func (m *pageMeta) readLink(a map[string]string, base *url.URL) {
+	if m.oembedURL != "" || !strings.EqualFold(a["rel"], "alternate") ||
+		!strings.EqualFold(a["type"], "application/json+oembed") {
+		return
+	}
+	m.oembedURL = resolve(base, a["href"])
+}
+
+func (m *pageMeta) preview(rawURL string, base *url.URL) *models.LinkPreview {
+	p := &models.LinkPreview{
+		URL:         rawURL,
+		Title:       truncate(firstNonEmpty(m.ogTitle, m.title), maxTitle),
+		Description: truncate(firstNonEmpty(m.ogDescription, m.description), maxDescription),
+		SiteName:    truncate(m.ogSiteName, maxTitle),
+	}
+	if m.ogImage != "" {
+		p.ImageURL = resolve(base, m.ogImage)
+	}
+	return p
+}
+
+// resolve возвращает абсолютную http(s) ссылку или "".
+func resolve(base *url.URL, ref string) string {
+	u, err := url.Parse(strings.TrimSpace(ref))
+	if err != nil {
+		return ""
+	}
+	if base != nil {
+		u = base.ResolveReference(u)
+	}
+	if s := u.String(); isWebURL(s) {
+		return s
+	}
+	return ""
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v = strings.TrimSpace(v); v != "" {
+			return v
+		}
+	}
+	return ""
+}
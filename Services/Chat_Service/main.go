@@ -13,10 +13,14 @@ import (
 	"Chat_Service/config"
 	"Chat_Service/db"
 	"Chat_Service/handlers"
+	"Chat_Service/logger"
+	"Chat_Service/metrics"
 	"Chat_Service/middleware"
+	"Chat_Service/tracing"
 	"Chat_Service/ws"
 
 	"github.com/gorilla/mux"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gorilla/mux/otelmux"
 )
 
 func main() {
@@ -26,6 +30,15 @@ func main() {
 		log.Fatalf("Failed to load config: %v", err)
 	}
 
+	// JSON логи через slog; стандартный log пишет туда же
+	logger.Init("chat-service", cfg.LogLevel)
+
+	// Трассировка (OTLP, no-op без endpoint)
+	shutdownTracing, err := tracing.Init(context.Background(), cfg.Tracing)
+	if err != nil {
+		log.Fatalf("Failed to init tracing: %v", err)
+	}
+
 	// Инициализация БД
 	database, err := db.NewDatabase(cfg.Database)
 	if err != nil {
@@ -37,20 +50,32 @@ func main() {
 	if err := database.Migrate(cfg.Database); err != nil {
 		log.Fatalf("Failed to run migrations: %v", err)
 	}
+	metrics.RegisterDBStats(database.GetDB(), cfg.Database.DBName)
 
 	// Создание WebSocket hub
 	hub := ws.NewHub(cfg, database)
 	go hub.Run()
+	metrics.RegisterWSClients(hub.GetClientCount)
 
 	// Создание обработчиков
 	chatHandler := handlers.NewChatHandler(cfg, database, hub)
 
+	// Фоновые воркеры: отложенные и исчезающие сообщения, превью ссылок
+	workersCtx, stopWorkers := context.WithCancel(context.Background())
+	go chatHandler.RunScheduler(workersCtx)
+	go chatHandler.RunExpirySweeper(workersCtx)
+	go chatHandler.RunLinkPreviews(workersCtx)
+	go chatHandler.RunSyncPruner(workersCtx)
+
 	// Создание роутера
 	r := mux.NewRouter()
 
 	// Middleware
+	r.Use(otelmux.Middleware(cfg.Tracing.ServiceName))
+	r.Use(middleware.RequestID)
 	r.Use(middleware.Logging)
 	r.Use(middleware.Recovery)
+	r.Use(metrics.Middleware)
 	//r.Use(middleware.CORS(cfg.CORS))
 
 	// Регистрация маршрутов
@@ -59,6 +84,9 @@ func main() {
 	// Health check
 	r.HandleFunc("/api/health", healthCheck).Methods("GET")
 
+	// Prometheus
+	r.Handle("/metrics", metrics.Handler()).Methods("GET")
+
 	// HTTP сервер
 	srv := &http.Server{
 		Addr:         cfg.Server.Address,
@@ -83,6 +111,8 @@ func main() {
 
 	log.Println("Shutting down server...")
 
+	stopWorkers()
+
 	// Остановка WebSocket hub
 	hub.Shutdown()
 
@@ -93,6 +123,10 @@ func main() {
 		log.Fatalf("Server forced to shutdown: %v", err)
 	}
 
+	if err := shutdownTracing(ctx); err != nil {
+		log.Printf("Failed to flush traces: %v", err)
+	}
+
 	log.Println("Server exited")
 }
 
@@ -0,0 +1,281 @@
+// Chat_Service/markup/markup.go
+
+// Package markup разбирает разметку текста сообщения в сущности.
+//
+// Синтаксис:
+//
+//	**жирный**  __курсив__  `код`  ```lang
+//	блок кода```  [текст](https://url)  @[Имя](42)
+//
+// Жирный и курсив вкладываются друг в друга и в текст ссылки; внутри кода
+// разметка не действует. \ перед служебным символом выводит его как есть.
+// Незакрытая или некорректная конструкция остаётся обычным текстом.
+package markup
+
+import (
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+
+	"Chat_Service/models"
+)
+
+const special = "\\*_`[]()@"
+
+type parser struct {
+	src      []rune
+	out      strings.Builder
+	pos      int // длина out в UTF-16
+	entities []models.Entity
+}
+
+// Parse возвращает текст без разметки и его сущности, упорядоченные по Offset
+// (объемлющая раньше вложенной).
+func Parse(src string) (string, []models.Entity) {
+	p := &parser{src: []rune(src)}
+	p.parse(0, len(p.src), false)
+
+	sort.SliceStable(p.entities, func(i, j int) bool {
+		a, b := p.entities[i], p.entities[j]
+		if a.Offset != b.Offset {
+			return a.Offset < b.Offset
+		}
+		return a.Length > b.Length
+	})
+	return p.out.String(), p.entities
+}
+
+// Mentions возвращает id упомянутых пользователей без повторов.
+func Mentions(entities []models.Entity) []int {
+	var ids []int
+	seen := map[int]bool{}
+	for _, e := range entities {
+		if e.Type == models.EntityMention && !seen[e.UserID] {
+			seen[e.UserID] = true
+			ids = append(ids, e.UserID)
+		}
+	}
+	return ids
+}
+
+func (p *parser) parse(i, end int, inLink bool) {
+	for i < end {
+		c := p.src[i]
+		switch {
+		case c == '\\' && i+1 < end && strings.ContainsRune(special, p.src[i+1]):
+			p.write(p.src[i+1])
+			i += 2
+			continue
+		case p.hasPrefix(i, end, "```"):
+			if next, ok := p.pre(i, end); ok {
+				i = next
+				continue
+			}
+		case c == '`':
+			if next, ok := p.code(i, end); ok {
+				i = next
+				continue
+			}
+		case p.hasPrefix(i, end, "**"):
+			if next, ok := p.span(i, end, "**", models.EntityBold, inLink); ok {
+				i = next
+				continue
+			}
+		case p.hasPrefix(i, end, "__"):
+			if next, ok := p.span(i, end, "__", models.EntityItalic, inLink); ok {
+				i = next
+				continue
+			}
+		case c == '[' && !inLink:
+			if next, ok := p.link(i, end); ok {
+				i = next
+				continue
+			}
+		case c == '@' && !inLink && i+1 < end && p.src[i+1] == '[':
+			if next, ok := p.mention(i, end); ok {
+				i = next
+				continue
+			}
+		}
+		p.write(c)
+		i++
+	}
+}
+
+// span — **…** или __…__ с вложенной разметкой.
+func (p *parser) span(i, end int, delim, typ string, inLink bool) (int, bool) {
+	start := i + len(delim)
+	closing := p.index(start, end, delim)
+	if closing <= start {
+		return 0, false
+	}
+	offset := p.pos
+	p.parse(start, closing, inLink)
+	p.add(models.Entity{Type: typ, Offset: offset, Length: p.pos - offset})
+	return closing + len(delim), true
+}
+
+func (p *parser) code(i, end int) (int, bool) {
+	closing := p.indexRaw(i+1, end, "`")
+	if closing <= i+1 {
+		return 0, false
+	}
+	offset := p.pos
+	p.writeRaw(i+1, closing)
+	p.add(models.Entity{Type: models.EntityCode, Offset: offset, Length: p.pos - offset})
+	return closing + 1, true
+}
+
+// pre — блок кода; слово сразу после ``` до перевода строки считается языком.
+func (p *parser) pre(i, end int) (int, bool) {
+	start := i + 3
+	closing := p.indexRaw(start, end, "```")
+	if closing < 0 {
+		return 0, false
+	}
+
+	var language string
+	if nl := p.indexRaw(start, closing, "\n"); nl >= 0 {
+		if lang := string(p.src[start:nl]); isLanguage(lang) {
+			language = lang
+			start = nl + 1
+		} else if nl == start {
+			start++
+		}
+	}
+	stop := closing
+	if stop > start && p.src[stop-1] == '\n' {
+		stop--
+	}
+	if stop <= start {
+		return 0, false
+	}
+
+	offset := p.pos
+	p.writeRaw(start, stop)
+	p.add(models.Entity{Type: models.EntityPre, Offset: offset, Length: p.pos - offset, Language: language})
+	return closing + 3, true
+}
+
+// link — [текст](url), допускаются только http и https.
+func (p *parser) link(i, end int) (int, bool) {
+	textEnd := p.index(i+1, end, "]")
+	if textEnd <= i+1 || textEnd+1 >= end || p.src[textEnd+1] != '(' {
+		return 0, false
+	}
+	urlEnd := p.index(textEnd+2, end, ")")
+	if urlEnd < 0 {
+		return 0, false
+	}
+	href, ok := parseURL(string(p.src[textEnd+2 : urlEnd]))
+	if !ok {
+		return 0, false
+	}
+
+	offset := p.pos
+	p.parse(i+1, textEnd, true)
+	p.add(models.Entity{Type: models.EntityLink, Offset: offset, Length: p.pos - offset, URL: href})
+	return urlEnd + 1, true
+}
+
+// mention — @[Имя](id); в тексте остаётся «@Имя».
+func (p *parser) mention(i, end int) (int, bool) {
+	labelEnd := p.index(i+2, end, "]")
+	if labelEnd <= i+2 || labelEnd+1 >= end || p.src[labelEnd+1] != '(' {
+		return 0, false
+	}
+	idEnd := p.index(labelEnd+2, end, ")")
+	if idEnd < 0 {
+		return 0, false
+	}
+	userID, err := strconv.Atoi(string(p.src[labelEnd+2 : idEnd]))
+	if err != nil || userID <= 0 {
+		return 0, false
+	}
+
+	offset := p.pos
+	p.write('@')
+	p.writeRaw(i+2, labelEnd)
+	p.add(models.Entity{Type: models.EntityMention, Offset: offset, Length: p.pos - offset, UserID: userID})
+	return idEnd + 1, true
+}
+
+func (p *parser) add(e models.Entity) {
+	if e.Length > 0 {
+		p.entities = append(p.entities, e)
+	}
+}
+
+func (p *parser) write(r rune) {
+	p.out.WriteRune(r)
+	if n := utf16.RuneLen(r); n > 0 {
+		p.pos += n
+	} else {
+		p.pos++ // невалидный символ пишется как U+FFFD
+	}
+}
+
+func (p *parser) writeRaw(from, to int) {
+	for _, r := range p.src[from:to] {
+		p.write(r)
+	}
+}
+
+func (p *parser) hasPrefix(i, end int, s string) bool {
+	for _, r := range s {
+		if i >= end || p.src[i] != r {
+			return false
+		}
+		i++
+	}
+	return true
+}
+
+// index ищет s в src[from:end], пропуская экранированные символы; -1 — не найдено.
+func (p *parser) index(from, end int, s string) int {
+	for i := from; i < end; i++ {
+		if p.src[i] == '\\' && i+1 < end && strings.ContainsRune(special, p.src[i+1]) {
+			i++
+			continue
+		}
+		if p.hasPrefix(i, end, s) {
+			return i
+		}
+	}
+	return -1
+}
+
+// indexRaw — index без учёта экранирования, для содержимого кода.
+func (p *parser) indexRaw(from, end int, s string) int {
+	for i := from; i < end; i++ {
+		if p.hasPrefix(i, end, s) {
+			return i
+		}
+	}
+	return -1
+}
+
+func isLanguage(s string) bool {
+	if s == "" || len(s) > 32 {
+		return false
+	}
+	for _, r := range s {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("+#-._", r)) {
+			return false
+		}
+	}
+	return true
+}
+
+func parseURL(raw string) (string, bool) {
+	if raw == "" || strings.ContainsAny(raw, " \t\n") {
+		return "", false
+	}
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", false
+	}
+	return u.String(), true
+}
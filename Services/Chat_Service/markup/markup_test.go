@@ -0,0 +1,91 @@
+// Chat_Service/markup/markup_test.go
+package markup
+
+import (
+	"reflect"
+	"testing"
+
+	"Chat_Service/models"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name     string
+		src      string
+		text     string
+		entities []models.Entity
+	}{
+		{
+			name: "plain text is unchanged",
+			src:  "snake_case * 2 [x] @user",
+			text: "snake_case * 2 [x] @user",
+		},
+		{
+			name: "nested bold and italic",
+			src:  "**a __b__**",
+			text: "a b",
+			entities: []models.Entity{
+				{Type: models.EntityBold, Offset: 0, Length: 3},
+				{Type: models.EntityItalic, Offset: 2, Length: 1},
+			},
+		},
+		{
+			name:     "markup inside code is literal",
+			src:      "run `**x**`",
+			text:     "run **x**",
+			entities: []models.Entity{{Type: models.EntityCode, Offset: 4, Length: 5}},
+		},
+		{
+			name:     "pre with language",
+			src:      "```go\nfmt.Println()\n```",
+			text:     "fmt.Println()",
+			entities: []models.Entity{{Type: models.EntityPre, Offset: 0, Length: 13, Language: "go"}},
+		},
+		{
+			name:     "link",
+			src:      "see [docs](https://example.com/a)",
+			text:     "see docs",
+			entities: []models.Entity{{Type: models.EntityLink, Offset: 4, Length: 4, URL: "https://example.com/a"}},
+		},
+		{
+			name: "unsafe link scheme stays text",
+			src:  "[x](javascript:alert(1))",
+			text: "[x](javascript:alert(1))",
+		},
+		{
+			name:     "mention offsets count utf-16 units",
+			src:      "😀 @[Аня](42)",
+			text:     "😀 @Аня",
+			entities: []models.Entity{{Type: models.EntityMention, Offset: 3, Length: 4, UserID: 42}},
+		},
+		{
+			name: "escaped markup",
+			src:  `\*\*a\*\* \@[b](1)`,
+			text: "**a** @[b](1)",
+		},
+		{
+			name: "unclosed bold",
+			src:  "**a",
+			text: "**a",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			text, entities := Parse(tt.src)
+			if text != tt.text {
+				t.Errorf("Expected text %q, got %q", tt.text, text)
+			}
+			if !reflect.DeepEqual(entities, tt.entities) {
+				t.Errorf("Expected entities %+v, got %+v", tt.entities, entities)
+			}
+		})
+	}
+}
+
+func TestMentions(t *testing.T) {
+	_, entities := Parse("@[a](1) @[b](2) @[a again](1)")
+	if ids := Mentions(entities); !reflect.DeepEqual(ids, []int{1, 2}) {
+		t.Errorf("Expected [1 2], got %v", ids)
+	}
+}
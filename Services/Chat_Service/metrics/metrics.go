@@ -0,0 +1,107 @@
+// Chat_Service/metrics/metrics.go
+package metrics
+
+import (
+	"bufio"
+	"database/sql"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "HTTP requests by route, method and status.",
+	}, []string{"route", "method", "status"})
+
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "HTTP request latency by route, method and status.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "method", "status"})
+
+	// WSDroppedFrames — события, не доставленные из-за переполненного буфера клиента
+	WSDroppedFrames = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "chat_ws_dropped_frames_total",
+		Help: "WebSocket events dropped because a client send buffer was full.",
+	})
+)
+
+// RegisterWSClients публикует число подключённых WS клиентов (Hub.GetClientCount).
+func RegisterWSClients(count func() int) {
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "chat_ws_clients",
+		Help: "Currently connected WebSocket clients.",
+	}, func() float64 { return float64(count()) })
+}
+
+// RegisterDBStats публикует статистику пула соединений Postgres.
+func RegisterDBStats(db *sql.DB, dbName string) {
+	prometheus.MustRegister(collectors.NewDBStatsCollector(db, dbName))
+}
+
+// Handler — обработчик /metrics
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// Middleware считает запросы и их длительность по шаблону маршрута mux.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		rec := &statusRecorder{ResponseWriter: w, statusCode: http.StatusOK}
+		next.ServeHTTP(rec, r)
+
+		labels := prometheus.Labels{
+			"route":  routeTemplate(r),
+			"method": r.Method,
+			"status": strconv.Itoa(rec.statusCode),
+		}
+		httpRequests.With(labels).Inc()
+		httpDuration.With(labels).Observe(time.Since(start).Seconds())
+	})
+}
+
+// routeTemplate возвращает шаблон маршрута, чтобы id не раздували кардинальность.
+func routeTemplate(r *http.Request) string {
+	if route := mux.CurrentRoute(r); route != nil {
+		if tpl, err := route.GetPathTemplate(); err == nil {
+			return tpl
+		}
+	}
+	return "unmatched"
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	statusCode int
+}
+
+func (rec *statusRecorder) WriteHeader(code int) {
+	rec.statusCode = code
+	rec.ResponseWriter.WriteHeader(code)
+}
+
+// Hijack нужен для WebSocket
+func (rec *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if hijacker, ok := rec.ResponseWriter.(http.Hijacker); ok {
+		return hijacker.Hijack()
+	}
+	return nil, nil, fmt.Errorf("hijacker not supported")
+}
+
+func (rec *statusRecorder) Flush() {
+	if flusher, ok := rec.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,52 @@
+// Chat_Service/models/emoji_test.go
+package models
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidateReaction(t *testing.T) {
+	valid := []string{
+		"👍",
+		"❤️",
+		"❤",
+		"👍🏽",
+		"👨‍👩‍👧",
+		"👩🏻‍❤️‍💋‍👨🏼",
+		"🏳️‍🌈",
+		"🇷🇺",
+		"1️⃣",
+		"#⃣",
+		"\U0001F3F4\U000E0067\U000E0062\U000E0073\U000E0063\U000E0074\U000E007F", // флаг Шотландии
+	}
+	for _, emoji := range valid {
+		if err := ValidateReaction(emoji); err != nil {
+			t.Errorf("ValidateReaction(%q): expected ok, got %v", emoji, err)
+		}
+	}
+
+	invalid := []string{
+		"",
+		"!!!",
+		"123",
+		"1",
+		"a",
+		"+1",
+		"👍👍",
+		"👍 ",
+		"ok👍",
+		"🇷",
+		"🇷🇺🇷🇺",
+		"🏽",
+		"👍\u200D",
+		"\u200D👍",
+		"\uFE0F",
+		"\U0001F3F4\U000E0067\U000E0062", // теги без завершающего
+	}
+	for _, emoji := range invalid {
+		if err := ValidateReaction(emoji); !errors.Is(err, ErrInvalidReaction) {
+			t.Errorf("ValidateReaction(%q): expected ErrInvalidReaction, got %v", emoji, err)
+		}
+	}
+}
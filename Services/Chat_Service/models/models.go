@@ -5,35 +5,166 @@ import (
 	"errors"
 	"strings"
 	"time"
+	"unicode/utf8"
 )
 
 var (
-	ErrInvalidChatID  = errors.New("invalid chat ID")
-	ErrEmptyMessage   = errors.New("message cannot be empty")
-	ErrMessageTooLong = errors.New("message too long")
-	ErrInvalidMembers = errors.New("invalid chat members")
+	ErrInvalidChatID   = errors.New("invalid chat ID")
+	ErrEmptyMessage    = errors.New("message cannot be empty")
+	ErrMessageTooLong  = errors.New("message too long")
+	ErrInvalidMembers  = errors.New("invalid chat members")
+	ErrInvalidClientID = errors.New("clientMessageId too long")
+	ErrInvalidReaction = errors.New("reaction must be a single emoji")
+	ErrInvalidSendAt   = errors.New("sendAt must be in the future, at most a year ahead")
+	ErrInvalidTTL      = errors.New("ttl must be 0 or between 5 seconds and 1 year")
 )
 
 const MaxMessageLength = 4000
 
+// MaxMembersPerRequest — сколько участников можно передать в одном запросе
+// (создание чата, добавление); общий предел группы задаётся в конфиге.
+const MaxMembersPerRequest = 100
+
+const MaxChatNameLength = 100
+
+// Типы чатов. В канале пишут только owner/admin, остальные — подписчики.
+const (
+	ChatTypeDirect  = "direct"
+	ChatTypeGroup   = "group"
+	ChatTypeChannel = "channel"
+)
+
+// Роли участников группы. В direct чатах все участники — member.
+const (
+	RoleOwner  = "owner"
+	RoleAdmin  = "admin"
+	RoleMember = "member"
+)
+
+// MaxClientMessageIDLength — ограничение на клиентский id сообщения (UUID с запасом)
+const MaxClientMessageIDLength = 64
+
+// Пределы срока жизни сообщений в чате (секунды); 0 — сообщения не исчезают.
+const (
+	MinMessageTTL = 5
+	MaxMessageTTL = 365 * 24 * 60 * 60
+)
+
+// MaxScheduleAhead — насколько вперёд можно запланировать отправку
+const MaxScheduleAhead = 365 * 24 * time.Hour
+
+// Статусы отложенного сообщения. Отправленные из scheduled_messages удаляются.
+const (
+	ScheduledPending = "pending"
+	ScheduledFailed  = "failed" // отправить не удалось, можно перенести или отменить
+)
+
 type Chat struct {
 	ID        string    `json:"id"`
 	Members   []int     `json:"members"`
 	Active    bool      `json:"active"`
 	Type      string    `json:"type"`
 	Name      string    `json:"name,omitempty"`
+	Avatar    string    `json:"-"` // store_name файла в FileStorage
+	AvatarURL string    `json:"avatarUrl,omitempty"`
 	CreatedAt time.Time `json:"created_at"`
+
+	Permissions ChatPermissions `json:"permissions"`
+	MessageTTL  int             `json:"messageTtl,omitempty"` // сек; 0 — сообщения не исчезают
 }
 
 type ChatListItem struct {
 	ChatID            string  `json:"chatId"`
 	Type              string  `json:"type"`
 	Name              string  `json:"name,omitempty"`
-	Members           []int   `json:"members"`
+	Avatar            string  `json:"-"`
+	AvatarURL         string  `json:"avatarUrl,omitempty"`
+	Role              string  `json:"role"`
+	MemberCount       int     `json:"memberCount"`
+	Members           []int   `json:"members"`          // оба участника direct чата; в группах и каналах пуст — см. GET /members
+	PeerID            *int    `json:"peerId,omitempty"` // собеседник в direct чате
 	LastMessageID     *string `json:"lastMessageId"`
+	LastMessageKind   string  `json:"lastMessageKind,omitempty"` // system-сообщения не входят в unreadCount
 	LastReadMessageID *string `json:"lastReadMessageId"`
 	UpdatedAt         UTCTime `json:"updatedAt"`
 	UnreadCount       int     `json:"unreadCount"`
+	UnreadMentions    int     `json:"unreadMentions"` // непрочитанные упоминания, включая ветки
+	Draft             *Draft  `json:"draft,omitempty"`
+	ChatSettings
+}
+
+// ChatSettings — личные настройки чата у участника.
+type ChatSettings struct {
+	MutedUntil       *UTCTime `json:"mutedUntil,omitempty"` // MutedForever — без срока
+	Archived         bool     `json:"archived"`
+	ArchivePermanent bool     `json:"archivePermanent,omitempty"` // иначе чат вернётся из архива с новым сообщением
+	PinnedPosition   *int     `json:"pinnedPosition,omitempty"`   // закреплённые идут первыми по возрастанию
+	MarkedUnread     bool     `json:"markedUnread"`               // снимается отметкой о прочтении
+}
+
+// MutedForever — mutedUntil у чата, выключенного без срока.
+var MutedForever = time.Date(9999, 12, 31, 0, 0, 0, 0, time.UTC)
+
+// MaxPinnedChats — сколько чатов можно закрепить в списке
+const MaxPinnedChats = 10
+
+// Режимы архива (UpdateChatSettingsRequest.Archive)
+const (
+	ArchiveNone         = "none"
+	ArchiveUntilMessage = "until_message"
+	ArchivePermanent    = "permanent"
+)
+
+// MuteRequest — пустой включает уведомления обратно.
+type MuteRequest struct {
+	Until   *time.Time `json:"until,omitempty"`
+	Forever bool       `json:"forever,omitempty"`
+}
+
+// UpdateChatSettingsRequest — меняются только переданные поля.
+type UpdateChatSettingsRequest struct {
+	Mute         *MuteRequest `json:"mute,omitempty"`
+	Archive      *string      `json:"archive,omitempty"`
+	Pinned       *bool        `json:"pinned,omitempty"`
+	MarkedUnread *bool        `json:"markedUnread,omitempty"`
+}
+
+func (r *UpdateChatSettingsRequest) Validate() error {
+	if r.Mute == nil && r.Archive == nil && r.Pinned == nil && r.MarkedUnread == nil {
+		return errors.New("nothing to update")
+	}
+	if r.Mute != nil && r.Mute.Until != nil && (r.Mute.Forever || !r.Mute.Until.After(time.Now())) {
+		return errors.New("mute.until must be in the future and not combined with forever")
+	}
+	if r.Archive != nil {
+		switch *r.Archive {
+		case ArchiveNone, ArchiveUntilMessage, ArchivePermanent:
+		default:
+			return errors.New("archive must be none, until_message or permanent")
+		}
+	}
+	return nil
+}
+
+// ReorderPinnedChatsRequest — новый порядок всех закреплённых чатов.
+type ReorderPinnedChatsRequest struct {
+	ChatIDs []string `json:"chatIds"`
+}
+
+// Draft — неотправленный текст пользователя в чате, общий для всех его устройств.
+// Text хранится как набран, с разметкой.
+type Draft struct {
+	Text      string  `json:"text"`
+	ReplyToID *string `json:"replyToId,omitempty"`
+	UpdatedAt UTCTime `json:"updatedAt"`
+}
+
+// ChatMember — строка постраничного списка участников.
+type ChatMember struct {
+	UserID   int     `json:"userId"`
+	Role     string  `json:"role"`
+	JoinedAt UTCTime `json:"joinedAt"`
+	Online   bool    `json:"online"`
 }
 
 type UTCTime struct {
@@ -76,23 +207,216 @@ type ForwardedMeta struct {
 }
 
 type Message struct {
-	ID             string         `json:"id"`
-	ChatID         string         `json:"chatId"`
-	SenderID       int            `json:"senderId"`
-	Text           string         `json:"text"`
-	ReplyToID      *string        `json:"replyToId,omitempty"`
-	ReplyToMessage *ReplyPreview  `json:"replyToMessage,omitempty"`
-	ForwardedFrom  *ForwardedMeta `json:"forwardedFrom,omitempty"`
-	EditedAt       *UTCTime       `json:"editedAt,omitempty"`
-	DeletedAt      *UTCTime       `json:"deletedAt,omitempty"`
-	Attachments    []Attachment   `json:"attachments,omitempty"`
-	CreatedAt      UTCTime        `json:"createdAt"`
+	ID              string         `json:"id"`
+	ChatID          string         `json:"chatId"`
+	SenderID        int            `json:"senderId"` // для system — кто совершил действие
+	Kind            string         `json:"kind"`
+	System          *SystemPayload `json:"system,omitempty"`
+	Text            string         `json:"text"`
+	Entities        []Entity       `json:"entities,omitempty"` // разметка текста
+	ReplyToID       *string        `json:"replyToId,omitempty"`
+	ThreadRootID    *string        `json:"threadRootId,omitempty"` // ответ в ветке
+	Thread          *ThreadInfo    `json:"thread,omitempty"`       // у корня ветки с ответами
+	ClientMessageID *string        `json:"clientMessageId,omitempty"`
+	ReplyToMessage  *ReplyPreview  `json:"replyToMessage,omitempty"`
+	ForwardedFrom   *ForwardedMeta `json:"forwardedFrom,omitempty"`
+	EditedAt        *UTCTime       `json:"editedAt,omitempty"`
+	DeletedAt       *UTCTime       `json:"deletedAt,omitempty"`
+	Attachments     []Attachment   `json:"attachments,omitempty"`
+	LinkPreview     *LinkPreview   `json:"linkPreview,omitempty"` // появляется после загрузки (message:updated)
+	Reactions       []Reaction     `json:"reactions,omitempty"`
+	Status          string         `json:"status,omitempty"`    // только для своих сообщений: sent/delivered/read
+	ExpiresAt       *UTCTime       `json:"expiresAt,omitempty"` // исчезающее сообщение
+	CreatedAt       UTCTime        `json:"createdAt"`
+}
+
+// LinkPreview — превью первой ссылки сообщения.
+type LinkPreview struct {
+	URL         string `json:"url"`
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	ImageURL    string `json:"imageUrl,omitempty"`
+	SiteName    string `json:"siteName,omitempty"`
+}
+
+// Типы сущностей разметки (Entity.Type)
+const (
+	EntityBold    = "bold"
+	EntityItalic  = "italic"
+	EntityCode    = "code"
+	EntityPre     = "pre"
+	EntityLink    = "link"
+	EntityMention = "mention"
+)
+
+// Entity — фрагмент текста с форматированием. Offset и Length — в UTF-16
+// единицах (как индексы строк в JS), по тексту без разметки.
+type Entity struct {
+	Type     string `json:"type"`
+	Offset   int    `json:"offset"`
+	Length   int    `json:"length"`
+	URL      string `json:"url,omitempty"`      // link
+	UserID   int    `json:"userId,omitempty"`   // mention
+	Language string `json:"language,omitempty"` // pre
+}
+
+// Статус своего сообщения (Message.Status), считается по курсорам остальных участников.
+const (
+	MessageStatusSent      = "sent"
+	MessageStatusDelivered = "delivered"
+	MessageStatusRead      = "read"
+)
+
+// ReadCursor — докуда участник получил и прочитал чат.
+type ReadCursor struct {
+	UserID                 int     `json:"userId"`
+	LastReadMessageID      *string `json:"lastReadMessageId"`
+	LastDeliveredMessageID *string `json:"lastDeliveredMessageId"`
+}
+
+// MaxPinnedMessages — предел закреплённых сообщений в чате
+const MaxPinnedMessages = 50
+
+// PinnedMessage — закреп; Message заполняется при выдаче списка.
+type PinnedMessage struct {
+	MessageID string   `json:"messageId"`
+	PinnedBy  int      `json:"pinnedBy"`
+	PinnedAt  UTCTime  `json:"pinnedAt"`
+	Position  int      `json:"position"`
+	Message   *Message `json:"message,omitempty"`
+}
+
+// ChatPermissions — что разрешено рядовым участникам группы.
+type ChatPermissions struct {
+	MembersCanPin bool `json:"membersCanPin"`
+}
+
+// MaxSearchQueryLength — предел длины поискового запроса
+const MaxSearchQueryLength = 200
+
+// SearchParams — фильтры поиска по сообщениям. ChatID пустой — по всем чатам пользователя.
+type SearchParams struct {
+	Query         string
+	ChatID        string
+	SenderID      *int
+	From          *time.Time
+	To            *time.Time
+	HasAttachment *bool
+	Limit         int
+	Offset        int
+}
+
+// SearchHit — найденное сообщение. Перейти к нему можно через
+// GET /api/chats/{chatId}/messages/{messageId}/context.
+type SearchHit struct {
+	MessageID      string  `json:"messageId"`
+	ChatID         string  `json:"chatId"`
+	SenderID       int     `json:"senderId"`
+	Snippet        string  `json:"snippet"`                // HTML: текст экранирован, совпадения в <mark>
+	ThreadRootID   *string `json:"threadRootId,omitempty"` // найден ответ в ветке
+	HasAttachments bool    `json:"hasAttachments"`
+	CreatedAt      UTCTime `json:"createdAt"`
+}
+
+// ThreadInfo — сводка по ветке на её корневом сообщении.
+type ThreadInfo struct {
+	ReplyCount  int      `json:"replyCount"`
+	LastReplyAt *UTCTime `json:"lastReplyAt,omitempty"`
+	UnreadCount *int     `json:"unreadCount,omitempty"` // только в списке веток пользователя
+}
+
+// ScheduledMessage — сообщение, которое будет отправлено в SendAt.
+// Вложения уже загружены, но до отправки видны только автору (без ссылок).
+type ScheduledMessage struct {
+	ID              string       `json:"id"`
+	ChatID          string       `json:"chatId"`
+	SenderID        int          `json:"senderId"`
+	Text            string       `json:"text"`
+	ReplyToID       *string      `json:"replyToId,omitempty"`
+	ThreadRootID    *string      `json:"threadRootId,omitempty"`
+	ClientMessageID *string      `json:"clientMessageId,omitempty"` // без него clientMessageId отправленного станет ID
+	Attachments     []Attachment `json:"attachments,omitempty"`
+	SendAt          UTCTime      `json:"sendAt"`
+	Status          string       `json:"status"`
+	Error           string       `json:"error,omitempty"` // причина для failed
+	CreatedAt       UTCTime      `json:"createdAt"`
+}
+
+// MessageRevision — прежний текст сообщения: каким он был с WrittenAt до ReplacedAt.
+type MessageRevision struct {
+	Revision   int      `json:"revision"` // 1 — исходный текст
+	Text       string   `json:"text"`
+	Entities   []Entity `json:"entities,omitempty"`
+	WrittenAt  UTCTime  `json:"writtenAt"`
+	ReplacedAt UTCTime  `json:"replacedAt"`
+}
+
+// Reaction — сводка по одной эмодзи-реакции на сообщение.
+type Reaction struct {
+	Emoji       string `json:"emoji"`
+	Count       int    `json:"count"`
+	ReactedByMe bool   `json:"reactedByMe"`
+}
+
+// ReactionUser — кто и чем отреагировал.
+type ReactionUser struct {
+	UserID    int     `json:"userId"`
+	Emoji     string  `json:"emoji"`
+	CreatedAt UTCTime `json:"createdAt"`
+}
+
+// MaxReactionLength — предел длины реакции в байтах: ZWJ-последовательности
+// с тонами кожи (👩🏻‍❤️‍💋‍👨🏼) занимают до 35 байт.
+const MaxReactionLength = 64
+
+// ValidateReaction допускает ровно одно эмодзи, в том числе составное (ZWJ, тон кожи, флаг).
+func ValidateReaction(emoji string) error {
+	if len(emoji) > MaxReactionLength || !utf8.ValidString(emoji) || !isSingleEmoji(emoji) {
+		return ErrInvalidReaction
+	}
+	return nil
+}
+
+// Системные сообщения: события чата (создание, состав, название, роли)
+// хранятся в истории как сообщения kind = system с SystemPayload. Они не
+// входят в счётчики непрочитанного; редактировать, пересылать и реагировать
+// на них нельзя.
+
+// Виды сообщений
+const (
+	MessageKindUser   = "user"
+	MessageKindSystem = "system"
+)
+
+// Типы системных событий (SystemPayload.Type)
+const (
+	SystemChatCreated   = "chat_created" // Name — название, UserIDs — приглашённые при создании
+	SystemMemberAdded   = "member_added"
+	SystemMemberRemoved = "member_removed"
+	SystemMemberLeft    = "member_left"
+	SystemChatRenamed   = "chat_renamed"
+	SystemAvatarChanged = "avatar_changed"
+	SystemRoleChanged   = "role_changed"
+	SystemOwnerChanged  = "owner_changed"
+	SystemMemberJoined  = "member_joined" // вступил по ссылке-приглашению
+	SystemTTLChanged    = "ttl_changed"   // изменён срок жизни сообщений
+)
+
+// SystemPayload — структурированное описание системного события в чате.
+// Клиент сам формирует по нему текст на нужном языке.
+type SystemPayload struct {
+	Type    string `json:"type"`
+	UserIDs []int  `json:"userIds,omitempty"` // над кем совершено действие
+	Name    string `json:"name,omitempty"`    // новое название
+	Role    string `json:"role,omitempty"`    // новая роль
+	TTL     int    `json:"ttl,omitempty"`     // новый срок жизни сообщений, сек; 0 — выключен
 }
 
 type ReplyPreview struct {
 	ID       string `json:"id"`
 	SenderID int    `json:"senderId"`
 	Text     string `json:"text"`
+	Deleted  bool   `json:"deleted,omitempty"` // цитируемое сообщение удалено для всех
 }
 
 type CreateChatRequest struct {
@@ -111,10 +435,131 @@ func (r *CreateChatRequest) Validate() error {
 }
 
 type SendMessageRequest struct {
+	Text            string     `json:"text"`
+	ReplyToID       *string    `json:"replyToId,omitempty"`
+	ThreadRootID    *string    `json:"threadRootId,omitempty"`
+	ClientMessageID *string    `json:"clientMessageId,omitempty"`
+	SendAt          *time.Time `json:"sendAt,omitempty"` // отложенная отправка
+}
+
+// SaveDraftRequest — пустой текст без ответа удаляет черновик.
+type SaveDraftRequest struct {
 	Text      string  `json:"text"`
 	ReplyToID *string `json:"replyToId,omitempty"`
 }
 
+func (r *SaveDraftRequest) Validate() error {
+	if len(r.Text) > MaxMessageLength {
+		return ErrMessageTooLong
+	}
+	if r.ReplyToID != nil && *r.ReplyToID == "" {
+		r.ReplyToID = nil
+	}
+	return nil
+}
+
+// Empty — черновик нечего хранить.
+func (r *SaveDraftRequest) Empty() bool {
+	return strings.TrimSpace(r.Text) == "" && r.ReplyToID == nil
+}
+
+type AddMembersRequest struct {
+	UserIDs []int `json:"userIds"`
+}
+
+func (r *AddMembersRequest) Validate() error {
+	if len(r.UserIDs) == 0 || len(r.UserIDs) > MaxMembersPerRequest {
+		return ErrInvalidMembers
+	}
+	return nil
+}
+
+type RenameChatRequest struct {
+	Name string `json:"name"`
+}
+
+func (r *RenameChatRequest) Validate() error {
+	r.Name = strings.TrimSpace(r.Name)
+	if r.Name == "" || len(r.Name) > MaxChatNameLength {
+		return errors.New("name must be between 1 and 100 characters")
+	}
+	return nil
+}
+
+type SetRoleRequest struct {
+	Role string `json:"role"`
+}
+
+func (r *SetRoleRequest) Validate() error {
+	if r.Role != RoleAdmin && r.Role != RoleMember {
+		return errors.New("role must be admin or member")
+	}
+	return nil
+}
+
+type TransferOwnershipRequest struct {
+	UserID int `json:"userId"`
+}
+
+// ChatInvite — ссылка-приглашение в группу или канал.
+type ChatInvite struct {
+	Code             string   `json:"code"`
+	ChatID           string   `json:"chatId"`
+	CreatedBy        int      `json:"createdBy"`
+	CreatedAt        UTCTime  `json:"createdAt"`
+	ExpiresAt        *UTCTime `json:"expiresAt,omitempty"`
+	UsageLimit       *int     `json:"usageLimit,omitempty"`
+	UsageCount       int      `json:"usageCount"`
+	RequiresApproval bool     `json:"requiresApproval"`
+}
+
+type CreateInviteRequest struct {
+	ExpiresAt        *time.Time `json:"expiresAt,omitempty"`
+	UsageLimit       *int       `json:"usageLimit,omitempty"`
+	RequiresApproval bool       `json:"requiresApproval"`
+}
+
+func (r *CreateInviteRequest) Validate() error {
+	if r.ExpiresAt != nil && !r.ExpiresAt.After(time.Now()) {
+		return errors.New("expiresAt must be in the future")
+	}
+	if r.UsageLimit != nil && *r.UsageLimit <= 0 {
+		return errors.New("usageLimit must be positive")
+	}
+	return nil
+}
+
+// InvitePreview — что видно по ссылке до вступления.
+type InvitePreview struct {
+	Type             string `json:"type"`
+	Name             string `json:"name"`
+	AvatarURL        string `json:"avatarUrl,omitempty"`
+	MemberCount      int    `json:"memberCount"`
+	RequiresApproval bool   `json:"requiresApproval"`
+	Avatar           string `json:"-"`
+	ChatID           string `json:"-"`
+}
+
+// Результат вступления по ссылке (JoinResult.Status)
+const (
+	JoinStatusJoined  = "joined"  // стал участником
+	JoinStatusPending = "pending" // заявка ждёт одобрения администратора
+	JoinStatusMember  = "member"  // уже был участником
+)
+
+type JoinResult struct {
+	ChatID  string   `json:"chatId"`
+	Status  string   `json:"status"`
+	Message *Message `json:"message,omitempty"`
+}
+
+// JoinRequest — заявка на вступление по ссылке с одобрением.
+type JoinRequest struct {
+	UserID     int     `json:"userId"`
+	InviteCode string  `json:"inviteCode"`
+	CreatedAt  UTCTime `json:"createdAt"`
+}
+
 type ForwardMessagesRequest struct {
 	MessageIDs  []string `json:"messageIds"`
 	ToChatID    string   `json:"toChatId"`
@@ -125,6 +570,16 @@ type EditMessageRequest struct {
 	Text string `json:"text"`
 }
 
+func (r *EditMessageRequest) Validate() error {
+	if r.Text == "" {
+		return ErrEmptyMessage
+	}
+	if len(r.Text) > MaxMessageLength {
+		return ErrMessageTooLong
+	}
+	return nil
+}
+
 func (r *ForwardMessagesRequest) Validate() error {
 	if len(r.MessageIDs) == 0 {
 		return errors.New("messageIds required")
@@ -142,12 +597,65 @@ func (r *SendMessageRequest) Validate() error {
 	if len(r.Text) > MaxMessageLength {
 		return ErrMessageTooLong
 	}
+	if r.ClientMessageID != nil && len(*r.ClientMessageID) > MaxClientMessageIDLength {
+		return ErrInvalidClientID
+	}
+	if r.SendAt != nil {
+		return ValidateSendAt(*r.SendAt)
+	}
+	return nil
+}
+
+// ValidateSendAt проверяет время отложенной отправки.
+func ValidateSendAt(t time.Time) error {
+	d := time.Until(t)
+	if d <= 0 || d > MaxScheduleAhead {
+		return ErrInvalidSendAt
+	}
+	return nil
+}
+
+// SetTTLRequest — срок жизни новых сообщений чата в секундах, 0 — выключить.
+type SetTTLRequest struct {
+	TTL int `json:"ttl"`
+}
+
+func (r *SetTTLRequest) Validate() error {
+	if r.TTL != 0 && (r.TTL < MinMessageTTL || r.TTL > MaxMessageTTL) {
+		return ErrInvalidTTL
+	}
+	return nil
+}
+
+// UpdateScheduledRequest — перенос или правка отложенного сообщения; пустые поля не меняются.
+type UpdateScheduledRequest struct {
+	Text   *string    `json:"text,omitempty"`
+	SendAt *time.Time `json:"sendAt,omitempty"`
+}
+
+func (r *UpdateScheduledRequest) Validate() error {
+	if r.Text == nil && r.SendAt == nil {
+		return errors.New("nothing to update")
+	}
+	if r.Text != nil {
+		if *r.Text == "" {
+			return ErrEmptyMessage
+		}
+		if len(*r.Text) > MaxMessageLength {
+			return ErrMessageTooLong
+		}
+	}
+	if r.SendAt != nil {
+		return ValidateSendAt(*r.SendAt)
+	}
 	return nil
 }
 
 type WSMessage struct {
-	Event string      `json:"event"`
-	Data  interface{} `json:"data"`
+	Event       string      `json:"event"`
+	Data        interface{} `json:"data"`
+	TraceParent string      `json:"traceparent,omitempty"` // W3C trace context
+	RequestID   string      `json:"requestId,omitempty"`   // X-Request-ID породившего запроса
 }
 
 type ErrorResponse struct {
@@ -167,4 +675,48 @@ type UnreadResult struct {
 	TotalUnread   int
 	HasMoreBottom bool
 	HasMoreTop    bool
+	NextCursor    string // к более старым сообщениям
+	PrevCursor    string // к более новым
+}
+
+// MessagePage — страница истории чата. NextCursor ведёт к более старым
+// сообщениям, PrevCursor — к более новым; пустой — дальше ничего нет.
+type MessagePage struct {
+	Messages   []Message `json:"messages"`
+	NextCursor string    `json:"nextCursor,omitempty"`
+	PrevCursor string    `json:"prevCursor,omitempty"`
+}
+
+// SyncResponse — что изменилось для пользователя с момента токена.
+// FullResync = true — токена нет, он устарел или изменений слишком много:
+// клиент загружает всё заново, а затем синхронизируется с Token.
+type SyncResponse struct {
+	Token           string           `json:"token"`
+	FullResync      bool             `json:"fullResync"`
+	Chats           []ChatListItem   `json:"chats"`           // затронутые чаты целиком, с настройками
+	RemovedChats    []string         `json:"removedChats"`    // пользователь больше не участник
+	Messages        []Message        `json:"messages"`        // новые и изменённые; удалённые для всех — с deletedAt
+	DeletedMessages []SyncMessageRef `json:"deletedMessages"` // стёртые совсем или скрытые пользователем
+	Members         []SyncMember     `json:"members"`         // состав, роли и курсоры прочтения
+}
+
+type SyncMessageRef struct {
+	ChatID    string `json:"chatId"`
+	MessageID string `json:"messageId"`
+}
+
+// SyncMember — участник чата; Removed — вышел или удалён.
+type SyncMember struct {
+	ChatID                 string  `json:"chatId"`
+	UserID                 int     `json:"userId"`
+	Role                   string  `json:"role,omitempty"`
+	LastReadMessageID      *string `json:"lastReadMessageId,omitempty"`
+	LastDeliveredMessageID *string `json:"lastDeliveredMessageId,omitempty"`
+	Removed                bool    `json:"removed,omitempty"`
+}
+
+// ChatPage — страница списка чатов; закреплённые чаты все приходят на первой.
+type ChatPage struct {
+	Chats      []ChatListItem `json:"chats"`
+	NextCursor string         `json:"nextCursor,omitempty"`
 }
@@ -0,0 +1,63 @@
+// Chat_Service/storage/signer.go
+package storage
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+var (
+	ErrURLExpired     = errors.New("media url expired")
+	ErrInvalidURLSign = errors.New("invalid media url signature")
+)
+
+// URLSigner выдаёт и проверяет подписанные ссылки на медиа.
+// Подпись покрывает имя файла, чат, через который файл выдан, и срок действия,
+// поэтому ссылку нельзя переиспользовать для другого файла или продлить.
+type URLSigner struct {
+	secret []byte
+	ttl    time.Duration
+}
+
+func NewURLSigner(secret []byte, ttl time.Duration) *URLSigner {
+	return &URLSigner{secret: secret, ttl: ttl}
+}
+
+// Sign возвращает query-параметры (chat, exp, sig) для ссылки на storeName.
+func (s *URLSigner) Sign(chatID, storeName string) url.Values {
+	exp := strconv.FormatInt(time.Now().Add(s.ttl).Unix(), 10)
+	return url.Values{
+		"chat": {chatID},
+		"exp":  {exp},
+		"sig":  {s.signature(chatID, storeName, exp)},
+	}
+}
+
+// Verify проверяет подпись и срок ссылки, возвращает chatID из неё.
+func (s *URLSigner) Verify(storeName string, query url.Values) (string, error) {
+	chatID, exp, sig := query.Get("chat"), query.Get("exp"), query.Get("sig")
+	expected := s.signature(chatID, storeName, exp)
+	if chatID == "" || !hmac.Equal([]byte(sig), []byte(expected)) {
+		return "", ErrInvalidURLSign
+	}
+
+	expUnix, err := strconv.ParseInt(exp, 10, 64)
+	if err != nil {
+		return "", ErrInvalidURLSign
+	}
+	if time.Now().Unix() > expUnix {
+		return "", ErrURLExpired
+	}
+	return chatID, nil
+}
+
+func (s *URLSigner) signature(chatID, storeName, exp string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(chatID + "\n" + storeName + "\n" + exp))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,32 @@
+// Chat_Service/storage/signer_test.go
+package storage
+
+import (
+	"testing"
+	"time"
+)
+
+func TestURLSigner(t *testing.T) {
+	signer := NewURLSigner([]byte("secret"), time.Minute)
+	query := signer.Sign("chat-1", "file.png")
+
+	chatID, err := signer.Verify("file.png", query)
+	if err != nil || chatID != "chat-1" {
+		t.Fatalf("Expected valid signature for chat-1, got %q, %v", chatID, err)
+	}
+
+	if _, err := signer.Verify("other.png", query); err != ErrInvalidURLSign {
+		t.Errorf("Expected signature to be bound to file name, got %v", err)
+	}
+
+	tampered := signer.Sign("chat-1", "file.png")
+	tampered.Set("chat", "chat-2")
+	if _, err := signer.Verify("file.png", tampered); err != ErrInvalidURLSign {
+		t.Errorf("Expected signature to be bound to chat, got %v", err)
+	}
+
+	expired := NewURLSigner([]byte("secret"), -time.Minute).Sign("chat-1", "file.png")
+	if _, err := signer.Verify("file.png", expired); err != ErrURLExpired {
+		t.Errorf("Expected expired url to be rejected, got %v", err)
+	}
+}
@@ -4,10 +4,11 @@ package ws
 import (
 	"context"
 	"encoding/json"
-	"log"
+	"log/slog"
 	"sync"
 	"time"
 
+	"Chat_Service/logger"
 	"Chat_Service/models"
 
 	"github.com/gorilla/websocket"
@@ -18,19 +19,27 @@ type Client struct {
 	Conn      *websocket.Conn
 	UserID    int // вместо Login
 	send      chan models.WSMessage
-	ctx       context.Context
+	log       *slog.Logger
+	ctx       context.Context // несёт request id и user_id сессии для логов и событий
 	cancel    context.CancelFunc
 	closeOnce sync.Once
+
+	// send пишет и закрывает только Hub.Run, он же меняет unregistered
+	unregistered bool
 }
 
-func NewClient(hub *Hub, conn *websocket.Conn, userID int) *Client {
-	ctx, cancel := context.WithCancel(context.Background())
+// NewClient создаёт WS сессию; requestID — X-Request-ID запроса на подключение.
+func NewClient(hub *Hub, conn *websocket.Conn, userID int, requestID string) *Client {
+	ctx := logger.NewContext(context.Background(), requestID)
+	logger.With(ctx, "user_id", userID)
+	ctx, cancel := context.WithCancel(ctx)
 
 	client := &Client{
 		Hub:    hub,
 		Conn:   conn,
 		UserID: userID,
 		send:   make(chan models.WSMessage, 256),
+		log:    logger.From(ctx),
 		ctx:    ctx,
 		cancel: cancel,
 	}
@@ -64,7 +73,7 @@ func (c *Client) readPump() {
 			var msg models.WSMessage
 			if err := c.Conn.ReadJSON(&msg); err != nil {
 				if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
-					log.Printf("WS read error userID=%d: %v", c.UserID, err)
+					c.log.Warn("ws read error", "error", err)
 				}
 				return
 			}
@@ -91,7 +100,7 @@ func (c *Client) writePump() {
 				return
 			}
 			if err := c.Conn.WriteJSON(message); err != nil {
-				log.Printf("WS write error userID=%d: %v", c.UserID, err)
+				c.log.Warn("ws write error", "error", err)
 				return
 			}
 		case <-ticker.C:
@@ -103,13 +112,10 @@ func (c *Client) writePump() {
 	}
 }
 
+// SendMessage отправляет событие только этому подключению через хаб:
+// send закрывается в Run, и писать в него из других горутин нельзя.
 func (c *Client) SendMessage(message models.WSMessage) {
-	select {
-	case c.send <- message:
-	case <-c.ctx.Done():
-	default:
-		log.Printf("Warning: send buffer full userID=%d", c.UserID)
-	}
+	c.Hub.send(c.ctx, &BroadcastMessage{To: c, Message: message})
 }
 
 func (c *Client) SendError(code, message string) {
@@ -125,8 +131,8 @@ func (c *Client) Close() {
 		if c.Conn != nil {
 			c.Conn.Close()
 		}
-		close(c.send)
-		log.Printf("WS connection closed userID=%d", c.UserID)
+		// send не закрываем: его закроет Hub.Run при Unregister
+		c.log.Info("ws connection closed")
 	})
 }
 
@@ -2,18 +2,26 @@
 package ws
 
 import (
-	"log"
+	"context"
+	"errors"
+	"slices"
 	"sync"
+	"time"
 
 	"Chat_Service/config"
 	"Chat_Service/db"
+	"Chat_Service/logger"
+	"Chat_Service/metrics"
 	"Chat_Service/models"
+	"Chat_Service/tracing"
+
+	"go.opentelemetry.io/otel"
 )
 
 type Hub struct {
 	config     *config.Config
 	db         *db.Database
-	clients    sync.Map // userID (int) -> *Client
+	clients    sync.Map // userID (int) -> []*Client; слайс не меняется, Run подменяет его копией
 	Register   chan *Client
 	Unregister chan *Client
 	broadcast  chan *BroadcastMessage
@@ -22,10 +30,15 @@ type Hub struct {
 }
 
 type BroadcastMessage struct {
-	Recipients []int // user IDs
+	Recipients []int   // user IDs
+	Except     *Client // подключение, которому не слать (источник события)
+	To         *Client // только этому подключению, вместо Recipients
 	Message    models.WSMessage
 }
 
+// maxConnsPerUser — сколько устройств пользователя держим одновременно; лишнее — самое старое — закрывается.
+const maxConnsPerUser = 10
+
 func NewHub(cfg *config.Config, database *db.Database) *Hub {
 	return &Hub{
 		config:     cfg,
@@ -56,55 +69,151 @@ func (h *Hub) Run() {
 	}
 }
 
+// connections возвращает текущие подключения пользователя.
+func (h *Hub) connections(userID int) []*Client {
+	v, _ := h.clients.Load(userID)
+	conns, _ := v.([]*Client)
+	return conns
+}
+
+// registerClient добавляет подключение: пользователь может быть онлайн с нескольких устройств.
+// Вытесненное подключение только закрывается: его send закроет unregisterClient,
+// когда readPump пришлёт Unregister.
 func (h *Hub) registerClient(client *Client) {
-	if existing, exists := h.clients.LoadAndDelete(client.UserID); exists {
-		if c, ok := existing.(*Client); ok {
-			c.Close()
-		}
+	// Unregister мог прийти раньше Register (select выбирает случайно)
+	if client.unregistered {
+		return
+	}
+	conns := append(slices.Clone(h.connections(client.UserID)), client)
+	if len(conns) > maxConnsPerUser {
+		conns[0].Close()
+		conns = conns[1:]
 	}
-	h.clients.Store(client.UserID, client)
-	log.Printf("WS client registered: userID=%d", client.UserID)
+	h.clients.Store(client.UserID, conns)
+	client.log.Info("ws client registered", "connections", len(conns))
 }
 
+// unregisterClient убирает подключение и закрывает его send. Писать в send
+// можно только из Run, поэтому после этого в него уже никто не пишет.
 func (h *Hub) unregisterClient(client *Client) {
-	h.clients.LoadAndDelete(client.UserID)
-	log.Printf("WS client unregistered: userID=%d", client.UserID)
+	if client.unregistered {
+		return
+	}
+	client.unregistered = true
+	close(client.send)
+
+	conns := slices.DeleteFunc(slices.Clone(h.connections(client.UserID)), func(c *Client) bool {
+		return c == client
+	})
+	if len(conns) == 0 {
+		h.clients.Delete(client.UserID)
+	} else {
+		h.clients.Store(client.UserID, conns)
+	}
+	client.log.Info("ws client unregistered")
 }
 
 func (h *Hub) broadcastMessage(msg *BroadcastMessage) {
+	if msg.To != nil {
+		if !msg.To.unregistered {
+			h.deliver(msg.To, msg.Message)
+		}
+		return
+	}
 	for _, uid := range msg.Recipients {
-		if v, ok := h.clients.Load(uid); ok {
-			if c, ok := v.(*Client); ok {
-				select {
-				case c.send <- msg.Message:
-				default:
-					log.Printf("Warning: send buffer full for userID=%d", uid)
-				}
+		for _, c := range h.connections(uid) {
+			if c != msg.Except {
+				h.deliver(c, msg.Message)
 			}
 		}
 	}
 }
 
-func (h *Hub) SendToUsers(userIDs []int, message models.WSMessage) {
-	h.broadcast <- &BroadcastMessage{
-		Recipients: userIDs,
-		Message:    message,
+// deliver кладёт событие в send подключения; вызывается только из Run.
+func (h *Hub) deliver(c *Client, message models.WSMessage) {
+	select {
+	case c.send <- message:
+	default:
+		metrics.WSDroppedFrames.Inc()
+		c.log.Warn("ws send buffer full, dropping event", "event", message.Event)
+	}
+}
+
+// SendToUsers рассылает событие; traceparent и request id из ctx уходят вместе
+// с ним, чтобы клиент и Gateway могли связать событие с породившим его запросом.
+func (h *Hub) SendToUsers(ctx context.Context, userIDs []int, message models.WSMessage) {
+	h.send(ctx, &BroadcastMessage{Recipients: userIDs, Message: message})
+}
+
+func (h *Hub) send(ctx context.Context, msg *BroadcastMessage) {
+	if msg.Message.TraceParent == "" {
+		msg.Message.TraceParent = tracing.TraceParent(ctx)
+	}
+	if msg.Message.RequestID == "" {
+		msg.Message.RequestID = logger.RequestID(ctx)
+	}
+	h.broadcast <- msg
+}
+
+// SendToChat рассылает событие онлайн-участникам чата, кроме пользователей
+// except — на все их устройства. События, пришедшие по HTTP, шлются всем:
+// другие устройства автора тоже должны их получить.
+func (h *Hub) SendToChat(ctx context.Context, chatID string, message models.WSMessage, except ...int) {
+	members := h.onlineMembers(ctx, chatID)
+	recipients := members[:0]
+	for _, uid := range members {
+		if !slices.Contains(except, uid) {
+			recipients = append(recipients, uid)
+		}
+	}
+	if len(recipients) > 0 {
+		h.SendToUsers(ctx, recipients, message)
+	}
+}
+
+// sendToChatExcept рассылает событие онлайн-участникам чата, кроме подключения
+// except, откуда оно пришло; остальные устройства того же пользователя его получат.
+func (h *Hub) sendToChatExcept(ctx context.Context, chatID string, message models.WSMessage, except *Client) {
+	if recipients := h.onlineMembers(ctx, chatID); len(recipients) > 0 {
+		h.send(ctx, &BroadcastMessage{Recipients: recipients, Except: except, Message: message})
 	}
 }
 
-func (h *Hub) SendToUser(userID int, message models.WSMessage) {
-	h.SendToUsers([]int{userID}, message)
+// onlineMembers — подключённые участники чата: участники из БД,
+// пересечённые с подключениями хаба в памяти.
+func (h *Hub) onlineMembers(ctx context.Context, chatID string) []int {
+	members, err := h.db.GetChatMemberIDs(ctx, chatID)
+	if err != nil {
+		logger.From(ctx).Error("get chat members", "chat_id", chatID, "error", err)
+		return nil
+	}
+	return slices.DeleteFunc(members, func(uid int) bool {
+		return !h.IsUserOnline(uid)
+	})
+}
+
+func (h *Hub) SendToUser(ctx context.Context, userID int, message models.WSMessage) {
+	h.SendToUsers(ctx, []int{userID}, message)
 }
 
-// HandleMessage — WS принимает только ping/typing, не сообщения
+// sendToOtherConnections шлёт событие остальным устройствам владельца client.
+func (h *Hub) sendToOtherConnections(ctx context.Context, client *Client, message models.WSMessage) {
+	h.send(ctx, &BroadcastMessage{Recipients: []int{client.UserID}, Except: client, Message: message})
+}
+
+// HandleMessage — WS принимает только ping/typing, подтверждения доставки и черновики, не сообщения
 func (h *Hub) HandleMessage(client *Client, msg models.WSMessage) {
 	switch msg.Event {
 	case "typing:start":
 		h.handleTyping(client, msg, "typing:start")
 	case "typing:stop":
 		h.handleTyping(client, msg, "typing:stop")
+	case "chat:delivered":
+		h.handleDelivered(client, msg)
+	case "draft:save":
+		h.handleDraft(client, msg)
 	default:
-		log.Printf("Unknown WS event: %s from userID=%d", msg.Event, client.UserID)
+		client.log.Warn("unknown ws event", "event", msg.Event)
 	}
 }
 
@@ -119,24 +228,108 @@ func (h *Hub) handleTyping(client *Client, msg models.WSMessage, event string) {
 	}
 
 	// Получаем участников и шлём всем кроме отправителя
-	// Используем короткий контекст
-	import_ctx_cancel := func() {}
-	_ = import_ctx_cancel
+	// Используем короткий контекст сессии, продолжая trace клиента, если он его прислал
+	ctx, cancel := context.WithTimeout(tracing.ContextWithTraceParent(client.ctx, msg.TraceParent), 2*time.Second)
+	defer cancel()
+	ctx, span := otel.Tracer("Chat_Service/ws").Start(ctx, "ws "+event)
+	defer span.End()
 
-	members, err := h.db.GetChatMembers(ctxBackground(), chatID)
+	h.SendToChat(ctx, chatID, models.WSMessage{
+		Event: event,
+		Data:  map[string]interface{}{"chatId": chatID, "fromId": client.UserID},
+	}, client.UserID)
+}
+
+// handleDelivered принимает от клиента {chatId, messageId} — докуда он получил чат —
+// и сообщает остальным участникам, чтобы у отправителей появилась вторая галочка.
+func (h *Hub) handleDelivered(client *Client, msg models.WSMessage) {
+	data, ok := msg.Data.(map[string]interface{})
+	if !ok {
+		return
+	}
+	chatID, _ := data["chatId"].(string)
+	messageID, _ := data["messageId"].(string)
+	if chatID == "" || messageID == "" {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(tracing.ContextWithTraceParent(client.ctx, msg.TraceParent), 2*time.Second)
+	defer cancel()
+	ctx, span := otel.Tracer("Chat_Service/ws").Start(ctx, "ws chat:delivered")
+	defer span.End()
+
+	// Курсор сдвигается только у участника и только вперёд
+	moved, err := h.db.MarkChatDelivered(ctx, chatID, client.UserID, messageID)
 	if err != nil {
+		client.log.Error("mark delivered", "chat_id", chatID, "error", err)
+		return
+	}
+	if !moved {
 		return
 	}
 
-	typingMsg := models.WSMessage{
-		Event: event,
-		Data:  map[string]interface{}{"chatId": chatID, "fromId": client.UserID},
+	h.sendToChatExcept(ctx, chatID, models.WSMessage{
+		Event: "chat:delivered",
+		Data:  map[string]interface{}{"chatId": chatID, "userId": client.UserID, "messageId": messageID},
+	}, client)
+}
+
+// handleDraft сохраняет черновик {chatId, text, replyToId?} (пустой — удаляет)
+// и рассылает draft:updated остальным устройствам пользователя.
+func (h *Hub) handleDraft(client *Client, msg models.WSMessage) {
+	data, ok := msg.Data.(map[string]interface{})
+	if !ok {
+		return
 	}
-	for _, uid := range members {
-		if uid != client.UserID {
-			h.SendToUser(uid, typingMsg)
+	chatID, _ := data["chatId"].(string)
+	if chatID == "" {
+		return
+	}
+	req := models.SaveDraftRequest{}
+	req.Text, _ = data["text"].(string)
+	if replyToID, _ := data["replyToId"].(string); replyToID != "" {
+		req.ReplyToID = &replyToID
+	}
+	if err := req.Validate(); err != nil {
+		client.SendError("validation_error", err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(tracing.ContextWithTraceParent(client.ctx, msg.TraceParent), 2*time.Second)
+	defer cancel()
+	ctx, span := otel.Tracer("Chat_Service/ws").Start(ctx, "ws draft:save")
+	defer span.End()
+
+	var draft *models.Draft
+	if req.Empty() {
+		deleted, err := h.db.DeleteDraft(ctx, chatID, client.UserID)
+		if err != nil {
+			client.log.Error("delete draft", "chat_id", chatID, "error", err)
+			return
+		}
+		if !deleted {
+			return
+		}
+	} else {
+		var err error
+		draft, err = h.db.SaveDraft(ctx, chatID, client.UserID, req.Text, req.ReplyToID)
+		switch {
+		case errors.Is(err, db.ErrNotMember):
+			client.SendError("forbidden", "Not a chat member")
+			return
+		case errors.Is(err, db.ErrMessageNotFound):
+			client.SendError("message_not_found", "Reply target not found")
+			return
+		case err != nil:
+			client.log.Error("save draft", "chat_id", chatID, "error", err)
+			return
 		}
 	}
+
+	h.sendToOtherConnections(ctx, client, models.WSMessage{
+		Event: "draft:updated",
+		Data:  map[string]interface{}{"chatId": chatID, "draft": draft},
+	})
 }
 
 func (h *Hub) IsUserOnline(userID int) bool {
@@ -144,9 +337,13 @@ func (h *Hub) IsUserOnline(userID int) bool {
 	return exists
 }
 
+// GetClientCount — число подключений (не пользователей).
 func (h *Hub) GetClientCount() int {
 	count := 0
-	h.clients.Range(func(_, _ interface{}) bool { count++; return true })
+	h.clients.Range(func(_, v interface{}) bool {
+		count += len(v.([]*Client))
+		return true
+	})
 	return count
 }
 
@@ -157,7 +354,7 @@ func (h *Hub) Shutdown() {
 
 func (h *Hub) shutdownAllClients() {
 	h.clients.Range(func(_, v interface{}) bool {
-		if c, ok := v.(*Client); ok {
+		for _, c := range v.([]*Client) {
 			c.Close()
 		}
 		return true
@@ -13,6 +13,8 @@ type Config struct {
 	Static   StaticConfig
 	Storage  StorageConfig
 	CORS     CORSConfig
+	Tracing  TracingConfig
+	LogLevel string // LOG_LEVEL: debug, info, warn, error
 }
 
 type ServerConfig struct {
@@ -48,6 +50,14 @@ type StorageConfig struct {
 	CDNURL     string
 }
 
+// TracingConfig — экспорт спанов OpenTelemetry.
+// Пустой Endpoint = экспорт выключен, trace context только пробрасывается.
+type TracingConfig struct {
+	Endpoint    string
+	ServiceName string
+	SampleRatio float64
+}
+
 type CORSConfig struct {
 	AllowedOrigins   []string
 	AllowCredentials bool
@@ -93,6 +103,12 @@ func Load() (*Config, error) {
 			AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
 			AllowedHeaders:   []string{"*"},
 		},
+		Tracing: TracingConfig{
+			Endpoint:    getEnv("OTEL_EXPORTER_OTLP_ENDPOINT", ""),
+			ServiceName: getEnv("OTEL_SERVICE_NAME", "user-service"),
+			SampleRatio: getFloatEnv("OTEL_TRACES_SAMPLE_RATIO", 1.0),
+		},
+		LogLevel: getEnv("LOG_LEVEL", "info"),
 	}, nil
 }
 
@@ -138,3 +154,12 @@ func getDurationEnv(key string, defaultValue time.Duration) time.Duration {
 	}
 	return defaultValue
 }
+
+func getFloatEnv(key string, defaultValue float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		if f, err := strconv.ParseFloat(value, 64); err == nil {
+			return f
+		}
+	}
+	return defaultValue
+}
@@ -4,13 +4,13 @@ package handlers
 import (
 	"context"
 	"encoding/json"
-	"log"
 	"net/http"
 	"strconv"
 	"time"
 
 	"User_Service/config"
 	"User_Service/db"
+	"User_Service/logger"
 	"User_Service/models"
 	"User_Service/services"
 
@@ -68,7 +68,7 @@ func (h *UserHandler) GetUsers(w http.ResponseWriter, r *http.Request) {
 
 	users, total, err := h.db.GetAllUsers(ctx, limit, offset)
 	if err != nil {
-		log.Printf("Error getting users: %v", err)
+		logger.From(ctx).Error("get users", "error", err)
 		respondWithError(w, http.StatusInternalServerError, "database_error", "Failed to get users")
 		return
 	}
@@ -144,7 +144,7 @@ func (h *UserHandler) CreateUser(w http.ResponseWriter, r *http.Request) {
 	// Проверка существования пользователя
 	exists, err := h.db.UserExists(ctx, req.Login)
 	if err != nil {
-		log.Printf("Error checking user existence: %v", err)
+		logger.From(ctx).Error("check user existence", "error", err)
 		respondWithError(w, http.StatusInternalServerError, "database_error", "Failed to check user existence")
 		return
 	}
@@ -157,7 +157,7 @@ func (h *UserHandler) CreateUser(w http.ResponseWriter, r *http.Request) {
 	// Создание пользователя
 	user := req.ToUser()
 	if err := h.db.CreateUser(ctx, user); err != nil {
-		log.Printf("Error creating user: %v", err)
+		logger.From(ctx).Error("create user", "error", err)
 		respondWithError(w, http.StatusInternalServerError, "database_error", "Failed to create user")
 		return
 	}
@@ -210,7 +210,7 @@ func (h *UserHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
 
 	// Обновление в БД
 	if err := h.db.UpdateUser(ctx, login, currentUser); err != nil {
-		log.Printf("Error updating user: %v", err)
+		logger.From(ctx).Error("update user", "error", err)
 		respondWithError(w, http.StatusInternalServerError, "database_error", "Failed to update user")
 		return
 	}
@@ -237,7 +237,7 @@ func (h *UserHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
 
 	// Удаление пользователя из БД
 	if err := h.db.DeleteUser(ctx, login); err != nil {
-		log.Printf("Error deleting user: %v", err)
+		logger.From(ctx).Error("delete user", "error", err)
 		respondWithError(w, http.StatusInternalServerError, "database_error", "Failed to delete user")
 		return
 	}
@@ -245,7 +245,7 @@ func (h *UserHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
 	// Удаление аватара (если есть)
 	if user.Picture != "" {
 		if err := h.avatarService.DeleteAvatar(user.Picture); err != nil {
-			log.Printf("Warning: failed to delete avatar: %v", err)
+			logger.From(ctx).Warn("delete avatar failed", "error", err)
 			// Не возвращаем ошибку, т.к. пользователь уже удален
 		}
 	}
@@ -294,7 +294,7 @@ func (h *UserHandler) UploadAvatar(w http.ResponseWriter, r *http.Request) {
 	// Сохранение нового аватара
 	filename, err := h.avatarService.SaveAvatar(file, header)
 	if err != nil {
-		log.Printf("Error saving avatar: %v", err)
+		logger.From(ctx).Error("save avatar", "error", err)
 		respondWithError(w, http.StatusInternalServerError, "upload_error", err.Error())
 		return
 	}
@@ -302,7 +302,7 @@ func (h *UserHandler) UploadAvatar(w http.ResponseWriter, r *http.Request) {
 	// Обновление пользователя в БД
 	user.Picture = filename
 	if err := h.db.UpdateUser(ctx, login, user); err != nil {
-		log.Printf("Error updating user avatar: %v", err)
+		logger.From(ctx).Error("update user avatar", "error", err)
 		respondWithError(w, http.StatusInternalServerError, "database_error", "Failed to update avatar")
 		return
 	}
@@ -339,7 +339,7 @@ func (h *UserHandler) DeleteAvatar(w http.ResponseWriter, r *http.Request) {
 
 	// Удаляем файл
 	if err := h.avatarService.DeleteAvatar(user.Picture); err != nil {
-		log.Printf("Error deleting avatar file: %v", err)
+		logger.From(ctx).Error("delete avatar file", "error", err)
 		respondWithError(w, http.StatusInternalServerError, "delete_error", "Failed to delete avatar")
 		return
 	}
@@ -347,7 +347,7 @@ func (h *UserHandler) DeleteAvatar(w http.ResponseWriter, r *http.Request) {
 	// Обновляем БД
 	user.Picture = ""
 	if err := h.db.UpdateUser(ctx, login, user); err != nil {
-		log.Printf("Error clearing avatar in DB: %v", err)
+		logger.From(ctx).Error("clear avatar in DB", "error", err)
 		respondWithError(w, http.StatusInternalServerError, "database_error", "Failed to update user")
 		return
 	}
@@ -373,7 +373,7 @@ func (h *UserHandler) SearchUsers(w http.ResponseWriter, r *http.Request) {
 
 	users, total, err := h.db.SearchUsers(ctx, searchTerm, limit, offset)
 	if err != nil {
-		log.Printf("Error searching users: %v", err)
+		logger.From(ctx).Error("search users", "error", err)
 		respondWithError(w, http.StatusInternalServerError, "database_error", "Failed to search users")
 		return
 	}
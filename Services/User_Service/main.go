@@ -13,9 +13,13 @@ import (
 	"User_Service/config"
 	"User_Service/db"
 	"User_Service/handlers"
+	"User_Service/logger"
+	"User_Service/metrics"
 	"User_Service/middleware"
+	"User_Service/tracing"
 
 	"github.com/gorilla/mux"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gorilla/mux/otelmux"
 )
 
 func main() {
@@ -25,6 +29,15 @@ func main() {
 		log.Fatalf("Failed to load config: %v", err)
 	}
 
+	// JSON логи через slog; стандартный log пишет туда же
+	logger.Init("user-service", cfg.LogLevel)
+
+	// Трассировка (OTLP, no-op без endpoint)
+	shutdownTracing, err := tracing.Init(context.Background(), cfg.Tracing)
+	if err != nil {
+		log.Fatalf("Failed to init tracing: %v", err)
+	}
+
 	// Инициализация БД
 	database, err := db.NewDatabase(cfg.Database)
 	if err != nil {
@@ -36,6 +49,7 @@ func main() {
 	if err := database.Migrate(cfg.Database); err != nil {
 		log.Fatalf("Failed to run migrations: %v", err)
 	}
+	metrics.RegisterDBStats(database.GetDB(), cfg.Database.DBName)
 
 	// Создание обработчиков
 	userHandler := handlers.NewUserHandler(cfg, database)
@@ -44,8 +58,11 @@ func main() {
 	r := mux.NewRouter()
 
 	// Middleware
+	r.Use(otelmux.Middleware(cfg.Tracing.ServiceName))
+	r.Use(middleware.RequestID)
 	r.Use(middleware.Logging)
 	r.Use(middleware.Recovery)
+	r.Use(metrics.Middleware)
 	//r.Use(middleware.CORS(cfg.CORS))
 
 	// Регистрация маршрутов
@@ -54,6 +71,9 @@ func main() {
 	// Health check
 	r.HandleFunc("/api/health", healthCheck).Methods("GET")
 
+	// Prometheus
+	r.Handle("/metrics", metrics.Handler()).Methods("GET")
+
 	// HTTP сервер
 	srv := &http.Server{
 		Addr:         cfg.Server.Address,
@@ -85,6 +105,10 @@ func main() {
 		log.Fatalf("Server forced to shutdown: %v", err)
 	}
 
+	if err := shutdownTracing(ctx); err != nil {
+		log.Printf("Failed to flush traces: %v", err)
+	}
+
 	log.Println("Server exited")
 }
 
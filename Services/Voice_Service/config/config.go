@@ -28,6 +28,18 @@ type Config struct {
 	// Ограничения комнат
 	MaxRooms       int
 	MaxPeersInRoom int
+
+	// Трассировка OpenTelemetry
+	Tracing  TracingConfig
+	LogLevel string // LOG_LEVEL: debug, info, warn, error
+}
+
+// TracingConfig — экспорт спанов OpenTelemetry.
+// Пустой Endpoint = экспорт выключен, trace context только пробрасывается.
+type TracingConfig struct {
+	Endpoint    string
+	ServiceName string
+	SampleRatio float64
 }
 
 func Load() *Config {
@@ -49,6 +61,13 @@ func Load() *Config {
 
 		MaxRooms:       getIntEnv("MAX_ROOMS", 100),
 		MaxPeersInRoom: getIntEnv("MAX_PEERS_IN_ROOM", 16),
+
+		Tracing: TracingConfig{
+			Endpoint:    getEnv("OTEL_EXPORTER_OTLP_ENDPOINT", ""),
+			ServiceName: getEnv("OTEL_SERVICE_NAME", "voice-service"),
+			SampleRatio: getFloatEnv("OTEL_TRACES_SAMPLE_RATIO", 1.0),
+		},
+		LogLevel: getEnv("LOG_LEVEL", "info"),
 	}
 }
 
@@ -67,3 +86,12 @@ func getIntEnv(key string, def int) int {
 	}
 	return def
 }
+
+func getFloatEnv(key string, def float64) float64 {
+	if v := os.Getenv(key); v != "" {
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			return f
+		}
+	}
+	return def
+}
@@ -16,7 +16,7 @@ package handlers
 import (
 	"context"
 	"encoding/json"
-	"log"
+	"log/slog"
 	"net/http"
 	"strconv"
 	"sync"
@@ -24,6 +24,7 @@ import (
 
 	"Voice_Service/auth"
 	"Voice_Service/config"
+	"Voice_Service/logger"
 	"Voice_Service/sfu"
 	"Voice_Service/signal"
 
@@ -51,6 +52,7 @@ type Session struct {
 	username string
 	conn     *websocket.Conn
 	peer     *sfu.Peer // nil до join
+	log      *slog.Logger
 	mu       sync.Mutex
 	ctx      context.Context
 	cancel   context.CancelFunc
@@ -84,14 +86,17 @@ func (h *VoiceWSHandler) Handle(w http.ResponseWriter, r *http.Request) {
 
 	claims, err := h.jwtService.ValidateToken(token)
 	if err != nil {
-		log.Printf("[ws] invalid token: %v", err)
+		logger.From(r.Context()).Warn("invalid token", "error", err)
 		http.Error(w, "invalid token", http.StatusUnauthorized)
 		return
 	}
 
+	peerID := uuid.NewString()
+	logger.With(r.Context(), "user_id", claims.UserID, "peer_id", peerID)
+
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
-		log.Printf("[ws] upgrade error: %v", err)
+		logger.From(r.Context()).Warn("websocket upgrade failed", "error", err)
 		return
 	}
 
@@ -104,16 +109,17 @@ func (h *VoiceWSHandler) Handle(w http.ResponseWriter, r *http.Request) {
 
 	ctx, cancel := context.WithCancel(context.Background())
 	session := &Session{
-		peerID:   uuid.NewString(),
+		peerID:   peerID,
 		userID:   strconv.Itoa(claims.UserID),
 		username: claims.Name,
 		conn:     conn,
+		log:      logger.From(r.Context()),
 		ctx:      ctx,
 		cancel:   cancel,
 	}
 
 	h.sessions.Store(session.peerID, session)
-	log.Printf("[ws] session opened: peer=%s user=%s", session.peerID, session.userID)
+	session.log.Info("voice session opened")
 
 	// Запускаем ping
 	go h.pingLoop(session)
@@ -127,7 +133,7 @@ func (h *VoiceWSHandler) Handle(w http.ResponseWriter, r *http.Request) {
 	session.cancel()
 	conn.Close()
 
-	log.Printf("[ws] session closed: peer=%s", session.peerID)
+	session.log.Info("voice session closed")
 }
 
 // readLoop — читает входящие сообщения от клиента
@@ -145,14 +151,14 @@ func (h *VoiceWSHandler) readLoop(s *Session) {
 				websocket.CloseGoingAway,
 				websocket.CloseAbnormalClosure,
 			) {
-				log.Printf("[ws] read error peer=%s: %v", s.peerID, err)
+				s.log.Warn("ws read error", "error", err)
 			}
 			return
 		}
 
 		var msg signal.IncomingMessage
 		if err := json.Unmarshal(data, &msg); err != nil {
-			log.Printf("[ws] unmarshal error peer=%s: %v", s.peerID, err)
+			s.log.Warn("ws unmarshal error", "error", err)
 			continue
 		}
 
@@ -175,7 +181,7 @@ func (h *VoiceWSHandler) pingLoop(s *Session) {
 			err := s.conn.WriteMessage(websocket.PingMessage, nil)
 			s.mu.Unlock()
 			if err != nil {
-				log.Printf("[ws] ping error peer=%s: %v", s.peerID, err)
+				s.log.Warn("ws ping failed", "error", err)
 				s.cancel()
 				return
 			}
@@ -211,7 +217,7 @@ func (h *VoiceWSHandler) dispatch(s *Session, msg signal.IncomingMessage) {
 		h.handleDeafened(s, msg.Payload)
 
 	default:
-		log.Printf("[ws] unknown message type: %s peer=%s", msg.Type, s.peerID)
+		s.log.Warn("unknown message type", "type", msg.Type)
 	}
 }
 
@@ -265,7 +271,7 @@ func (h *VoiceWSHandler) handleJoin(s *Session, raw json.RawMessage) {
 	// (заменяем writeLoop который раньше не имел peer'а)
 	go h.peerWriteLoop(s, peer)
 
-	log.Printf("[ws] peer=%s joined room=%s", s.peerID, payload.RoomID)
+	s.log.Info("peer joined room", "room_id", payload.RoomID)
 }
 
 // peerWriteLoop — читает из peer.send и пишет в WS.
@@ -280,7 +286,7 @@ func (h *VoiceWSHandler) peerWriteLoop(s *Session, peer *sfu.Peer) {
 				return
 			}
 			if err := h.writeJSON(s, msg); err != nil {
-				log.Printf("[ws] write error peer=%s: %v", s.peerID, err)
+				s.log.Warn("ws write error", "error", err)
 				s.cancel()
 				return
 			}
@@ -306,14 +312,14 @@ func (h *VoiceWSHandler) handleOffer(s *Session, raw json.RawMessage) {
 
 	answerSDP, err := peer.HandleOffer(payload.SDP)
 	if err != nil {
-		log.Printf("[ws] handle offer peer=%s: %v", s.peerID, err)
+		s.log.Warn("handle offer failed", "error", err)
 		h.sendError(s, signal.ErrWebRTC, "failed to process offer")
 		return
 	}
 
 	// Пустой SDP — offer буферизирован из-за glare, answer придёт позже
 	if answerSDP == "" {
-		log.Printf("[ws] offer buffered (glare) peer=%s", s.peerID)
+		s.log.Debug("offer buffered (glare)")
 		return
 	}
 
@@ -339,7 +345,7 @@ func (h *VoiceWSHandler) handleAnswer(s *Session, raw json.RawMessage) {
 	}
 
 	if err := peer.HandleAnswer(payload.SDP); err != nil {
-		log.Printf("[ws] handle answer peer=%s: %v", s.peerID, err)
+		s.log.Warn("handle answer failed", "error", err)
 	}
 }
 
@@ -359,7 +365,7 @@ func (h *VoiceWSHandler) handleICE(s *Session, raw json.RawMessage) {
 	}
 
 	if err := peer.AddICECandidate(sfu.ICEFromPayload(payload)); err != nil {
-		log.Printf("[ws] add ICE candidate peer=%s: %v", s.peerID, err)
+		s.log.Warn("add ICE candidate failed", "error", err)
 	}
 }
 
@@ -426,7 +432,7 @@ func (h *VoiceWSHandler) handleLeave(s *Session) {
 	s.peer = nil
 	s.mu.Unlock()
 
-	log.Printf("[ws] peer=%s left room voluntarily", s.peerID)
+	s.log.Info("peer left room voluntarily")
 }
 
 func (h *VoiceWSHandler) handleSetLayer(s *Session, raw json.RawMessage) {
@@ -12,20 +12,43 @@ import (
 
 	"Voice_Service/config"
 	"Voice_Service/handlers"
+	"Voice_Service/logger"
+	"Voice_Service/metrics"
 	"Voice_Service/middleware"
 	"Voice_Service/sfu"
+	"Voice_Service/tracing"
 
 	"github.com/gorilla/mux"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gorilla/mux/otelmux"
 )
 
 func main() {
 	cfg := config.Load()
 
+	// JSON логи через slog; стандартный log пишет туда же
+	logger.Init("voice-service", cfg.LogLevel)
+
+	// Трассировка (OTLP, no-op без endpoint)
+	shutdownTracing, err := tracing.Init(context.Background(), cfg.Tracing)
+	if err != nil {
+		log.Fatalf("Failed to init tracing: %v", err)
+	}
+
 	sfuEngine := sfu.NewEngine(cfg)
+	metrics.RegisterRooms(func() (rooms, peers int) {
+		list := sfuEngine.ListRooms()
+		for _, room := range list {
+			peers += room.PeerCount
+		}
+		return len(list), peers
+	})
 
 	r := mux.NewRouter()
+	r.Use(otelmux.Middleware(cfg.Tracing.ServiceName))
+	r.Use(middleware.RequestID)
 	r.Use(middleware.Logging)
 	r.Use(middleware.Recovery)
+	r.Use(metrics.Middleware)
 
 	wsHandler := handlers.NewVoiceWSHandler(cfg, sfuEngine)
 	roomHandler := handlers.NewRoomHandler(cfg, sfuEngine)
@@ -45,6 +68,9 @@ func main() {
 		w.Write([]byte(`{"status":"ok","service":"voice"}`))
 	}).Methods("GET")
 
+	// Prometheus
+	r.Handle("/metrics", metrics.Handler()).Methods("GET")
+
 	// c := cors.New(cors.Options{
 	// 	AllowedOrigins:   []string{"*"},
 	// 	AllowCredentials: true,
@@ -81,5 +107,9 @@ func main() {
 		log.Fatalf("Voice service forced shutdown: %v", err)
 	}
 
+	if err := shutdownTracing(ctx); err != nil {
+		log.Printf("Failed to flush traces: %v", err)
+	}
+
 	log.Println("Voice Service exited")
 }
@@ -4,14 +4,35 @@ package middleware
 import (
 	"bufio"
 	"fmt"
-	"log"
 	"net"
 	"net/http"
 	"runtime/debug"
 	"time"
+
+	"Voice_Service/logger"
+
+	"github.com/gorilla/mux"
 )
 
-// Logging middleware для логирования HTTP запросов
+// RequestID берёт X-Request-ID, выставленный Gateway (при прямом обращении
+// генерирует свой), и кладёт его в контекст логгера и в ответ.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(logger.HeaderRequestID)
+		if !logger.ValidRequestID(id) {
+			id = logger.NewRequestID()
+		}
+		w.Header().Set(logger.HeaderRequestID, id)
+
+		ctx := logger.NewContext(r.Context(), id)
+		if roomID := mux.Vars(r)["roomID"]; roomID != "" {
+			logger.With(ctx, "room_id", roomID)
+		}
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// Logging middleware
 func Logging(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
@@ -20,14 +41,12 @@ func Logging(next http.Handler) http.Handler {
 
 		next.ServeHTTP(lrw, r)
 
-		log.Printf(
-			"[%s] %s %s - Status: %d - Duration: %v - IP: %s",
-			r.Method,
-			r.RequestURI,
-			r.Proto,
-			lrw.statusCode,
-			time.Since(start),
-			r.RemoteAddr,
+		logger.From(r.Context()).Info("http request",
+			"method", r.Method,
+			"uri", r.RequestURI,
+			"status", lrw.statusCode,
+			"duration_ms", time.Since(start).Milliseconds(),
+			"remote_addr", r.RemoteAddr,
 		)
 	})
 }
@@ -47,7 +66,10 @@ func Recovery(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		defer func() {
 			if err := recover(); err != nil {
-				log.Printf("Panic recovered: %v\n%s", err, debug.Stack())
+				logger.From(r.Context()).Error("panic recovered",
+					"error", fmt.Sprint(err),
+					"stack", string(debug.Stack()),
+				)
 				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 			}
 		}()
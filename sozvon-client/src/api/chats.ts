@@ -133,6 +133,13 @@ export function getChatInfo(chatId: string) {
   return requestAuth(`/chats/${chatId}`);
 }
 
+// Участники группы или канала постранично; в direct чате они есть в chat.members
+export function getChatMembers(chatId: string, limit = 50, offset = 0) {
+  return requestAuth(
+    `/chats/${chatId}/members?limit=${limit}&offset=${offset}`,
+  );
+}
+
 export function getUnreadMessages(chatId: string) {
   return requestAuth(`/chats/${chatId}/messages/unread`);
 }
@@ -97,7 +97,7 @@ export default function Sidebar() {
                 chat.name,
               );
 
-              const isGroup = chat.type === "group";
+              const isGroup = chat.type !== "direct";
               const displayName = isGroup
                 ? (chat.name ?? "Групповой чат")
                 : (() => {
@@ -1,6 +1,79 @@
 // sozvon-client/src/components/UserInfo.tsx
+import { useEffect, useState } from "react";
 import { useLocation } from "react-router-dom";
 import { useChatContext, DELETED_USER } from "../context/ChatContext";
+import { getChatMembers } from "../api/chats";
+
+const MEMBERS_PAGE = 50;
+
+type GroupInfoProps = {
+  chatId: string;
+  name?: string;
+  memberCount: number;
+};
+
+// Участники группы приходят постранично, а не в списке чатов
+function GroupInfo({ chatId, name, memberCount }: GroupInfoProps) {
+  const { myId, getSafeUser, loadUser } = useChatContext();
+  const [members, setMembers] = useState<number[]>([]);
+  const [hasMore, setHasMore] = useState(false);
+
+  async function loadPage(offset: number) {
+    try {
+      const page = await getChatMembers(chatId, MEMBERS_PAGE, offset);
+      const ids: number[] = page.members.map(
+        (m: { userId: number }) => m.userId,
+      );
+      ids.forEach(loadUser);
+      setMembers((prev) => (offset === 0 ? ids : [...prev, ...ids]));
+      setHasMore(page.hasMore);
+    } catch {
+      setHasMore(false);
+    }
+  }
+
+  useEffect(() => {
+    setMembers([]);
+    loadPage(0);
+  }, [chatId]);
+
+  return (
+    <div style={{ padding: 16 }}>
+      <div style={gs.groupName}>{name ?? "Групповой чат"}</div>
+      <div style={gs.membersLabel}>Участники ({memberCount})</div>
+      <div style={gs.memberList}>
+        {members.map((id) => {
+          const user = getSafeUser(id);
+          return (
+            <div key={id} style={gs.memberItem}>
+              <div style={gs.avatar}>
+                {user.picture ? (
+                  <img src={user.picture} style={gs.avatarImg} />
+                ) : (
+                  <span style={gs.avatarLetter}>
+                    {user.name[0].toUpperCase()}
+                  </span>
+                )}
+              </div>
+              <div>
+                <div style={gs.memberName}>{user.name}</div>
+                {id === myId && <div style={gs.youBadge}>вы</div>}
+              </div>
+            </div>
+          );
+        })}
+        {hasMore && (
+          <button
+            style={gs.moreButton}
+            onClick={() => loadPage(members.length)}
+          >
+            Показать ещё
+          </button>
+        )}
+      </div>
+    </div>
+  );
+}
 
 export default function UserInfo() {
   const { chats, myId, getSafeUser } = useChatContext();
@@ -13,35 +86,14 @@ export default function UserInfo() {
     return <div style={{ padding: 16, color: "#aaa" }}>Выберите чат</div>;
   }
 
-  // ── GROUP ──────────────────────────────────────────────
-  if (chat.type === "group") {
+  // ── GROUP / CHANNEL ────────────────────────────────────
+  if (chat.type !== "direct") {
     return (
-      <div style={{ padding: 16 }}>
-        <div style={gs.groupName}>{chat.name ?? "Групповой чат"}</div>
-        <div style={gs.membersLabel}>Участники ({chat.members.length})</div>
-        <div style={gs.memberList}>
-          {chat.members.map((id) => {
-            const user = getSafeUser(id);
-            return (
-              <div key={id} style={gs.memberItem}>
-                <div style={gs.avatar}>
-                  {user.picture ? (
-                    <img src={user.picture} style={gs.avatarImg} />
-                  ) : (
-                    <span style={gs.avatarLetter}>
-                      {user.name[0].toUpperCase()}
-                    </span>
-                  )}
-                </div>
-                <div>
-                  <div style={gs.memberName}>{user.name}</div>
-                  {id === myId && <div style={gs.youBadge}>вы</div>}
-                </div>
-              </div>
-            );
-          })}
-        </div>
-      </div>
+      <GroupInfo
+        chatId={chat.chatId}
+        name={chat.name}
+        memberCount={chat.memberCount}
+      />
     );
   }
 
@@ -146,4 +198,13 @@ const gs: Record<string, React.CSSProperties> = {
     fontWeight: 600,
     marginTop: 1,
   },
+  moreButton: {
+    alignSelf: "flex-start",
+    padding: "4px 10px",
+    borderRadius: 8,
+    border: "1px solid #ddd",
+    background: "#fff",
+    cursor: "pointer",
+    fontSize: 13,
+  },
 };
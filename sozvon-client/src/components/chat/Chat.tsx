@@ -74,7 +74,7 @@ export default function Chat({ chatId }: Props) {
   const [text, setText] = useState("");
 
   const chat = chats.find((c) => c.chatId === chatId);
-  const isGroup = chat?.type === "group";
+  const isGroup = !!chat && chat.type !== "direct";
 
   // Для direct — собеседник, для group — null
   const withId = !isGroup ? chat?.members.find((m) => m !== myId) : undefined;
@@ -2,6 +2,7 @@
 import { useState } from "react";
 import { useChatContext, DELETED_USER } from "../../context/ChatContext";
 import { forwardMessages } from "../../api/chats";
+import { API_URL } from "../../api/http";
 import type { Message } from "./chat.types";
 
 type Props = {
@@ -75,7 +76,15 @@ export default function ForwardModal({ message, onClose }: Props) {
         >
           {chats.map((chat) => {
             const withId = chat.members.find((m) => m !== myId);
-            const user = withId ? getSafeUser(withId) : DELETED_USER;
+            const user =
+              chat.type !== "direct"
+                ? {
+                    name: chat.name ?? "Групповой чат",
+                    picture: `${API_URL}/static/avatars/group_default.png`,
+                  }
+                : withId
+                  ? getSafeUser(withId)
+                  : DELETED_USER;
             const isSelected = selectedChatId === chat.chatId;
             return (
               <div
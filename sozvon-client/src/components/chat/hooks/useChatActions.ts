@@ -100,7 +100,12 @@ export function useChatActions(
           msg = await sendMessage(chatId, trimmed, replyTo?.id);
         }
 
-        setMessages((prev) => [...prev, msg]);
+        // message:new по WS мог прийти раньше ответа — заменяем его
+        setMessages((prev) =>
+          prev.some((m) => m.id === msg.id)
+            ? prev.map((m) => (m.id === msg.id ? msg : m))
+            : [...prev, msg],
+        );
         notifyOwnMessage(chatId, msg.createdAt, msg.id);
         setReplyTo(null);
       } catch (e) {
@@ -145,8 +145,11 @@ export function useChatMessages(chatId: string) {
           // Есть непрогруженные сообщения внизу — буферизуем
           pendingBottomRef.current = [...pendingBottomRef.current, msg.data];
         } else {
-          // Находимся на актуальном конце — добавляем сразу
-          setMessages((prev) => [...prev, msg.data]);
+          // Находимся на актуальном конце — добавляем сразу.
+          // Своё сообщение могло уже прийти ответом на отправку
+          setMessages((prev) =>
+            prev.some((m) => m.id === msg.data.id) ? prev : [...prev, msg.data],
+          );
         }
       }
     });
@@ -9,7 +9,8 @@ type Chat = {
   chatId: string;
   type: string;
   name?: string;
-  members: number[];
+  members: number[]; // только в direct чатах, участники групп — getChatMembers
+  memberCount: number;
   lastMessageId?: string;
   lastReadMessageId?: string;
   updatedAt?: string;
@@ -264,15 +265,40 @@ export function ChatProvider({ children }: { children: React.ReactNode }) {
         return;
       }
 
+      // Чат прочитан на другом устройстве
+      if (msg.event === "chat:read" && msg.data?.userId === myId) {
+        const chatId: string = msg.data.chatId;
+        setChats((prev) => {
+          const next = prev.map((c) =>
+            c.chatId === chatId
+              ? { ...c, lastReadMessageId: msg.data.messageId }
+              : c,
+          );
+          chatsRef.current = next;
+          return next;
+        });
+        recheckUnread(chatId);
+        return;
+      }
+
       if (msg.event === "message:new") {
         const chatId: string | undefined = msg.data?.chatId;
         const senderId: number | undefined = msg.data?.senderId;
         if (!chatId) return;
-        if (senderId === myId) return;
 
         const messageId: string | undefined =
           msg.data?.messageId ?? msg.data?.id;
 
+        // Своё сообщение — отправлено с другого устройства
+        if (senderId === myId) {
+          notifyOwnMessage(
+            chatId,
+            msg.data.createdAt ?? new Date().toISOString(),
+            messageId,
+          );
+          return;
+        }
+
         setChats((prev) => {
           const index = prev.findIndex((c) => c.chatId === chatId);
           if (index === -1) return prev;